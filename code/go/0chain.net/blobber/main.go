@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -21,12 +22,16 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/handler"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/leader"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/readmarker"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
 	"github.com/0chain/blobber/code/go/0chain.net/core/build"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/encryption"
+	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
 	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
@@ -77,57 +82,113 @@ func initEntities() (err error) {
 	return err
 }
 
-func setupWorkerConfig() {
-	config.Configuration.ContentRefWorkerFreq = viper.GetInt64("contentref_cleaner.frequency")
-	config.Configuration.ContentRefWorkerTolerance = viper.GetInt64("contentref_cleaner.tolerance")
+// setupReloadableConfig reads the settings reloaded on the config file
+// change, see watchConfig.
+func setupReloadableConfig(conf *config.Config) {
+	conf.OpenConnectionWorkerFreq = viper.GetInt64("openconnection_cleaner.frequency")
+	conf.OpenConnectionWorkerTolerance = viper.GetInt64("openconnection_cleaner.tolerance")
+
+	conf.WMRedeemFreq = viper.GetInt64("writemarker_redeem.frequency")
+	conf.WMRedeemNumWorkers = viper.GetInt("writemarker_redeem.num_workers")
+
+	conf.RMRedeemFreq = viper.GetInt64("readmarker_redeem.frequency")
+	conf.RMRedeemNumWorkers = viper.GetInt("readmarker_redeem.num_workers")
+	conf.RMRedeemBatchSize = viper.GetInt("readmarker_redeem.batch_size")
+	conf.RMRedeemThreshold = int64(viper.GetFloat64("readmarker_redeem.threshold") * 1e10)
+	conf.RMRedeemExpiryMargin = viper.GetInt64("readmarker_redeem.expiry_margin")
+	conf.RMRedeemMaxAge = viper.GetInt64("readmarker_redeem.max_age")
+
+	conf.TxnManagerFreq = viper.GetInt64("transaction_manager.frequency")
+	conf.TxnManagerNumWorkers = viper.GetInt("transaction_manager.num_workers")
+	conf.TxnManagerBatchSize = viper.GetInt("transaction_manager.batch_size")
+	conf.TxnManagerMaxAttempts = viper.GetInt("transaction_manager.max_attempts")
+	conf.TxnManagerBackoffBase = viper.GetInt64("transaction_manager.backoff_base")
+	conf.TxnManagerBackoffMax = viper.GetInt64("transaction_manager.backoff_max")
+	conf.TxnManagerConfirmationTimeout = viper.GetInt64("transaction_manager.confirmation_timeout")
+
+	conf.ChallengeResolveFreq = viper.GetInt64("challenge_response.frequency")
+	conf.ChallengeResolveNumWorkers = viper.GetInt("challenge_response.num_workers")
+	conf.ChallengeMaxRetires = viper.GetInt("challenge_response.max_retries")
+	conf.ChallengeValidatorTimeout = viper.GetDuration("challenge_response.validator_timeout")
+
+	conf.ColdStorageMinimumFileSize = viper.GetInt64("cold_storage.min_file_size")
+	conf.ColdStorageTimeLimitInHours = viper.GetInt64("cold_storage.file_time_limit_in_hours")
+	conf.ColdStorageJobQueryLimit = viper.GetInt64("cold_storage.job_query_limit")
+	conf.ColdStorageStartCapacitySize = viper.GetInt64("cold_storage.start_capacity_size")
+	conf.ColdStorageDeleteLocalCopy = viper.GetBool("cold_storage.delete_local_copy")
+	conf.ColdStorageDeleteCloudCopy = viper.GetBool("cold_storage.delete_cloud_copy")
+
+	conf.MinioWorkerFreq = viper.GetInt64("minio.worker_frequency")
+
+	conf.Capacity = viper.GetInt64("capacity")
+	conf.MaxFileSize = viper.GetInt64("max_file_size")
+	conf.MaxUploadParts = viper.GetInt64("max_upload_parts")
+
+	conf.ReadPrice = viper.GetFloat64("read_price")
+	conf.WritePrice = viper.GetFloat64("write_price")
+	conf.MinLockDemand = viper.GetFloat64("min_lock_demand")
+	conf.MaxOfferDuration = viper.GetDuration("max_offer_duration")
+	conf.ChallengeCompletionTime = viper.GetDuration("challenge_completion_time")
+
+	conf.ReadLockTimeout = int64(
+		viper.GetDuration("read_lock_timeout") / time.Second,
+	)
+	conf.WriteLockTimeout = int64(
+		viper.GetDuration("write_lock_timeout") / time.Second,
+	)
 
-	config.Configuration.OpenConnectionWorkerFreq = viper.GetInt64("openconnection_cleaner.frequency")
-	config.Configuration.OpenConnectionWorkerTolerance = viper.GetInt64("openconnection_cleaner.tolerance")
+	conf.MinStake = int64(viper.GetFloat64("min_stake") * 1e10)
+	conf.MaxStake = int64(viper.GetFloat64("max_stake") * 1e10)
+	conf.NumDelegates = viper.GetInt("num_delegates")
+	conf.ServiceCharge = viper.GetFloat64("service_charge")
 
-	config.Configuration.WMRedeemFreq = viper.GetInt64("writemarker_redeem.frequency")
-	config.Configuration.WMRedeemNumWorkers = viper.GetInt("writemarker_redeem.num_workers")
+	conf.RateLimit = viper.GetFloat64("handlers.rate_limit")
+}
 
-	config.Configuration.RMRedeemFreq = viper.GetInt64("readmarker_redeem.frequency")
-	config.Configuration.RMRedeemNumWorkers = viper.GetInt("readmarker_redeem.num_workers")
+func setupWorkerConfig() {
+	setupReloadableConfig(&config.Configuration)
 
-	config.Configuration.ChallengeResolveFreq = viper.GetInt64("challenge_response.frequency")
-	config.Configuration.ChallengeResolveNumWorkers = viper.GetInt("challenge_response.num_workers")
-	config.Configuration.ChallengeMaxRetires = viper.GetInt("challenge_response.max_retries")
+	config.Configuration.ContentRefWorkerFreq = viper.GetInt64("contentref_cleaner.frequency")
+	config.Configuration.ContentRefWorkerTolerance = viper.GetInt64("contentref_cleaner.tolerance")
 
-	config.Configuration.ColdStorageMinimumFileSize = viper.GetInt64("cold_storage.min_file_size")
-	config.Configuration.ColdStorageTimeLimitInHours = viper.GetInt64("cold_storage.file_time_limit_in_hours")
-	config.Configuration.ColdStorageJobQueryLimit = viper.GetInt64("cold_storage.job_query_limit")
-	config.Configuration.ColdStorageStartCapacitySize = viper.GetInt64("cold_storage.start_capacity_size")
-	config.Configuration.ColdStorageDeleteLocalCopy = viper.GetBool("cold_storage.delete_local_copy")
-	config.Configuration.ColdStorageDeleteCloudCopy = viper.GetBool("cold_storage.delete_cloud_copy")
+	config.Configuration.PoolCacheTTL = viper.GetDuration("pool_cache.ttl")
+	config.Configuration.PoolCacheRefreshAhead = viper.GetDuration("pool_cache.refresh_ahead")
+	config.Configuration.PoolCacheStaleWhileRevalidate = viper.GetBool("pool_cache.stale_while_revalidate")
+	config.Configuration.PoolCacheRefreshInterval = viper.GetDuration("pool_cache.refresh_interval")
+	config.Configuration.PoolCacheNumWorkers = viper.GetInt("pool_cache.num_workers")
+	allocation.SetPoolCacheConfig(allocation.PoolCacheConfig{
+		TTL:                  config.Configuration.PoolCacheTTL,
+		RefreshAhead:         config.Configuration.PoolCacheRefreshAhead,
+		StaleWhileRevalidate: config.Configuration.PoolCacheStaleWhileRevalidate,
+		RefreshInterval:      config.Configuration.PoolCacheRefreshInterval,
+		NumWorkers:           config.Configuration.PoolCacheNumWorkers,
+	})
 
 	config.Configuration.MinioStart = viper.GetBool("minio.start")
-	config.Configuration.MinioWorkerFreq = viper.GetInt64("minio.worker_frequency")
 	config.Configuration.MinioUseSSL = viper.GetBool("minio.use_ssl")
 
-	config.Configuration.Capacity = viper.GetInt64("capacity")
-	config.Configuration.MaxFileSize = viper.GetInt64("max_file_size")
-
+	config.Configuration.DBDriver = viper.GetString("db.driver")
+	config.Configuration.DBPath = viper.GetString("db.path")
+	config.Configuration.DBAutoMigrate = viper.GetBool("db.auto_migrate")
+	config.Configuration.LockBackend = viper.GetString("lock.backend")
+	config.Configuration.LockLease = viper.GetDuration("lock.lease")
+	config.Configuration.LockMaxConns = viper.GetInt("lock.max_connections")
+	config.Configuration.ShutdownTimeout = viper.GetDuration("shutdown_timeout")
+	config.Configuration.LeaderElection = viper.GetBool("leader_election.enabled")
+	config.Configuration.LeaderID = viper.GetString("leader_election.id")
+	if config.Configuration.LeaderID == "" {
+		hostname, _ := os.Hostname()
+		config.Configuration.LeaderID = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+	config.Configuration.LeaderLease = viper.GetDuration("leader_election.lease")
+	config.Configuration.LeaderRenewInterval = viper.GetDuration("leader_election.renew_interval")
 	config.Configuration.DBHost = viper.GetString("db.host")
 	config.Configuration.DBName = viper.GetString("db.name")
 	config.Configuration.DBPort = viper.GetString("db.port")
 	config.Configuration.DBUserName = viper.GetString("db.user")
 	config.Configuration.DBPassword = viper.GetString("db.password")
 
-	config.Configuration.Capacity = viper.GetInt64("capacity")
-	config.Configuration.ReadPrice = viper.GetFloat64("read_price")
-	config.Configuration.WritePrice = viper.GetFloat64("write_price")
 	config.Configuration.PriceInUSD = viper.GetBool("price_in_usd")
-	config.Configuration.MinLockDemand = viper.GetFloat64("min_lock_demand")
-	config.Configuration.MaxOfferDuration = viper.GetDuration("max_offer_duration")
-	config.Configuration.ChallengeCompletionTime = viper.GetDuration("challenge_completion_time")
-
-	config.Configuration.ReadLockTimeout = int64(
-		viper.GetDuration("read_lock_timeout") / time.Second,
-	)
-	config.Configuration.WriteLockTimeout = int64(
-		viper.GetDuration("write_lock_timeout") / time.Second,
-	)
 
 	config.Configuration.UpdateAllocationsInterval =
 		viper.GetDuration("update_allocations_interval")
@@ -136,10 +197,6 @@ func setupWorkerConfig() {
 	if w := config.Configuration.DelegateWallet; len(w) != 64 {
 		log.Fatal("invalid delegate wallet:", w)
 	}
-	config.Configuration.MinStake = int64(viper.GetFloat64("min_stake") * 1e10)
-	config.Configuration.MaxStake = int64(viper.GetFloat64("max_stake") * 1e10)
-	config.Configuration.NumDelegates = viper.GetInt("num_delegates")
-	config.Configuration.ServiceCharge = viper.GetFloat64("service_charge")
 
 	config.Configuration.MinSubmit = viper.GetInt("min_submit")
 	if config.Configuration.MinSubmit < 1 {
@@ -155,6 +212,8 @@ func setupWorkerConfig() {
 	}
 
 	transaction.MinConfirmation = config.Configuration.MinConfirmation
+
+	pricing.Setup()
 }
 
 func setupMinioConfig(reader io.Reader) error {
@@ -192,14 +251,48 @@ func setupMinioConfig(reader io.Reader) error {
 	return nil
 }
 
+// setupWorkers starts the background workers, with the leader election
+// only on the replica leading until it steps down.
 func setupWorkers() {
 	var root = common.GetRootContext()
-	handler.SetupWorkers(root)
-	challenge.SetupWorkers(root)
-	readmarker.SetupWorkers(root)
-	writemarker.SetupWorkers(root)
-	allocation.StartUpdateWorker(root,
+	if !config.Configuration.LeaderElection {
+		startWorkers(root)
+		return
+	}
+	if config.Configuration.LeaderRenewInterval <= 0 ||
+		config.Configuration.LeaderRenewInterval >= config.Configuration.LeaderLease {
+		panic("The leader election renew interval must be positive and shorter than the lease")
+	}
+	go leader.NewElector(datastore.GetStore().GetDB(), leader.WorkersLease,
+		config.Configuration.LeaderID, config.Configuration.LeaderLease,
+		config.Configuration.LeaderRenewInterval).Run(root, leadWorkers)
+}
+
+// leadWorkers runs the background workers while the replica leads, until
+// their iterations in flight are finished once it steps down.
+func leadWorkers(ctx context.Context) {
+	startWorkers(ctx)
+	<-ctx.Done()
+	common.WaitOperations(context.Background(), "worker")
+}
+
+// startWorkers starts the background workers running until the context is
+// done.
+func startWorkers(ctx context.Context) {
+	handler.SetupWorkers(ctx)
+	challenge.SetupWorkers(ctx)
+	readmarker.SetupWorkers(ctx)
+	writemarker.SetupWorkers(ctx)
+	txnmanager.SetupWorkers(ctx)
+	allocation.StartUpdateWorker(ctx,
 		config.Configuration.UpdateAllocationsInterval)
+	allocation.StartPoolCacheWorkers(ctx)
+
+	go healthCheckOnChainWorker(ctx)
+
+	if config.Configuration.PriceInUSD || pricing.Enabled() {
+		go addOrUpdateOnChainWorker(ctx)
+	}
 }
 
 func setupDatabase() {
@@ -217,6 +310,30 @@ func setupDatabase() {
 	}
 }
 
+// setupLocks sets up the locks of the allocations, connections and
+// challenges. The postgres locks are shared by the blobber processes using
+// the same DB and storage.
+func setupLocks() {
+	lock.LeaseTimeout = config.Configuration.LockLease
+	switch config.Configuration.LockBackend {
+	case "local":
+	case "postgres":
+		if config.Configuration.DBDriver != datastore.PostgresDriver {
+			panic("The postgres locks require the postgres DB driver")
+		}
+		if config.Configuration.LockMaxConns <= 0 {
+			panic("The lock.max_connections must be positive")
+		}
+		sqldb, err := datastore.GetStore().GetDB().DB()
+		if err != nil {
+			panic(err)
+		}
+		lock.SetProvider(lock.NewAdvisoryProvider(sqldb, config.Configuration.LockMaxConns))
+	default:
+		panic("Unknown lock backend: " + config.Configuration.LockBackend)
+	}
+}
+
 func setupOnChain() {
 	const ATTEMPT_DELAY = 60 * 1 // 1 minute
 
@@ -239,12 +356,6 @@ func setupOnChain() {
 	}
 
 	setupWorkers()
-
-	go healthCheckOnChainWorker()
-
-	if config.Configuration.PriceInUSD {
-		go addOrUpdateOnChainWorker()
-	}
 }
 
 func addOrUpdateOnChain() error {
@@ -262,13 +373,39 @@ func addOrUpdateOnChain() error {
 	return err
 }
 
-func addOrUpdateOnChainWorker() {
+// addOrUpdateOnChainWorker updates the prices of the blobber on chain. The
+// prices in USD are converted to tokens again every price_worker_in_hours,
+// the dynamic prices are published when changed.
+func addOrUpdateOnChainWorker(ctx context.Context) {
 	var REPEAT_DELAY = 60 * 60 * time.Duration(viper.GetInt("price_worker_in_hours")) // 12 hours with default settings
+	var (
+		interval      = REPEAT_DELAY * time.Second
+		lastPublished = time.Now()
+	)
+	if pricing.Enabled() && pricing.UpdateInterval() > 0 {
+		interval = pricing.UpdateInterval()
+	}
 	for {
-		time.Sleep(REPEAT_DELAY * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if pricing.Enabled() {
+			changed, err := pricing.Refresh()
+			if err != nil {
+				Logger.Error("Failed to calculate prices", zap.Error(err))
+				continue
+			}
+			expired := config.Configuration.PriceInUSD && time.Since(lastPublished) >= REPEAT_DELAY*time.Second
+			if !changed && !expired {
+				continue
+			}
+		}
 		if err := addOrUpdateOnChain(); err != nil {
 			continue // pass // required by linting
 		}
+		lastPublished = time.Now()
 	}
 }
 
@@ -291,11 +428,15 @@ func healthCheckOnChain() error {
 	return err
 }
 
-func healthCheckOnChainWorker() {
+func healthCheckOnChainWorker(ctx context.Context) {
 	const REPEAT_DELAY = 60 * 15 // 15 minutes
 
 	for {
-		time.Sleep(REPEAT_DELAY * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(REPEAT_DELAY * time.Second):
+		}
 		if err := healthCheckOnChain(); err != nil {
 			continue // pass // required by linting
 		}
@@ -341,6 +482,11 @@ func setup(logDir string) error {
 // }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	deploymentMode := flag.Int("deployment_mode", 2, "deployment_mode")
 	keysFile := flag.String("keys_file", "", "keys_file")
 	minioFile := flag.String("minio_file", "", "minio_file")
@@ -433,6 +579,8 @@ func main() {
 	chain.SetServerChain(serverChain)
 
 	setupDatabase()
+	migrateDatabase()
+	setupLocks()
 
 	// Initialize after server chain is setup.
 	if err := initEntities(); err != nil {
@@ -495,8 +643,23 @@ func main() {
 			Handler:           rHandler,
 		}
 	}
+	common.ShutdownTimeout = config.Configuration.ShutdownTimeout
+	watchConfig()
 	common.HandleShutdown(server)
-	handler.HandleShutdown(common.GetRootContext())
+	// stop accepting the grpc connections along with the http ones
+	common.OnStop(func(ctx context.Context) {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	})
+	handler.HandleShutdown()
 
 	Logger.Info("Ready to listen to the requests")
 	startTime = time.Now().UTC()
@@ -517,7 +680,12 @@ func main() {
 		if err != nil {
 			log.Fatalf("failed to listen: %v", err)
 		}
-		log.Fatal(grpcServer.Serve(lis))
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
 	}(grpcPortString)
-	log.Fatal(server.ListenAndServe())
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	common.WaitShutdown()
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage: blobber migrate [flags] [command]
+
+Commands:
+  status           show the applied and pending migrations
+  up [version]     migrate up to the version, the latest by default
+  down <version>   revert the migrations after the version
+  force <version>  record the version of a DB migrated by hand
+
+Flags:
+`
+
+// migrateDatabase migrates the schema of the meta data DB to the latest
+// version, or checks it is at the latest version if the auto migration is
+// disabled.
+func migrateDatabase() {
+	db := datastore.GetStore().GetDB()
+	var err error
+	if config.Configuration.DBAutoMigrate {
+		err = datastore.Migrate(db, datastore.LatestVersion())
+	} else {
+		err = datastore.CheckSchema(db)
+	}
+	if err != nil {
+		Logger.Error("Error migrating the database schema", zap.Error(err))
+		panic(err)
+	}
+}
+
+// runMigrate runs the migrate command with the arguments following it.
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	deploymentMode := fs.Int("deployment_mode", 2, "deployment_mode")
+	logDir := fs.String("log_dir", "", "log_dir")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	config.SetupDefaultConfig()
+	config.SetupConfig("./config")
+	config.Configuration.DeploymentMode = byte(*deploymentMode)
+	if config.Development() {
+		logging.InitLogging("development", *logDir, "0chainBlobber.log")
+	} else {
+		logging.InitLogging("production", *logDir, "0chainBlobber.log")
+	}
+	setupWorkerConfig()
+
+	db, err := datastore.OpenDB()
+	if err == nil {
+		err = migrate(db, fs.Args())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func migrate(db *gorm.DB, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	version := datastore.LatestVersion()
+	if len(args) > 1 {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return common.NewErrorf("invalid_parameters", "Invalid version: %v", args[1])
+		}
+		version = v
+	} else if command == "down" || command == "force" {
+		return common.NewErrorf("invalid_parameters", "The %s command requires a version", command)
+	}
+
+	switch command {
+	case "status":
+		return printMigrations(db)
+	case "up":
+		current, err := datastore.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		if version < current {
+			return common.NewErrorf("invalid_parameters",
+				"The schema version %d is newer than %d, use the down command", current, version)
+		}
+		return datastore.Migrate(db, version)
+	case "down":
+		current, err := datastore.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		if version > current {
+			return common.NewErrorf("invalid_parameters",
+				"The schema version %d is older than %d, use the up command", current, version)
+		}
+		return datastore.Migrate(db, version)
+	case "force":
+		return datastore.ForceVersion(db, version)
+	default:
+		return common.NewErrorf("invalid_parameters", "Unknown migrate command: %v", command)
+	}
+}
+
+func printMigrations(db *gorm.DB) error {
+	current, err := datastore.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	applied, err := datastore.AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	appliedAt := make(map[int64]time.Time, len(applied))
+	for _, sm := range applied {
+		appliedAt[sm.Version] = sm.AppliedAt
+	}
+
+	fmt.Printf("schema version %d, latest %d\n\n", current, datastore.LatestVersion())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range datastore.Migrations() {
+		state := "pending"
+		if at, ok := appliedAt[m.Version]; ok {
+			state = at.Format(time.RFC3339)
+		} else if m.Version <= current {
+			state = "not recorded"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/leader"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// termsKeys are the settings published on chain by addOrUpdateOnChain.
+var termsKeys = map[string]bool{
+	"Capacity":                true,
+	"ReadPrice":               true,
+	"WritePrice":              true,
+	"MinLockDemand":           true,
+	"MaxOfferDuration":        true,
+	"ChallengeCompletionTime": true,
+	"MinStake":                true,
+	"MaxStake":                true,
+	"NumDelegates":            true,
+	"ServiceCharge":           true,
+}
+
+// watchConfig reloads the config file on change. The reloadable settings
+// are validated and swapped as a new configuration snapshot, the others
+// need a restart.
+func watchConfig() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		reloadConfig()
+	})
+	viper.WatchConfig()
+}
+
+func reloadConfig() {
+	// the tiers are not a part of the configuration snapshot
+	if reloaded, err := common.ReloadQuotaLimiter(); err != nil {
+		Logger.Error("Rejected the rate_limiters reload", zap.Error(err))
+	} else if reloaded {
+		Logger.Info("Reloaded the rate_limiters")
+	}
+
+	next := *config.Get()
+	setupReloadableConfig(&next)
+	changes, err := config.ReloadConfig(&next)
+	if err != nil {
+		Logger.Error("Rejected the config reload", zap.Error(err), zap.Any("changes", changes))
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	Logger.Info("Reloaded the config", zap.Any("changes", changes))
+
+	var publish, reprice bool
+	for _, c := range changes {
+		switch {
+		case c.Key == "RateLimit":
+			common.SetRateLimit(next.RateLimit)
+		case termsKeys[c.Key]:
+			publish = true
+			reprice = reprice || c.Key == "ReadPrice" || c.Key == "WritePrice"
+		}
+	}
+	// only the replica running the workers updates the blobber on chain
+	if publish && leader.GetStatus().Leader {
+		go func() {
+			// the dynamic prices are based on the configured ones
+			if reprice && pricing.Enabled() {
+				if err := pricing.Recalculate(); err != nil {
+					Logger.Error("Failed to calculate prices", zap.Error(err))
+				}
+			}
+			if err := addOrUpdateOnChain(); err != nil {
+				Logger.Error("Failed to publish the reloaded terms", zap.Error(err))
+			}
+		}()
+	}
+}
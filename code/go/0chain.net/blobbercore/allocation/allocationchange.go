@@ -3,6 +3,7 @@ package allocation
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
@@ -11,6 +12,7 @@ import (
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -113,6 +115,20 @@ func (cc *AllocationChangeCollector) Save(ctx context.Context) error {
 	}
 }
 
+// Touch stores the connection if it is new or postpones its expiration
+// otherwise. Unlike Save it can be called concurrently for the same connection.
+func (cc *AllocationChangeCollector) Touch(ctx context.Context) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	if cc.Status == NewConnection {
+		cc.Status = InProgressConnection
+		return db.Omit("Changes").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "connection_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at"}),
+		}).Create(cc).Error
+	}
+	return db.Model(cc).Update("updated_at", time.Now()).Error
+}
+
 func (cc *AllocationChangeCollector) ComputeProperties() {
 	cc.AllocationChanges = make([]AllocationChangeProcessor, 0, len(cc.Changes))
 	for _, change := range cc.Changes {
@@ -2,6 +2,7 @@ package allocation
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
@@ -331,3 +332,24 @@ func SubReadRedeemed(rps []*ReadPool, redeems []ReadPoolRedeem) {
 		}
 	}
 }
+
+// SubWriteRedeemed subtracts the value moved by a committed write marker
+// from the write pools, the sooner expiring pools first.
+func SubWriteRedeemed(wps []*WritePool, value int64) {
+
+	sort.Slice(wps, func(i, j int) bool {
+		return wps[i].ExpireAt < wps[j].ExpireAt
+	})
+
+	for _, wp := range wps {
+		if value <= 0 {
+			return
+		}
+		var sub = value
+		if sub > wp.Balance {
+			sub = wp.Balance
+		}
+		wp.Balance -= sub
+		value -= sub
+	}
+}
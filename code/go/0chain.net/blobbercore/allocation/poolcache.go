@@ -0,0 +1,446 @@
+package allocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// PoolKind is the kind of the cached pools.
+type PoolKind string
+
+const (
+	ReadPoolKind  PoolKind = "read"
+	WritePoolKind PoolKind = "write"
+)
+
+const (
+	poolCacheQueueSize     = 1000
+	poolCacheRefreshLimit  = 100
+	poolCacheTouchInterval = time.Minute
+)
+
+// PoolCacheConfig of the read and write pools cache.
+type PoolCacheConfig struct {
+	// TTL of the cached pools, zero TTL means the pools are refreshed only
+	// when the cached balance is not enough
+	TTL time.Duration
+	// RefreshAhead is the time before the expiration the pools used
+	// recently are refreshed in background
+	RefreshAhead time.Duration
+	// StaleWhileRevalidate makes requests use the cached pools and schedule
+	// the refreshing instead of requesting sharders
+	StaleWhileRevalidate bool
+	// RefreshInterval of the background refreshing worker
+	RefreshInterval time.Duration
+	// NumWorkers requesting sharders in background
+	NumWorkers int
+}
+
+var (
+	poolCacheConfig = PoolCacheConfig{NumWorkers: 1}
+	poolCacheQueue  = make(chan PoolCache, poolCacheQueueSize)
+	poolCacheQueued sync.Map
+)
+
+// SetPoolCacheConfig sets the configuration of the pools cache.
+func SetPoolCacheConfig(c PoolCacheConfig) {
+	if c.NumWorkers <= 0 {
+		c.NumWorkers = 1
+	}
+	poolCacheConfig = c
+}
+
+// PoolCache is the refreshing state of cached pools of a client, allocation
+// and blobber.
+type PoolCache struct {
+	Kind         PoolKind `gorm:"column:kind;primary_key"`
+	ClientID     string   `gorm:"column:client_id;primary_key"`
+	AllocationID string   `gorm:"column:allocation_id;primary_key"`
+	BlobberID    string   `gorm:"column:blobber_id;primary_key"`
+	// RefreshedAt is the time the pools have been requested from sharders
+	RefreshedAt time.Time `gorm:"column:refreshed_at"`
+	// UsedAt is the last time the pools have been used by a request
+	UsedAt time.Time `gorm:"column:used_at"`
+}
+
+func (*PoolCache) TableName() string {
+	return "pool_cache"
+}
+
+type poolCacheState int
+
+const (
+	poolsFresh poolCacheState = iota
+	poolsExpiring
+	poolsStale
+)
+
+// state of the cached pools at the given time, unknown pools are stale
+func (c *PoolCacheConfig) state(pc *PoolCache, now time.Time) poolCacheState {
+	if pc == nil || pc.RefreshedAt.IsZero() {
+		return poolsStale
+	}
+	if c.TTL <= 0 {
+		return poolsFresh
+	}
+	var age = now.Sub(pc.RefreshedAt)
+	switch {
+	case age >= c.TTL:
+		return poolsStale
+	case age >= c.TTL-c.RefreshAhead:
+		return poolsExpiring
+	}
+	return poolsFresh
+}
+
+func getPoolCache(db *gorm.DB, kind PoolKind, clientID, allocationID,
+	blobberID string) (pc *PoolCache, err error) {
+
+	var pcs []*PoolCache
+	err = db.Model(&PoolCache{}).
+		Where("kind = ? AND client_id = ? AND allocation_id = ? AND blobber_id = ?",
+			kind, clientID, allocationID, blobberID).
+		Limit(1).
+		Find(&pcs).Error
+	if err != nil || len(pcs) == 0 {
+		return
+	}
+	return pcs[0], nil
+}
+
+func (pc *PoolCache) where(db *gorm.DB) *gorm.DB {
+	return db.Model(&PoolCache{}).
+		Where("kind = ? AND client_id = ? AND allocation_id = ? AND blobber_id = ?",
+			pc.Kind, pc.ClientID, pc.AllocationID, pc.BlobberID)
+}
+
+// touch marks the pools used, not more often than the touch interval
+func (pc *PoolCache) touch(db *gorm.DB, now time.Time) error {
+	if now.Sub(pc.UsedAt) < poolCacheTouchInterval {
+		return nil
+	}
+	pc.UsedAt = now
+	return pc.where(db).Update("used_at", now).Error
+}
+
+// refreshed saves the time the pools have been requested at
+func (pc *PoolCache) refreshed(db *gorm.DB, at time.Time) error {
+	pc.RefreshedAt = at
+	if pc.UsedAt.IsZero() {
+		pc.UsedAt = at
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "kind"}, {Name: "client_id"},
+			{Name: "allocation_id"}, {Name: "blobber_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"refreshed_at"}),
+	}).Create(pc).Error
+}
+
+// invalidate makes the cached pools stale
+func invalidatePools(db *gorm.DB, kind PoolKind, clientID, allocationID,
+	blobberID string) error {
+
+	var pc = &PoolCache{Kind: kind, ClientID: clientID,
+		AllocationID: allocationID, BlobberID: blobberID}
+	return pc.where(db).Update("refreshed_at", time.Time{}).Error
+}
+
+// ScheduleRefresh queues the pools to be refreshed in background, it never
+// blocks and the pools already queued are not queued twice.
+func ScheduleRefresh(kind PoolKind, clientID, allocationID, blobberID string) {
+	var pc = PoolCache{Kind: kind, ClientID: clientID,
+		AllocationID: allocationID, BlobberID: blobberID}
+	if _, queued := poolCacheQueued.LoadOrStore(pc.key(), true); queued {
+		return
+	}
+	select {
+	case poolCacheQueue <- pc:
+	default:
+		// full, the refreshing worker picks the pools up later
+		poolCacheQueued.Delete(pc.key())
+	}
+}
+
+func (pc *PoolCache) key() string {
+	return string(pc.Kind) + ":" + pc.ClientID + ":" + pc.AllocationID +
+		":" + pc.BlobberID
+}
+
+// RefreshReadPools requests the read pools from sharders and saves them in
+// the DB cache.
+func RefreshReadPools(db *gorm.DB, clientID, allocationID, blobberID string) (
+	rps []*ReadPool, err error) {
+
+	var now = time.Now() // the pools can't reflect later transactions
+	if rps, err = RequestReadPools(clientID, allocationID); err != nil {
+		return nil, common.NewErrorf("refresh_read_pools",
+			"can't request read pools from sharders: %v", err)
+	}
+	if err = SetReadPools(db, clientID, allocationID, blobberID, rps); err != nil {
+		return nil, common.NewErrorf("refresh_read_pools",
+			"can't save requested read pools: %v", err)
+	}
+	var pc = &PoolCache{Kind: ReadPoolKind, ClientID: clientID,
+		AllocationID: allocationID, BlobberID: blobberID}
+	if err = pc.refreshed(db, now); err != nil {
+		return nil, common.NewErrorf("refresh_read_pools",
+			"can't save read pools refreshing time: %v", err)
+	}
+	return
+}
+
+// RefreshWritePools requests the write pools from sharders and saves them in
+// the DB cache.
+func RefreshWritePools(db *gorm.DB, clientID, allocationID, blobberID string) (
+	wps []*WritePool, err error) {
+
+	var now = time.Now()
+	if wps, err = RequestWritePools(clientID, allocationID); err != nil {
+		return nil, common.NewErrorf("refresh_write_pools",
+			"can't request write pools from sharders: %v", err)
+	}
+	if err = SetWritePools(db, clientID, allocationID, blobberID, wps); err != nil {
+		return nil, common.NewErrorf("refresh_write_pools",
+			"can't save requested write pools: %v", err)
+	}
+	var pc = &PoolCache{Kind: WritePoolKind, ClientID: clientID,
+		AllocationID: allocationID, BlobberID: blobberID}
+	if err = pc.refreshed(db, now); err != nil {
+		return nil, common.NewErrorf("refresh_write_pools",
+			"can't save write pools refreshing time: %v", err)
+	}
+	return
+}
+
+// cachedPools decides whether the cached pools can be used by a request:
+// fresh pools having enough tokens are used as is, expiring ones are
+// refreshed in background. Otherwise, the pools are refreshed synchronously
+// unless the stale-while-revalidate mode is on. It returns true if the pools
+// have to be requested right now.
+func cachedPools(db *gorm.DB, kind PoolKind, clientID, allocationID,
+	blobberID string, enough bool) (request bool, err error) {
+
+	var (
+		now = time.Now()
+		pc  *PoolCache
+	)
+	if pc, err = getPoolCache(db, kind, clientID, allocationID, blobberID); err != nil {
+		return
+	}
+	if pc != nil {
+		if err = pc.touch(db, now); err != nil {
+			return
+		}
+	}
+
+	switch state := poolCacheConfig.state(pc, now); {
+	case state == poolsFresh && enough:
+		return false, nil
+	case state == poolsExpiring && enough:
+		ScheduleRefresh(kind, clientID, allocationID, blobberID)
+		return false, nil
+	case poolCacheConfig.StaleWhileRevalidate:
+		ScheduleRefresh(kind, clientID, allocationID, blobberID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetReadPools returns the cached read pools not expired until the given
+// time. The enough function tells if the pools have enough tokens for the
+// request; the pools are refreshed from sharders as the cache configuration
+// says. The refreshing flag is set if the pools are refreshed in background.
+func GetReadPools(db *gorm.DB, clientID, allocationID, blobberID string,
+	until common.Timestamp, enough func([]*ReadPool) bool) (
+	rps []*ReadPool, refreshing bool, err error) {
+
+	if rps, err = ReadPools(db, clientID, allocationID, blobberID, until); err != nil {
+		return
+	}
+	var request bool
+	request, err = cachedPools(db, ReadPoolKind, clientID, allocationID,
+		blobberID, enough(rps))
+	if err != nil || !request {
+		return rps, poolCacheConfig.StaleWhileRevalidate && !enough(rps), err
+	}
+	if _, err = RefreshReadPools(db, clientID, allocationID, blobberID); err != nil {
+		return
+	}
+	rps, err = ReadPools(db, clientID, allocationID, blobberID, until)
+	return
+}
+
+// GetWritePools is GetReadPools for the write pools of the pending writes.
+func GetWritePools(db *gorm.DB, p *Pending, until common.Timestamp,
+	enough func([]*WritePool) bool) (
+	wps []*WritePool, refreshing bool, err error) {
+
+	if wps, err = p.WritePools(db, p.BlobberID, until); err != nil {
+		return
+	}
+	var request bool
+	request, err = cachedPools(db, WritePoolKind, p.ClientID, p.AllocationID,
+		p.BlobberID, enough(wps))
+	if err != nil || !request {
+		return wps, poolCacheConfig.StaleWhileRevalidate && !enough(wps), err
+	}
+	if _, err = RefreshWritePools(db, p.ClientID, p.AllocationID, p.BlobberID); err != nil {
+		return
+	}
+	wps, err = p.WritePools(db, p.BlobberID, until)
+	return
+}
+
+// redeemReflected tells if the cached pools may reflect a transaction
+// submitted at the given time already, i.e. the pools have been requested
+// after the submission (or the time is unknown).
+func redeemReflected(db *gorm.DB, kind PoolKind, clientID, allocationID,
+	blobberID string, submittedAt time.Time) (bool, error) {
+
+	pc, err := getPoolCache(db, kind, clientID, allocationID, blobberID)
+	if err != nil || pc == nil {
+		return false, err
+	}
+	return submittedAt.IsZero() || pc.RefreshedAt.After(submittedAt), nil
+}
+
+// ReconcileReadRedeemed subtracts the redeemed tokens from the cached read
+// pools. If the pools have been requested after the redeem transaction was
+// submitted the balances may have been reduced already; such pools are
+// invalidated instead and refreshed by the next request.
+func ReconcileReadRedeemed(db *gorm.DB, clientID, allocationID,
+	blobberID string, rps []*ReadPool, redeems []ReadPoolRedeem,
+	submittedAt time.Time) error {
+
+	reflected, err := redeemReflected(db, ReadPoolKind, clientID,
+		allocationID, blobberID, submittedAt)
+	if err != nil {
+		return err
+	}
+	if reflected {
+		return invalidatePools(db, ReadPoolKind, clientID, allocationID, blobberID)
+	}
+	SubReadRedeemed(rps, redeems)
+	return SetReadPools(db, clientID, allocationID, blobberID, rps)
+}
+
+// ReconcileWriteRedeemed is ReconcileReadRedeemed for the value moved from
+// the write pools by a committed write marker.
+func ReconcileWriteRedeemed(db *gorm.DB, clientID, allocationID,
+	blobberID string, value int64, submittedAt time.Time) error {
+
+	reflected, err := redeemReflected(db, WritePoolKind, clientID,
+		allocationID, blobberID, submittedAt)
+	if err != nil {
+		return err
+	}
+	if reflected {
+		return invalidatePools(db, WritePoolKind, clientID, allocationID, blobberID)
+	}
+	var wps []*WritePool
+	err = db.Model(&WritePool{}).
+		Where("client_id = ? AND allocation_id = ? AND blobber_id = ?",
+			clientID, allocationID, blobberID).
+		Find(&wps).Error
+	if err != nil {
+		return err
+	}
+	SubWriteRedeemed(wps, value)
+	return SetWritePools(db, clientID, allocationID, blobberID, wps)
+}
+
+// StartPoolCacheWorkers starts the workers refreshing the pools in
+// background.
+func StartPoolCacheWorkers(ctx context.Context) {
+	for i := 0; i < poolCacheConfig.NumWorkers; i++ {
+		go poolRefreshWorker(ctx)
+	}
+	if poolCacheConfig.TTL > 0 && poolCacheConfig.RefreshInterval > 0 {
+		go PoolCacheWorker(ctx, poolCacheConfig.RefreshInterval)
+	}
+}
+
+// PoolCacheWorker schedules refreshing of the pools used since the last
+// refreshing and expiring soon.
+func PoolCacheWorker(ctx context.Context, interval time.Duration) {
+	Logger.Info("start pools cache worker")
+
+	var tk = time.NewTicker(interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+			if err := scheduleExpiring(ctx, time.Now()); err != nil {
+				Logger.Error("scheduling pools refreshing", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func scheduleExpiring(ctx context.Context, now time.Time) (err error) {
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+
+	var tx = datastore.GetStore().GetTransaction(ctx)
+	defer tx.Rollback()
+
+	var (
+		pcs       []*PoolCache
+		expiresAt = now.Add(poolCacheConfig.RefreshAhead - poolCacheConfig.TTL)
+	)
+	err = tx.Model(&PoolCache{}).
+		Where("used_at > refreshed_at AND refreshed_at < ?", expiresAt).
+		Order("refreshed_at").
+		Limit(poolCacheRefreshLimit).
+		Find(&pcs).Error
+	if err != nil {
+		return
+	}
+	for _, pc := range pcs {
+		ScheduleRefresh(pc.Kind, pc.ClientID, pc.AllocationID, pc.BlobberID)
+	}
+	return
+}
+
+func poolRefreshWorker(ctx context.Context) {
+	for {
+		select {
+		case pc := <-poolCacheQueue:
+			if err := refreshPools(ctx, &pc); err != nil {
+				Logger.Error("refreshing pools", zap.String("kind", string(pc.Kind)),
+					zap.String("client_id", pc.ClientID),
+					zap.String("allocation_id", pc.AllocationID),
+					zap.Error(err))
+			}
+			poolCacheQueued.Delete(pc.key())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func refreshPools(ctx context.Context, pc *PoolCache) (err error) {
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+
+	var tx = datastore.GetStore().GetTransaction(ctx)
+	defer commit(tx, &err)
+
+	if pc.Kind == ReadPoolKind {
+		_, err = RefreshReadPools(tx, pc.ClientID, pc.AllocationID, pc.BlobberID)
+		return
+	}
+	_, err = RefreshWritePools(tx, pc.ClientID, pc.AllocationID, pc.BlobberID)
+	return
+}
@@ -0,0 +1,44 @@
+package allocation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolCacheState(t *testing.T) {
+	var (
+		now = time.Now()
+		c   = PoolCacheConfig{TTL: 10 * time.Minute, RefreshAhead: 2 * time.Minute}
+		at  = func(age time.Duration) *PoolCache {
+			return &PoolCache{RefreshedAt: now.Add(-age)}
+		}
+	)
+
+	require.Equal(t, poolsStale, c.state(nil, now))
+	require.Equal(t, poolsStale, c.state(&PoolCache{}, now))
+	require.Equal(t, poolsFresh, c.state(at(time.Minute), now))
+	require.Equal(t, poolsExpiring, c.state(at(8*time.Minute), now))
+	require.Equal(t, poolsExpiring, c.state(at(9*time.Minute), now))
+	require.Equal(t, poolsStale, c.state(at(10*time.Minute), now))
+
+	// no TTL, known pools never expire
+	c = PoolCacheConfig{}
+	require.Equal(t, poolsFresh, c.state(at(24*time.Hour), now))
+	require.Equal(t, poolsStale, c.state(nil, now))
+}
+
+func TestSubWriteRedeemed(t *testing.T) {
+	var wps = []*WritePool{
+		{PoolID: "late", Balance: 100, ExpireAt: 20},
+		{PoolID: "soon", Balance: 30, ExpireAt: 10},
+	}
+	SubWriteRedeemed(wps, 50)
+	require.Equal(t, "soon", wps[0].PoolID)
+	require.EqualValues(t, 0, wps[0].Balance)
+	require.EqualValues(t, 80, wps[1].Balance)
+
+	SubWriteRedeemed(wps, 1000)
+	require.EqualValues(t, 0, wps[1].Balance)
+}
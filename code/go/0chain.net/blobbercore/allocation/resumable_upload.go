@@ -0,0 +1,90 @@
+package allocation
+
+import (
+	"context"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// ResumableUpload keeps track of a resumable upload that has not received
+// its final chunk yet. The bytes themselves are kept in the temp file of the
+// connection, the row is used to answer upload status queries, to resume the
+// hash of the bytes on the next chunk and to clean the temp file up when the
+// connection expires.
+type ResumableUpload struct {
+	ConnectionID string `gorm:"column:connection_id;primary_key" json:"connection_id"`
+	AllocationID string `gorm:"column:allocation_id" json:"allocation_id"`
+	Path         string `gorm:"column:path;primary_key" json:"path"`
+	Filename     string `gorm:"column:filename" json:"filename"`
+	UploadLength int64  `gorm:"column:upload_length" json:"upload_length"`
+	UploadOffset int64  `gorm:"column:upload_offset" json:"upload_offset"`
+	// HashState is the sha1 state of the bytes before the UploadOffset
+	HashState []byte `gorm:"column:hash_state" json:"-"`
+	datastore.ModelWithTS
+}
+
+func (ResumableUpload) TableName() string {
+	return "resumable_uploads"
+}
+
+// Save inserts or updates the upload. Parts of a multipart upload can be
+// uploaded concurrently, so the upload is upserted.
+func (ru *ResumableUpload) Save(ctx context.Context) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "connection_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"upload_length", "upload_offset", "updated_at"}),
+	}).Create(ru).Error
+}
+
+func GetResumableUpload(ctx context.Context, connectionID, path string) (*ResumableUpload, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	ru := &ResumableUpload{}
+	err := db.Where(&ResumableUpload{
+		ConnectionID: connectionID,
+		Path:         path,
+	}).First(ru).Error
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// DeleteResumableUpload removes the tracking row once the final chunk is
+// received. The temp file is left as is, it belongs to the file change now.
+func DeleteResumableUpload(ctx context.Context, connectionID, path string) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Where(&ResumableUpload{
+		ConnectionID: connectionID,
+		Path:         path,
+	}).Delete(&ResumableUpload{}).Error
+}
+
+// DeleteResumableUploads removes temp files and tracking rows of all
+// unfinished resumable uploads of the connection.
+func DeleteResumableUploads(ctx context.Context, connectionID string) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var uploads []*ResumableUpload
+	err := db.Where(&ResumableUpload{ConnectionID: connectionID}).Find(&uploads).Error
+	if err != nil {
+		return err
+	}
+
+	for _, ru := range uploads {
+		fileInputData := &filestore.FileInputData{Name: ru.Filename, Path: ru.Path}
+		err := filestore.GetFileStore().DeleteTempFile(ru.AllocationID, fileInputData, ru.ConnectionID)
+		if err != nil {
+			logging.Logger.Error("ResumableUpload_DeleteTempFile",
+				zap.String("connection_id", ru.ConnectionID),
+				zap.String("path", ru.Path),
+				zap.Error(err))
+		}
+	}
+
+	return db.Where(&ResumableUpload{ConnectionID: connectionID}).Delete(&ResumableUpload{}).Error
+}
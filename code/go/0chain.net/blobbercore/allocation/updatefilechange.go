@@ -17,6 +17,10 @@ import (
 
 type UpdateFileChange struct {
 	NewFileChange
+
+	// IsPatch the content is a new version of the existing file patched on
+	// the blobber, meta data which is not sent with the patch is kept as is
+	IsPatch bool `json:"is_patch,omitempty"`
 }
 
 func (nf *UpdateFileChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
@@ -63,21 +67,32 @@ func (nf *UpdateFileChange) ProcessChange(ctx context.Context, change *Allocatio
 	existingRef := dirRef.Children[idx]
 	existingRef.ActualFileHash = nf.ActualHash
 	existingRef.ActualFileSize = nf.ActualSize
-	existingRef.MimeType = nf.MimeType
 	existingRef.ContentHash = nf.Hash
-	existingRef.CustomMeta = nf.CustomMeta
 	existingRef.MerkleRoot = nf.MerkleRoot
 	existingRef.WriteMarker = allocationRoot
 	existingRef.Size = nf.Size
-	existingRef.ThumbnailHash = nf.ThumbnailHash
-	existingRef.ThumbnailSize = nf.ThumbnailSize
-	existingRef.ActualThumbnailHash = nf.ActualThumbnailHash
-	existingRef.ActualThumbnailSize = nf.ActualThumbnailSize
-	existingRef.EncryptedKey = nf.EncryptedKey
-
-	if err = existingRef.SetAttributes(&nf.Attributes); err != nil {
-		return nil, common.NewErrorf("process_update_file_change",
-			"setting file attributes: %v", err)
+
+	if !nf.IsPatch || len(nf.MimeType) > 0 {
+		existingRef.MimeType = nf.MimeType
+	}
+	if !nf.IsPatch || len(nf.CustomMeta) > 0 {
+		existingRef.CustomMeta = nf.CustomMeta
+	}
+	if !nf.IsPatch || len(nf.EncryptedKey) > 0 {
+		existingRef.EncryptedKey = nf.EncryptedKey
+	}
+	if !nf.IsPatch || nf.ThumbnailSize > 0 {
+		existingRef.ThumbnailHash = nf.ThumbnailHash
+		existingRef.ThumbnailSize = nf.ThumbnailSize
+		existingRef.ActualThumbnailHash = nf.ActualThumbnailHash
+		existingRef.ActualThumbnailSize = nf.ActualThumbnailSize
+	}
+
+	if !nf.IsPatch || !nf.Attributes.IsZero() {
+		if err = existingRef.SetAttributes(&nf.Attributes); err != nil {
+			return nil, common.NewErrorf("process_update_file_change",
+				"setting file attributes: %v", err)
+		}
 	}
 
 	_, err = rootRef.CalculateHash(ctx, true)
@@ -6,10 +6,12 @@ import (
 	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/ledger"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
+	"github.com/0chain/blobber/code/go/0chain.net/core/node"
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 	"github.com/0chain/gosdk/zboxcore/zboxutil"
 
@@ -47,7 +49,12 @@ func UpdateWorker(ctx context.Context, interval time.Duration) {
 	for {
 		select {
 		case <-tick:
+			end, err := common.StartOperation("worker", "update_allocations")
+			if err != nil {
+				return
+			}
 			updateWork(ctx)
+			end()
 		case <-quit:
 			return
 		}
@@ -143,7 +150,7 @@ func updateAllocation(ctx context.Context, a *Allocation) {
 		return
 	}
 
-	var sa, err = requestAllocation(a.ID)
+	var sa, err = RequestAllocation(a.ID)
 	if err != nil {
 		Logger.Error("requesting allocations from SC", zap.Error(err))
 		return
@@ -170,7 +177,8 @@ func updateAllocation(ctx context.Context, a *Allocation) {
 
 }
 
-func requestAllocation(allocID string) (
+// RequestAllocation returns the allocation from the storage smart contract.
+func RequestAllocation(allocID string) (
 	sa *transaction.StorageAllocation, err error) {
 
 	var b []byte
@@ -204,6 +212,7 @@ func updateAllocationInDB(ctx context.Context, a *Allocation,
 	defer commit(tx, &err)
 
 	var changed bool = a.Tx != sa.Tx
+	var finalized = !a.Finalized && sa.Finalized
 
 	// transaction
 	a.Tx = sa.Tx
@@ -229,6 +238,12 @@ func updateAllocationInDB(ctx context.Context, a *Allocation,
 		return nil, err
 	}
 
+	if finalized {
+		if err = addMinLockDemandEntry(ctx, a, sa); err != nil {
+			return nil, err
+		}
+	}
+
 	if !changed {
 		return a, nil
 	}
@@ -243,6 +258,27 @@ func updateAllocationInDB(ctx context.Context, a *Allocation,
 	return a, nil // ok
 }
 
+// addMinLockDemandEntry adds the rest of the min lock demand, paid to the
+// blobber on finalization of the allocation, to the earnings ledger.
+func addMinLockDemandEntry(ctx context.Context, a *Allocation,
+	sa *transaction.StorageAllocation) error {
+
+	for _, d := range sa.BlobberDetails {
+		if d.BlobberID != node.Self.ID || d.MinLockDemand <= d.Spent {
+			continue
+		}
+		return ledger.Add(ctx, &ledger.Entry{
+			Kind:         ledger.MinLockDemand,
+			AllocationID: a.ID,
+			ClientID:     a.OwnerID,
+			PayerID:      a.OwnerID,
+			RefID:        a.ID,
+			Tokens:       d.MinLockDemand - d.Spent,
+		})
+	}
+	return nil
+}
+
 type finalizeRequest struct {
 	AllocationID string `json:"allocation_id"`
 }
@@ -308,8 +344,10 @@ func deleteInFakeConnection(ctx context.Context, a *Allocation) (err error) {
 		return
 	}
 
-	var mutex = lock.GetMutex(conn.TableName(), connID)
-	mutex.Lock()
+	var mutex = lock.GetLocker(conn.TableName(), connID)
+	if err = mutex.TryLock(ctx); err != nil {
+		return
+	}
 	defer mutex.Unlock()
 
 	// list files, delete files
@@ -2,6 +2,7 @@ package blobberhttp
 
 import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/readmarker"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
@@ -18,6 +19,25 @@ type UploadResult struct {
 	UploadLength int64 `json:"upload_length"`
 	//Upload-Offset indicates a byte offset within a resource. The value MUST be a non-negative integer.
 	UploadOffset int64 `json:"upload_offset"`
+	//PartNumber is the number of the stored part for the multipart upload
+	PartNumber int `json:"part_number,omitempty"`
+}
+
+type UploadStatusResult struct {
+	ConnectionID string `json:"connection_id"`
+	Filename     string `json:"filename"`
+	Path         string `json:"filepath"`
+	//Hash is sha1 of the bytes that have been already received
+	Hash string `json:"content_hash"`
+
+	//UploadLength indicates the size of the entire upload in bytes. The value MUST be a non-negative integer.
+	UploadLength int64 `json:"upload_length"`
+	//Upload-Offset indicates a byte offset within a resource. The value MUST be a non-negative integer.
+	UploadOffset int64 `json:"upload_offset"`
+	//Parts are the stored parts of the multipart upload
+	Parts []*filestore.FilePart `json:"parts,omitempty"`
+	//ExpiresAt is the time the upload is removed by the open connection cleaner if it is not resumed
+	ExpiresAt common.Timestamp `json:"expires_at"`
 }
 
 type CommitResult struct {
@@ -47,6 +67,13 @@ type ObjectPathResult struct {
 	LatestWM *writemarker.WriteMarker `json:"latest_write_marker"`
 }
 
+type SyncResult struct {
+	AllocationRoot string                   `json:"allocation_root"`
+	Path           string                   `json:"path"`
+	Changed        []map[string]interface{} `json:"changed"`
+	Deleted        []string                 `json:"deleted"`
+}
+
 type ListResult struct {
 	AllocationRoot string                   `json:"allocation_root"`
 	Meta           map[string]interface{}   `json:"meta_data"`
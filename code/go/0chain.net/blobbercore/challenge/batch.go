@@ -0,0 +1,286 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
+	"github.com/0chain/blobber/code/go/0chain.net/core/util"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+const VALIDATOR_BATCH_URL = "/v1/storage/challenge/batch"
+
+// maxBatchSize is the max number of challenges validated in a batch.
+const maxBatchSize = 10
+
+// noBatchTTL is the time the challenges are requested one by one from a
+// validator not supporting the batches, before a batch is tried again.
+const noBatchTTL = time.Hour
+
+// BatchTicket is the ticket of a challenge of a batch, or the error of the
+// validator verifying it.
+type BatchTicket struct {
+	ChallengeID string            `json:"challenge_id"`
+	Ticket      *ValidationTicket `json:"ticket,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// noBatch are the validators not supporting the batches by the time they
+// failed a batch, they are requested one challenge at a time until the
+// noBatchTTL passes.
+var noBatch sync.Map
+
+// errNoBatch is the error of a validator not supporting the batches.
+var errNoBatch = common.NewError("batch_not_supported", "The validator doesn't validate batches")
+
+func isNoBatch(validatorID string) bool {
+	since, ok := noBatch.Load(validatorID)
+	if !ok {
+		return false
+	}
+	if time.Since(since.(time.Time)) >= noBatchTTL {
+		noBatch.Delete(validatorID)
+		return false
+	}
+	return true
+}
+
+// batchItem is a challenge validated in a batch.
+type batchItem struct {
+	cr    *ChallengeEntity
+	data  []byte
+	tally *tally
+	err   error
+}
+
+// validatorBatch is the challenges a validator is requested to validate, with
+// the index of the validator in each of them.
+type validatorBatch struct {
+	validator ValidationNode
+	items     []*batchItem
+	indexes   []int
+}
+
+// requestBatch requests the tickets of the validation requests from the
+// validator in one request, the tickets are in the order of the requests.
+func requestBatch(ctx context.Context, v ValidationNode, requests [][]byte) (
+	[]*BatchTicket, error) {
+
+	raw := make([]json.RawMessage, 0, len(requests))
+	for _, data := range requests {
+		raw = append(raw, data)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postBatch(ctx, v.URL+VALIDATOR_BATCH_URL, data)
+	if err != nil {
+		return nil, err
+	}
+	var tickets []*BatchTicket
+	if err = json.Unmarshal(resp, &tickets); err != nil {
+		return nil, err
+	}
+	if len(tickets) != len(requests) {
+		return nil, common.NewErrorf("invalid_batch", "Got %d tickets for %d requests", len(tickets), len(requests))
+	}
+	return tickets, nil
+}
+
+// postBatch posts the batch once, the challenges not validated are retried
+// with the next batch. It returns the errNoBatch if the validator doesn't
+// have the batch endpoint.
+func postBatch(ctx context.Context, url string, data []byte) ([]byte, error) {
+	req, _, cncl, err := util.NewHTTPRequest(http.MethodPost, url, data)
+	if err != nil {
+		return nil, err
+	}
+	defer cncl()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return nil, errNoBatch
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, common.NewError("http_error", "Error from HTTP call. "+string(body))
+	}
+	return body, nil
+}
+
+// batchTicket checks the ticket of the challenge in the batch response.
+func batchTicket(cr *ChallengeEntity, bt *BatchTicket) (*ValidationTicket, error) {
+	if bt.Error != "" {
+		return nil, common.NewError("validation_error", bt.Error)
+	}
+	if bt.Ticket == nil || bt.Ticket.ChallengeID != cr.ChallengeID {
+		return nil, common.NewError("invalid_ticket", "Validation ticket of another challenge")
+	}
+	if err := verifyTicket(bt.Ticket); err != nil {
+		return nil, err
+	}
+	return bt.Ticket, nil
+}
+
+// collectBatchTickets requests the missing tickets of the challenges with one
+// request per validator, the validators concurrently and each limited by the
+// validator timeout.
+func collectBatchTickets(ctx context.Context, items []*batchItem) {
+	var (
+		batches []*validatorBatch
+		index   = make(map[string]*validatorBatch)
+	)
+	for _, it := range items {
+		var missing []int
+		it.tally, missing = it.cr.cachedTickets()
+		if it.tally.quorum() {
+			continue
+		}
+		for _, i := range missing {
+			v := it.cr.Validators[i]
+			b, ok := index[v.ID]
+			if !ok {
+				b = &validatorBatch{validator: v}
+				index[v.ID] = b
+				batches = append(batches, b)
+			}
+			b.items = append(b.items, it)
+			b.indexes = append(b.indexes, i)
+		}
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // tickets of a challenge come from all its validators
+	)
+	set := func(it *batchItem, i int, vt *ValidationTicket) {
+		mu.Lock()
+		defer mu.Unlock()
+		it.cr.ValidationTickets[i] = vt
+		it.tally.add(vt)
+	}
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b *validatorBatch) {
+			defer wg.Done()
+			if isNoBatch(b.validator.ID) || len(b.items) == 1 {
+				requestEach(ctx, b, set)
+				return
+			}
+
+			requests := make([][]byte, 0, len(b.items))
+			for _, it := range b.items {
+				requests = append(requests, it.data)
+			}
+			vctx, cancel := validatorContext(ctx)
+			defer cancel()
+			start := time.Now()
+			tickets, err := requestBatch(vctx, b.validator, requests)
+			latency := time.Since(start)
+			if err == errNoBatch {
+				Logger.Info("Validator doesn't validate batches, requesting the challenges one by one",
+					zap.String("validator", b.validator.ID))
+				noBatch.Store(b.validator.ID, time.Now())
+				requestEach(ctx, b, set)
+				return
+			}
+			if err != nil {
+				Logger.Info("Validator failed the batch", zap.String("validator", b.validator.ID), zap.Error(err))
+				addValidatorStat(b.validator, latency, nil, err)
+				return
+			}
+			latency /= time.Duration(len(tickets))
+			for k, bt := range tickets {
+				it := b.items[k]
+				vt, err := batchTicket(it.cr, bt)
+				addValidatorStat(b.validator, latency, vt, err)
+				if err != nil {
+					Logger.Info("Got error from the validator.", zap.String("validator", b.validator.ID),
+						zap.String("challenge_id", it.cr.ChallengeID), zap.Error(err))
+					continue
+				}
+				set(it, b.indexes[k], vt)
+			}
+		}(b)
+	}
+	wg.Wait()
+}
+
+// requestEach requests the tickets of the batch from the validator one
+// challenge at a time.
+func requestEach(ctx context.Context, b *validatorBatch,
+	set func(it *batchItem, i int, vt *ValidationTicket)) {
+
+	for k, it := range b.items {
+		vctx, cancel := validatorContext(ctx)
+		start := time.Now()
+		vt, err := requestTicket(vctx, b.validator, it.data)
+		cancel()
+		addValidatorStat(b.validator, time.Since(start), vt, err)
+		if err != nil {
+			Logger.Info("Got error from the validator.", zap.String("validator", b.validator.ID), zap.Error(err))
+			continue
+		}
+		set(it, b.indexes[k], vt)
+	}
+}
+
+// validateBatch gets the validation tickets of the challenges of an
+// allocation, requesting each validator once for all the challenges it
+// validates.
+func validateBatch(ctx context.Context, crs []*ChallengeEntity) {
+	// other holders of the challenge locks hold one at a time
+	locked := append([]*ChallengeEntity(nil), crs...)
+	sort.Slice(locked, func(i, j int) bool {
+		return locked[i].ChallengeID < locked[j].ChallengeID
+	})
+	for _, cr := range locked {
+		mutex := lock.GetLocker(cr.TableName(), cr.ChallengeID)
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+
+	// the validators are requested without a DB transaction open
+	items := make([]*batchItem, 0, len(crs))
+	for _, cr := range crs {
+		Logger.Info("Processing the challenge", zap.String("challenge_id", cr.ChallengeID),
+			zap.Int64("deadline", int64(cr.Deadline())), zap.Int("attempts", cr.Attempts))
+		it := &batchItem{cr: cr}
+		tctx := datastore.GetStore().CreateTransaction(ctx)
+		it.data, it.err = cr.prepareValidation(tctx)
+		if it.err != nil {
+			finishValidation(datastore.GetStore().GetTransaction(tctx), cr, it.err)
+			continue
+		}
+		if err := datastore.GetStore().GetTransaction(tctx).Commit().Error; err != nil {
+			Logger.Error("Error committing the challenge validation", zap.Error(err))
+		}
+		items = append(items, it)
+	}
+
+	collectBatchTickets(ctx, items)
+
+	for _, it := range items {
+		tctx := datastore.GetStore().CreateTransaction(ctx)
+		err := it.cr.resolveTickets(tctx, it.tally)
+		finishValidation(datastore.GetStore().GetTransaction(tctx), it.cr, err)
+	}
+}
@@ -0,0 +1,97 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRequestBatch(t *testing.T) {
+	logging.Logger = zap.NewNop()
+
+	var got []json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, VALIDATOR_BATCH_URL, r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_ = json.NewEncoder(w).Encode([]*BatchTicket{
+			{ChallengeID: "c1", Error: "Challenge could not be verified"},
+		})
+	}))
+	defer srv.Close()
+
+	v := ValidationNode{ID: "v1", URL: srv.URL}
+	tickets, err := requestBatch(context.Background(), v, [][]byte{[]byte(`{"challenge_id":"c1"}`)})
+	require.NoError(t, err)
+	require.Len(t, tickets, 1)
+	require.Equal(t, `{"challenge_id":"c1"}`, string(got[0]))
+
+	// a ticket for each request is expected
+	_, err = requestBatch(context.Background(), v, [][]byte{[]byte(`{}`), []byte(`{}`)})
+	require.Error(t, err)
+}
+
+func TestBatchTicket(t *testing.T) {
+	cr := &ChallengeEntity{ChallengeID: "c1"}
+
+	_, err := batchTicket(cr, &BatchTicket{ChallengeID: "c1", Error: "failed"})
+	require.Error(t, err)
+
+	_, err = batchTicket(cr, &BatchTicket{ChallengeID: "c2", Ticket: &ValidationTicket{ChallengeID: "c2"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "another challenge")
+}
+
+func TestCollectBatchTicketsCached(t *testing.T) {
+	cr := &ChallengeEntity{
+		ChallengeID: "c1",
+		Validators:  []ValidationNode{{ID: "v1"}, {ID: "v2"}},
+	}
+	cr.ValidationTickets = []*ValidationTicket{
+		{ChallengeID: "c1", Result: true, Signature: "s1"},
+		{ChallengeID: "c1", Result: true, Signature: "s2"},
+	}
+	// no validator is requested for the challenges having the quorum
+	it := &batchItem{cr: cr}
+	collectBatchTickets(context.Background(), []*batchItem{it})
+	require.True(t, it.tally.quorum())
+	require.Equal(t, 2, it.tally.success)
+}
+
+func TestRequestBatchNotSupported(t *testing.T) {
+	logging.Logger = zap.NewNop()
+
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	v := ValidationNode{ID: "v1", URL: srv.URL}
+	_, err := requestBatch(context.Background(), v, [][]byte{[]byte(`{}`)})
+	require.Equal(t, errNoBatch, err)
+
+	// a failure of the validator doesn't disable the batches
+	status = http.StatusInternalServerError
+	_, err = requestBatch(context.Background(), v, [][]byte{[]byte(`{}`)})
+	require.Error(t, err)
+	require.NotEqual(t, errNoBatch, err)
+}
+
+func TestIsNoBatch(t *testing.T) {
+	defer noBatch.Delete("v1")
+
+	require.False(t, isNoBatch("v1"))
+	noBatch.Store("v1", time.Now())
+	require.True(t, isNoBatch("v1"))
+
+	// batches are tried again once expired
+	noBatch.Store("v1", time.Now().Add(-noBatchTTL))
+	require.False(t, isNoBatch("v1"))
+}
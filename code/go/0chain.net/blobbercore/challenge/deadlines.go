@@ -0,0 +1,43 @@
+package challenge
+
+import (
+	"context"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/stats"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+)
+
+func init() {
+	stats.SetChallengeDeadlinesLoader(loadDeadlines)
+}
+
+// loadDeadlines returns the deadlines of the challenges not committed nor
+// expired yet, the oldest first.
+func loadDeadlines(ctx context.Context) ([]*stats.ChallengeDeadline, error) {
+	var crs []*ChallengeEntity
+	err := datastore.GetStore().GetTransaction(ctx).
+		Select("challenge_id, allocation_id, status, attempts, created, completion_time").
+		Where("status NOT IN (?, ?)", Committed, Expired).
+		Order("created, challenge_id").
+		Find(&crs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := common.Now()
+	cds := make([]*stats.ChallengeDeadline, 0, len(crs))
+	for _, cr := range crs {
+		deadline := cr.Deadline()
+		cds = append(cds, &stats.ChallengeDeadline{
+			ChallengeID:    cr.ChallengeID,
+			AllocationID:   cr.AllocationID,
+			Status:         int(cr.Status),
+			Attempts:       cr.Attempts,
+			Created:        cr.Created,
+			Deadline:       deadline,
+			TimeToDeadline: stats.Duration(deadline - now),
+		})
+	}
+	return cds, nil
+}
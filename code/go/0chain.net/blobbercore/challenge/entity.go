@@ -22,6 +22,8 @@ const (
 	Accepted ChallengeStatus = iota + 1
 	Processed
 	Committed
+	// Expired challenges passed the deadline without a committed response
+	Expired
 )
 
 const (
@@ -75,7 +77,11 @@ type ChallengeEntity struct {
 	ValidationTickets       []*ValidationTicket   `json:"validation_tickets" gorm:"-"`
 	ObjectPathString        datatypes.JSON        `json:"-" gorm:"column:object_path"`
 	ObjectPath              *reference.ObjectPath `json:"object_path" gorm:"-"`
-	Created                 common.Timestamp      `json:"created" gorm:"-"`
+	Created                 common.Timestamp      `json:"created" gorm:"column:created"`
+	// CompletionTime is the challenge completion time, in seconds, when the
+	// challenge was received.
+	CompletionTime int64 `json:"completion_time" gorm:"column:completion_time"`
+	Attempts       int   `json:"attempts" gorm:"column:attempts"`
 }
 
 func (ChallengeEntity) TableName() string {
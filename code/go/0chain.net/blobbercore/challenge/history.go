@@ -0,0 +1,269 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/stats"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// UnknownReason is the failure reason of failed challenges having no message
+// code in the failed validation tickets.
+const UnknownReason = "unknown"
+
+var statusNames = map[string]ChallengeStatus{
+	"accepted":  Accepted,
+	"processed": Processed,
+	"committed": Committed,
+	"expired":   Expired,
+}
+
+var resultNames = map[string]ChallengeResult{
+	"unknown": ChallengeUnknown,
+	"success": ChallengeSuccess,
+	"failure": ChallengeFailure,
+}
+
+// ParseStatus parses the status name or number of a challenge.
+func ParseStatus(v string) (ChallengeStatus, error) {
+	if s, ok := statusNames[v]; ok {
+		return s, nil
+	}
+	if i, err := strconv.Atoi(v); err == nil && i >= int(Accepted) && i <= int(Expired) {
+		return ChallengeStatus(i), nil
+	}
+	return 0, common.NewErrorf("invalid_status", "invalid challenge status %q, expected accepted, processed, committed or expired", v)
+}
+
+// ParseResult parses the result name or number of a challenge.
+func ParseResult(v string) (ChallengeResult, error) {
+	if r, ok := resultNames[v]; ok {
+		return r, nil
+	}
+	if i, err := strconv.Atoi(v); err == nil && i >= int(ChallengeUnknown) && i <= int(ChallengeFailure) {
+		return ChallengeResult(i), nil
+	}
+	return 0, common.NewErrorf("invalid_result", "invalid challenge result %q, expected unknown, success or failure", v)
+}
+
+// Filter selects challenges, the empty fields are not applied. The time range
+// is of the creation time given by the chain, the 'To' time is exclusive.
+type Filter struct {
+	AllocationID string
+	RefID        int64
+	Status       *ChallengeStatus
+	Result       *ChallengeResult
+	From, To     time.Time
+}
+
+func (f *Filter) apply(ctx context.Context) *gorm.DB {
+	db := datastore.GetStore().GetTransaction(ctx).Model(&ChallengeEntity{})
+	if f.AllocationID != "" {
+		db = db.Where("allocation_id = ?", f.AllocationID)
+	}
+	if f.RefID != 0 {
+		db = db.Where("ref_id = ?", f.RefID)
+	}
+	if f.Status != nil {
+		db = db.Where("status = ?", *f.Status)
+	}
+	if f.Result != nil {
+		db = db.Where("result = ?", *f.Result)
+	}
+	if !f.From.IsZero() {
+		db = db.Where("created >= ?", f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		db = db.Where("created < ?", f.To.Unix())
+	}
+	return db
+}
+
+// Find returns the challenges, the latest first.
+func Find(ctx context.Context, f *Filter, offset, limit int) ([]*ChallengeEntity, error) {
+	crs := make([]*ChallengeEntity, 0)
+	db := f.apply(ctx).Order("created desc, sequence desc").Offset(offset)
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if err := db.Find(&crs).Error; err != nil {
+		return nil, err
+	}
+	for _, cr := range crs {
+		if err := cr.UnmarshalFields(); err != nil {
+			return nil, err
+		}
+	}
+	return crs, nil
+}
+
+// DayTotal is the number of challenges created on a day (UTC).
+type DayTotal struct {
+	Day        string `json:"day"`
+	Challenges int64  `json:"challenges"`
+	Successes  int64  `json:"successes"`
+	Failures   int64  `json:"failures"`
+	Committed  int64  `json:"committed"`
+	Pending    int64  `json:"pending"`
+}
+
+type dayRow struct {
+	Day        int64 `gorm:"column:day"`
+	Challenges int64 `gorm:"column:challenges"`
+	Successes  int64 `gorm:"column:successes"`
+	Failures   int64 `gorm:"column:failures"`
+	Committed  int64 `gorm:"column:committed"`
+}
+
+// SummarizeByDay returns the totals of the challenges per day of creation.
+func SummarizeByDay(ctx context.Context, f *Filter) ([]*DayTotal, error) {
+	var rows []*dayRow
+	err := f.apply(ctx).
+		Select("created / ? AS day, COUNT(*) AS challenges, "+
+			"SUM(CASE WHEN result = ? THEN 1 ELSE 0 END) AS successes, "+
+			"SUM(CASE WHEN result = ? THEN 1 ELSE 0 END) AS failures, "+
+			"SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS committed",
+			secondsPerDay, ChallengeSuccess, ChallengeFailure, Committed).
+		Group("day").
+		Order("day").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make([]*DayTotal, 0, len(rows))
+	for _, r := range rows {
+		totals = append(totals, &DayTotal{
+			Day:        time.Unix(r.Day*secondsPerDay, 0).UTC().Format("2006-01-02"),
+			Challenges: r.Challenges,
+			Successes:  r.Successes,
+			Failures:   r.Failures,
+			Committed:  r.Committed,
+			Pending:    r.Challenges - r.Committed,
+		})
+	}
+	return totals, nil
+}
+
+// ReasonTotal is the number of failed challenges of a failure reason.
+type ReasonTotal struct {
+	Reason     string `json:"reason"`
+	Challenges int64  `json:"challenges"`
+}
+
+// failureReasons returns the distinct message codes of the failed tickets.
+func failureReasons(vts []*ValidationTicket) []string {
+	var (
+		reasons []string
+		seen    = make(map[string]bool)
+	)
+	for _, vt := range vts {
+		if vt == nil || vt.Result || vt.MessageCode == "" || seen[vt.MessageCode] {
+			continue
+		}
+		seen[vt.MessageCode] = true
+		reasons = append(reasons, vt.MessageCode)
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, UnknownReason)
+	}
+	return reasons
+}
+
+// SummarizeByReason returns the numbers of the failed challenges per message
+// code of the failed validation tickets, the most frequent first. A challenge
+// failed for different reasons by the validators counts for each of them.
+func SummarizeByReason(ctx context.Context, f *Filter) ([]*ReasonTotal, error) {
+	failed := *f
+	result := ChallengeFailure
+	failed.Result = &result
+
+	rows, err := failed.apply(ctx).Select("validation_tickets").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var (
+			raw datatypes.JSON
+			vts []*ValidationTicket
+		)
+		if err = rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err = unMarshalField(raw, &vts); err != nil {
+			return nil, err
+		}
+		for _, reason := range failureReasons(vts) {
+			counts[reason]++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	totals := make([]*ReasonTotal, 0, len(counts))
+	for reason, n := range counts {
+		totals = append(totals, &ReasonTotal{Reason: reason, Challenges: n})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Challenges != totals[j].Challenges {
+			return totals[i].Challenges > totals[j].Challenges
+		}
+		return totals[i].Reason < totals[j].Reason
+	})
+	return totals, nil
+}
+
+// FileHistory is the challenge history of a file.
+type FileHistory struct {
+	AllocationID          string             `json:"allocation_id"`
+	Path                  string             `json:"path"`
+	NumOfChallenges       int64              `json:"num_of_challenges"`
+	NumOfFailedChallenges int64              `json:"num_of_failed_challenges"`
+	LastChallengeTxn      string             `json:"last_challenge_txn"`
+	Challenges            []*ChallengeEntity `json:"challenges"`
+}
+
+// GetFileHistory returns the challenges of the file, the latest first, along
+// with its challenge counts of the file stats.
+func GetFileHistory(ctx context.Context, allocationID, path string,
+	offset, limit int) (*FileHistory, error) {
+
+	ref, err := reference.GetReference(ctx, allocationID, path)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Type != reference.FILE {
+		return nil, common.NewError("invalid_path", "Path is not a file")
+	}
+
+	fh := &FileHistory{AllocationID: allocationID, Path: ref.Path}
+	fs, err := stats.GetFileStats(ctx, ref.ID)
+	switch {
+	case err == nil:
+		fh.NumOfChallenges = fs.SuccessChallenges
+		fh.NumOfFailedChallenges = fs.FailedChallenges
+		fh.LastChallengeTxn = fs.LastChallengeResponseTxn
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	fh.Challenges, err = Find(ctx, &Filter{AllocationID: allocationID, RefID: ref.ID}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
@@ -0,0 +1,43 @@
+package challenge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusAndResult(t *testing.T) {
+	status, err := ParseStatus("processed")
+	require.NoError(t, err)
+	require.Equal(t, Processed, status)
+	status, err = ParseStatus("3")
+	require.NoError(t, err)
+	require.Equal(t, Committed, status)
+	status, err = ParseStatus("expired")
+	require.NoError(t, err)
+	require.Equal(t, Expired, status)
+	_, err = ParseStatus("0")
+	require.Error(t, err)
+
+	result, err := ParseResult("failure")
+	require.NoError(t, err)
+	require.Equal(t, ChallengeFailure, result)
+	result, err = ParseResult("0")
+	require.NoError(t, err)
+	require.Equal(t, ChallengeUnknown, result)
+	_, err = ParseResult("lost")
+	require.Error(t, err)
+}
+
+func TestFailureReasons(t *testing.T) {
+	vts := []*ValidationTicket{
+		{Result: true, MessageCode: "success"},
+		{Result: false, MessageCode: "invalid_data"},
+		nil,
+		{Result: false, MessageCode: "invalid_data"},
+		{Result: false, MessageCode: "invalid_write_marker"},
+		{Result: false},
+	}
+	require.Equal(t, []string{"invalid_data", "invalid_write_marker"}, failureReasons(vts))
+	require.Equal(t, []string{UnknownReason}, failureReasons(vts[:1]))
+}
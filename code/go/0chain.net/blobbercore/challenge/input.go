@@ -0,0 +1,126 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/util"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// challengeInput is the data the validators verify a challenge with: the
+// object path of the challenged block, the write markers from the challenged
+// allocation root to the latest one and the block with its merkle path.
+type challengeInput struct {
+	BlockNum     int64
+	BlockOffset  int
+	ObjectPath   *reference.ObjectPath
+	WriteMarkers []*writemarker.WriteMarkerEntity
+	Data         []byte
+	MerklePath   *util.MTPath
+}
+
+// challengedBlock returns the block number the seed challenges, zero for
+// an empty allocation.
+func challengedBlock(seed, numBlocks int64) int64 {
+	if numBlocks <= 0 {
+		return 0
+	}
+	r := rand.New(rand.NewSource(seed))
+	return r.Int63n(numBlocks) + 1
+}
+
+// challengedOffset returns the offset of the challenged 64 KB block within
+// the merkle tree of the file.
+func challengedOffset(seed int64) int {
+	r := rand.New(rand.NewSource(seed))
+	return r.Intn(1024)
+}
+
+// loadChallengeInput loads the challenge input from the local data. The block
+// number is derived from the seed unless given.
+func loadChallengeInput(ctx context.Context, allocationID, challengedRoot,
+	latestRoot string, seed, blockNum int64) (*challengeInput, error) {
+
+	wms, err := writemarker.GetWriteMarkersInRange(ctx, allocationID, challengedRoot, latestRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(wms) == 0 {
+		return nil, common.NewError("write_marker_not_found", "Could find the writemarker for the given allocation root on challenge")
+	}
+
+	rootRef, err := reference.GetReference(ctx, allocationID, "/")
+	if err != nil {
+		return nil, err
+	}
+	if blockNum <= 0 {
+		blockNum = challengedBlock(seed, rootRef.NumBlocks)
+	}
+	if blockNum == 0 {
+		Logger.Error("Got a challenge for a blank allocation")
+	}
+	if blockNum > rootRef.NumBlocks {
+		return nil, common.NewErrorf("invalid_block_num", "Invalid block number %d/%d", blockNum, rootRef.NumBlocks)
+	}
+	Logger.Info("blockNum for challenge", zap.Any("rootRef.NumBlocks", rootRef.NumBlocks), zap.Any("blockNum", blockNum), zap.Any("random_seed", seed))
+
+	objectPath, err := reference.GetObjectPath(ctx, allocationID, blockNum)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &challengeInput{
+		BlockNum:     blockNum,
+		ObjectPath:   objectPath,
+		WriteMarkers: wms,
+	}
+	if blockNum == 0 {
+		return in, nil
+	}
+
+	if objectPath.Meta["type"] != reference.FILE {
+		Logger.Info("Block number to be challenged for file:", zap.Any("block", objectPath.FileBlockNum), zap.Any("meta", objectPath.Meta), zap.Any("obejct_path", objectPath))
+		return nil, common.NewError("invalid_object_path", "Object path was not for a file")
+	}
+
+	inputData := &filestore.FileInputData{}
+	inputData.Name = objectPath.Meta["name"].(string)
+	inputData.Path = objectPath.Meta["path"].(string)
+	inputData.Hash = objectPath.Meta["content_hash"].(string)
+	in.BlockOffset = challengedOffset(seed)
+	blockData, mt, err := filestore.GetFileStore().GetFileBlockForChallenge(allocationID, inputData, in.BlockOffset)
+	if err != nil {
+		return nil, common.NewError("blockdata_not_found", err.Error())
+	}
+	in.Data = []byte(blockData)
+	in.MerklePath = mt.GetPathByIndex(in.BlockOffset)
+	return in, nil
+}
+
+// postData encodes the validation request of the challenge.
+func (in *challengeInput) postData(challengeID string) ([]byte, error) {
+	postData := make(map[string]interface{})
+	postData["challenge_id"] = challengeID
+	postData["object_path"] = in.ObjectPath
+	markersArray := make([]map[string]interface{}, 0)
+	for _, wm := range in.WriteMarkers {
+		markersMap := make(map[string]interface{})
+		markersMap["write_marker"] = wm.WM
+		markersMap["client_key"] = wm.ClientPublicKey
+		markersArray = append(markersArray, markersMap)
+	}
+	postData["write_markers"] = markersArray
+	if in.BlockNum > 0 {
+		postData["data"] = in.Data
+		postData["merkle_path"] = in.MerklePath
+	}
+	return json.Marshal(postData)
+}
@@ -0,0 +1,68 @@
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
+	"github.com/0chain/blobber/code/go/0chain.net/core/util"
+	vstorage "github.com/0chain/blobber/code/go/0chain.net/validatorcore/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengedBlock(t *testing.T) {
+	require.EqualValues(t, 0, challengedBlock(42, 0))
+	for seed := int64(0); seed < 100; seed++ {
+		b := challengedBlock(seed, 10)
+		require.True(t, b >= 1 && b <= 10)
+		require.Equal(t, b, challengedBlock(seed, 10))
+	}
+	require.Equal(t, challengedOffset(7), challengedOffset(7))
+}
+
+func TestChallengeInputPostData(t *testing.T) {
+	in := &challengeInput{
+		BlockNum:   3,
+		ObjectPath: &reference.ObjectPath{RootHash: "root", FileBlockNum: 1},
+		WriteMarkers: []*writemarker.WriteMarkerEntity{{
+			WM:              writemarker.WriteMarker{AllocationRoot: "ar", AllocationID: "a"},
+			ClientPublicKey: "key",
+		}},
+		Data:       []byte("block"),
+		MerklePath: &util.MTPath{LeafIndex: 5},
+	}
+	data, err := in.postData("c1")
+	require.NoError(t, err)
+
+	// the validators decode it so
+	var req vstorage.ChallengeRequest
+	require.NoError(t, json.Unmarshal(data, &req))
+	require.Equal(t, "c1", req.ChallengeID)
+	require.Equal(t, "root", req.ObjPath.RootHash)
+	require.Len(t, req.WriteMarkers, 1)
+	require.Equal(t, "ar", req.WriteMarkers[0].WM.AllocationRoot)
+	require.Equal(t, "key", req.WriteMarkers[0].ClientPublicKey)
+	require.Equal(t, []byte("block"), req.DataBlock)
+	require.Equal(t, 5, req.MerklePath.LeafIndex)
+
+	// no data block for an empty allocation
+	in.BlockNum = 0
+	data, err = in.postData("c1")
+	require.NoError(t, err)
+	req = vstorage.ChallengeRequest{}
+	require.NoError(t, json.Unmarshal(data, &req))
+	require.Nil(t, req.DataBlock)
+	require.Nil(t, req.MerklePath)
+}
+
+func TestSelfAuditReport(t *testing.T) {
+	r := &SelfAuditReport{Passed: true}
+	require.True(t, r.check("a", nil))
+	r.skip("b", "skipped")
+	require.True(t, r.Passed)
+	require.False(t, r.check("c", errors.New("failed")))
+	require.False(t, r.Passed)
+	require.Len(t, r.Checks, 3)
+}
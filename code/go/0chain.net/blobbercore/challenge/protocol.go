@@ -2,21 +2,20 @@ package challenge
 
 import (
 	"context"
-	"encoding/json"
-	"math/rand"
-	"time"
+	"errors"
+	"strings"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
-	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
-	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
-	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/ledger"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/0chain/blobber/code/go/0chain.net/core/node"
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
-	"github.com/0chain/blobber/code/go/0chain.net/core/util"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 const VALIDATOR_URL = "/v1/storage/challenge/new"
@@ -26,38 +25,114 @@ type ChallengeResponse struct {
 	ValidationTickets []*ValidationTicket `json:"validation_tickets"`
 }
 
-func (cr *ChallengeEntity) SubmitChallengeToBC(ctx context.Context) (*transaction.Transaction, error) {
-
-	txn, err := transaction.NewTransactionEntity()
-	if err != nil {
-		return nil, err
-	}
+// challengeResponseLane keeps the challenge responses of an allocation in the
+// order they are scheduled, by the deadlines of the challenges. A response
+// retried holds back only the later ones of its allocation.
+func challengeResponseLane(allocationID string) string {
+	return transaction.CHALLENGE_RESPONSE + ":" + allocationID
+}
 
+// SubmitChallengeToBC queues the challenge response transaction. The challenge
+// is committed on confirmation, see onChallengeCommitted.
+func (cr *ChallengeEntity) SubmitChallengeToBC(ctx context.Context) error {
 	sn := &ChallengeResponse{}
 	sn.ChallengeID = cr.ChallengeID
 	sn.ValidationTickets = cr.ValidationTickets
 
-	snBytes, err := json.Marshal(sn)
+	_, err := txnmanager.Enqueue(ctx, &txnmanager.Request{
+		Kind:  transaction.CHALLENGE_RESPONSE,
+		RefID: cr.ChallengeID,
+		Lane:  challengeResponseLane(cr.AllocationID),
+		Name:  transaction.CHALLENGE_RESPONSE,
+		Input: sn,
+	})
 	if err != nil {
-		return nil, err
+		Logger.Info("Failed queueing challenge response", zap.String("err:", err.Error()))
+		return err
 	}
+	Logger.Info("Queued challenge response", zap.String("challenge_id", cr.ChallengeID))
+	return nil
+}
+
+// onChallengeCommitted commits the challenge when its response transaction
+// is confirmed, or records the error.
+func onChallengeCommitted(ctx context.Context, txn *txnmanager.Txn,
+	t *transaction.Transaction, txnErr error) error {
 
-	err = txn.ExecuteSmartContract(transaction.STORAGE_CONTRACT_ADDRESS, transaction.CHALLENGE_RESPONSE, string(snBytes), 0)
+	cr, err := GetChallengeEntity(ctx, txn.RefID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
 	if err != nil {
-		Logger.Info("Failed submitting challenge to the mining network", zap.String("err:", err.Error()))
-		return nil, err
+		return err
+	}
+	if err = cr.UnmarshalFields(); err != nil {
+		return err
 	}
 
-	Logger.Info("Verifying challenge response to blockchain.", zap.String("txn", txn.Hash), zap.String("challenge_id", cr.ChallengeID))
-	time.Sleep(transaction.SLEEP_FOR_TXN_CONFIRMATION * time.Second)
+	if txnErr != nil {
+		for _, hash := range append([]string{txn.Hash}, strings.Split(txn.PrevHashes, ",")...) {
+			if hash != "" {
+				cr.LastCommitTxnIDs = append(cr.LastCommitTxnIDs, hash)
+			}
+		}
+		cr.StatusMessage = txnErr.Error()
+		Logger.Error("Error while submitting challenge to BC.", zap.String("challenge_id", cr.ChallengeID), zap.Error(txnErr))
+		return cr.Save(ctx)
+	}
 
-	t, err := transaction.VerifyTransaction(txn.Hash, chain.GetServerChain())
-	if err != nil {
-		Logger.Error("Error verifying the challenge response transaction", zap.String("err:", err.Error()), zap.String("txn", txn.Hash), zap.String("challenge_id", cr.ChallengeID))
-		return txn, err
+	cr.Status = Committed
+	cr.StatusMessage = t.TransactionOutput
+	cr.CommitTxnID = t.Hash
+	cr.LastCommitTxnIDs = append(cr.LastCommitTxnIDs, t.Hash)
+	if err = cr.Save(ctx); err != nil {
+		return err
+	}
+	FileChallenged(ctx, cr.RefID, cr.Result, cr.CommitTxnID)
+	if err = cr.addLedgerEntry(ctx, t); err != nil {
+		return err
 	}
 	Logger.Info("Challenge committed and accepted", zap.Any("txn.hash", t.Hash), zap.Any("txn.output", t.TransactionOutput), zap.String("challenge_id", cr.ChallengeID))
-	return t, nil
+	return nil
+}
+
+// addLedgerEntry records the outcome of the committed challenge in the
+// earnings ledger. The output of the transaction doesn't report the reward or
+// the penalty, they are the totals of the blobber allocation of the storage
+// smart contract, paid from its challenge pool, since the previous entry.
+func (cr *ChallengeEntity) addLedgerEntry(ctx context.Context, t *transaction.Transaction) error {
+	sa, err := allocation.RequestAllocation(cr.AllocationID)
+	if err != nil {
+		return common.NewErrorf("challenge_ledger",
+			"can't get allocation from the smart contract: %v", err)
+	}
+	var details *transaction.BlobberAllocation
+	for _, d := range sa.BlobberDetails {
+		if d.BlobberID == node.Self.ID {
+			details = d
+		}
+	}
+	if details == nil {
+		return common.NewError("challenge_ledger", "the blobber is not of the allocation")
+	}
+
+	kind, total := ledger.ChallengeReward, details.ChallengeReward
+	if cr.Result != ChallengeSuccess {
+		kind, total = ledger.ChallengePenalty, details.Penalty
+	}
+	tokens, err := ledger.Unrecorded(ctx, kind, cr.AllocationID, total)
+	if err != nil {
+		return common.NewErrorf("challenge_ledger",
+			"can't get the recorded tokens from DB: %v", err)
+	}
+	return ledger.Add(ctx, &ledger.Entry{
+		Kind:         kind,
+		AllocationID: cr.AllocationID,
+		PayerID:      t.ToClientID,
+		RefID:        cr.ChallengeID,
+		Tokens:       tokens,
+		TxnHash:      t.Hash,
+	})
 }
 
 func (cr *ChallengeEntity) ErrorChallenge(ctx context.Context, err error) {
@@ -68,157 +143,69 @@ func (cr *ChallengeEntity) ErrorChallenge(ctx context.Context, err error) {
 }
 
 func (cr *ChallengeEntity) GetValidationTickets(ctx context.Context) error {
+	postDataBytes, err := cr.prepareValidation(ctx)
+	if err != nil {
+		return err
+	}
+	return cr.resolveTickets(ctx, cr.collectTickets(ctx, postDataBytes))
+}
+
+// prepareValidation loads the challenge input and returns the validation
+// request. The tickets of a previous attempt are kept for the same allocation
+// root.
+func (cr *ChallengeEntity) prepareValidation(ctx context.Context) ([]byte, error) {
 	if len(cr.Validators) == 0 {
 		cr.StatusMessage = "No validators assigned to the challange"
 		if err := cr.Save(ctx); err != nil {
 			Logger.Error("ChallengeEntity_Save", zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
 		}
-		return common.NewError("no_validators", "No validators assigned to the challange")
+		return nil, common.NewError("no_validators", "No validators assigned to the challange")
 	}
 
 	allocationObj, err := allocation.GetAllocationByID(ctx, cr.AllocationID)
 	if err != nil {
-		return err
-	}
-
-	wms, err := writemarker.GetWriteMarkersInRange(ctx, cr.AllocationID, cr.AllocationRoot, allocationObj.AllocationRoot)
-	if err != nil {
-		return err
-	}
-	if len(wms) == 0 {
-		return common.NewError("write_marker_not_found", "Could find the writemarker for the given allocation root on challenge")
-	}
-
-	rootRef, err := reference.GetReference(ctx, cr.AllocationID, "/")
-	blockNum := int64(0)
-	if rootRef.NumBlocks > 0 {
-		r := rand.New(rand.NewSource(cr.RandomNumber))
-		//rand.Seed(cr.RandomNumber)
-		blockNum = r.Int63n(rootRef.NumBlocks)
-		blockNum = blockNum + 1
-	} else {
-		Logger.Error("Got a challenge for a blank allocation")
+		return nil, err
 	}
 
-	cr.BlockNum = blockNum
-	if err != nil {
-		cr.ErrorChallenge(ctx, err)
-		return err
-	}
-	Logger.Info("blockNum for challenge", zap.Any("rootRef.NumBlocks", rootRef.NumBlocks), zap.Any("blockNum", blockNum), zap.Any("challenge_id", cr.ChallengeID), zap.Any("random_seed", cr.RandomNumber))
-	objectPath, err := reference.GetObjectPath(ctx, cr.AllocationID, blockNum)
+	in, err := loadChallengeInput(ctx, cr.AllocationID, cr.AllocationRoot,
+		allocationObj.AllocationRoot, cr.RandomNumber, 0)
 	if err != nil {
 		cr.ErrorChallenge(ctx, err)
-		return err
-	}
-	cr.RefID = objectPath.RefID
-	cr.RespondedAllocationRoot = allocationObj.AllocationRoot
-	cr.ObjectPath = objectPath
-
-	postData := make(map[string]interface{})
-	postData["challenge_id"] = cr.ChallengeID
-	postData["object_path"] = objectPath
-	markersArray := make([]map[string]interface{}, 0)
-	for _, wm := range wms {
-		markersMap := make(map[string]interface{})
-		markersMap["write_marker"] = wm.WM
-		markersMap["client_key"] = wm.ClientPublicKey
-		markersArray = append(markersArray, markersMap)
+		return nil, err
 	}
-	postData["write_markers"] = markersArray
+	cr.BlockNum = in.BlockNum
 
-	if blockNum > 0 {
-		if objectPath.Meta["type"] != reference.FILE {
-			Logger.Info("Block number to be challenged for file:", zap.Any("block", objectPath.FileBlockNum), zap.Any("meta", objectPath.Meta), zap.Any("obejct_path", objectPath))
-			err = common.NewError("invalid_object_path", "Object path was not for a file")
-			cr.ErrorChallenge(ctx, err)
-			return err
-		}
-
-		inputData := &filestore.FileInputData{}
-		inputData.Name = objectPath.Meta["name"].(string)
-		inputData.Path = objectPath.Meta["path"].(string)
-		inputData.Hash = objectPath.Meta["content_hash"].(string)
-		r := rand.New(rand.NewSource(cr.RandomNumber))
-		//rand.Seed(cr.RandomNumber)
-		blockoffset := r.Intn(1024)
-		blockData, mt, err := filestore.GetFileStore().GetFileBlockForChallenge(cr.AllocationID, inputData, blockoffset)
-
-		if err != nil {
-			cr.ErrorChallenge(ctx, err)
-			return common.NewError("blockdata_not_found", err.Error())
-		}
-		postData["data"] = []byte(blockData)
-		postData["merkle_path"] = mt.GetPathByIndex(blockoffset)
-	}
+	// the tickets of a previous attempt are valid for the same allocation root
+	prevRoot := cr.RespondedAllocationRoot
+	cr.RefID = in.ObjectPath.RefID
+	cr.RespondedAllocationRoot = allocationObj.AllocationRoot
+	cr.ObjectPath = in.ObjectPath
 
-	postDataBytes, err := json.Marshal(postData)
+	postDataBytes, err := in.postData(cr.ChallengeID)
 	if err != nil {
 		Logger.Error("Error in marshalling the post data for validation. " + err.Error())
 		cr.ErrorChallenge(ctx, err)
-		return err
+		return nil, err
 	}
-	responses := make(map[string]ValidationTicket)
-	if cr.ValidationTickets == nil {
+	if len(cr.ValidationTickets) != len(cr.Validators) || prevRoot != cr.RespondedAllocationRoot {
 		cr.ValidationTickets = make([]*ValidationTicket, len(cr.Validators))
 	}
-	for i, validator := range cr.Validators {
-		if cr.ValidationTickets[i] != nil {
-			exisitingVT := cr.ValidationTickets[i]
-			if len(exisitingVT.Signature) > 0 && exisitingVT.ChallengeID == cr.ChallengeID {
-				continue
-			}
-		}
-		url := validator.URL + VALIDATOR_URL
-		resp, err := util.SendPostRequest(url, postDataBytes, nil)
-		if err != nil {
-			Logger.Info("Got error from the validator.", zap.Any("error", err.Error()))
-			delete(responses, validator.ID)
-			cr.ValidationTickets[i] = nil
-			continue
-		}
-		var validationTicket ValidationTicket
-		err = json.Unmarshal(resp, &validationTicket)
-		if err != nil {
-			Logger.Info("Got error decoding from the validator response .", zap.Any("resp", string(resp)), zap.Any("error", err.Error()))
-			delete(responses, validator.ID)
-			cr.ValidationTickets[i] = nil
-			continue
-		}
-		Logger.Info("Got response from the validator.", zap.Any("validator_response", validationTicket))
-		verified, err := validationTicket.VerifySign()
-		if err != nil || !verified {
-			Logger.Info("Validation ticket from validator could not be verified.")
-			delete(responses, validator.ID)
-			cr.ValidationTickets[i] = nil
-			continue
-		}
-		responses[validator.ID] = validationTicket
-		cr.ValidationTickets[i] = &validationTicket
-	}
+	return postDataBytes, nil
+}
 
-	numSuccess := 0
-	numFailure := 0
+// resolveTickets sets the result of the challenge by the tickets of the
+// validators, or errors it out without a quorum.
+func (cr *ChallengeEntity) resolveTickets(ctx context.Context, t *tally) error {
+	numSuccess, numFailure := t.success, t.failure
 
-	numValidatorsResponded := 0
-	for _, vt := range cr.ValidationTickets {
-		if vt != nil {
-			if vt.Result {
-				numSuccess++
-			} else {
-				numFailure++
-			}
-			numValidatorsResponded++
-		}
-	}
-
-	Logger.Info("validator response stats", zap.Any("challenge_id", cr.ChallengeID), zap.Any("validator_responses", responses))
-	if numSuccess > (len(cr.Validators)/2) || numFailure > (len(cr.Validators)/2) || numValidatorsResponded == len(cr.Validators) {
+	Logger.Info("validator response stats", zap.Any("challenge_id", cr.ChallengeID),
+		zap.Int("success", numSuccess), zap.Int("failure", numFailure), zap.Int("responded", t.responded))
+	if t.quorum() {
 		if numSuccess > (len(cr.Validators) / 2) {
 			cr.Result = ChallengeSuccess
 		} else {
 			cr.Result = ChallengeFailure
-			Logger.Error("Challenge failed by the validators", zap.Any("block_num", cr.BlockNum), zap.Any("object_path", objectPath), zap.Any("challenge", cr))
+			Logger.Error("Challenge failed by the validators", zap.Any("block_num", cr.BlockNum), zap.Any("object_path", cr.ObjectPath), zap.Any("challenge", cr))
 		}
 
 		cr.Status = Processed
@@ -244,31 +231,26 @@ func (cr *ChallengeEntity) CommitChallenge(ctx context.Context, verifyOnly bool)
 					Logger.Error("ChallengeEntity_Save", zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
 				}
 				FileChallenged(ctx, cr.RefID, cr.Result, cr.CommitTxnID)
+				if err := cr.addLedgerEntry(ctx, t); err != nil {
+					Logger.Error("ChallengeEntity_addLedgerEntry", zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
+				}
 				return nil
 			}
 			Logger.Error("Error verifying the txn from BC."+lastTxn, zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
 		}
 	}
 
+	// the response can't be committed past the deadline anymore
 	if verifyOnly {
-		return nil
+		cr.Status = Expired
+		cr.StatusMessage = "Challenge expired before its response was committed"
+		return cr.Save(ctx)
 	}
 
-	t, err := cr.SubmitChallengeToBC(ctx)
-	if err != nil {
-		if t != nil {
-			cr.CommitTxnID = t.Hash
-			cr.LastCommitTxnIDs = append(cr.LastCommitTxnIDs, t.Hash)
-		}
+	if err := cr.SubmitChallengeToBC(ctx); err != nil {
 		cr.ErrorChallenge(ctx, err)
 		Logger.Error("Error while submitting challenge to BC.", zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
-	} else {
-		cr.Status = Committed
-		cr.StatusMessage = t.TransactionOutput
-		cr.CommitTxnID = t.Hash
-		cr.LastCommitTxnIDs = append(cr.LastCommitTxnIDs, t.Hash)
+		return err
 	}
-	err = cr.Save(ctx)
-	FileChallenged(ctx, cr.RefID, cr.Result, cr.CommitTxnID)
-	return err
+	return nil
 }
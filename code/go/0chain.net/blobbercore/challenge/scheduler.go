@@ -0,0 +1,176 @@
+package challenge
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+
+	"github.com/remeh/sizedwaitgroup"
+	"gorm.io/gorm"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// Deadline is the time the challenge response has to be committed by, from
+// the completion time the challenge was received with. The challenges
+// received before it was stored use the current one.
+func (cr *ChallengeEntity) Deadline() common.Timestamp {
+	completionTime := cr.CompletionTime
+	if completionTime == 0 {
+		completionTime = completionTimeSeconds()
+	}
+	return cr.Created + common.Timestamp(completionTime)
+}
+
+// challengeCompletionTime returns the challenge completion time of the
+// allocation, in seconds, as set by the storage smart contract. The configured
+// one is used if the allocation can't be requested.
+func challengeCompletionTime(allocationID string) int64 {
+	sa, err := allocation.RequestAllocation(allocationID)
+	if err != nil || sa.CCT <= 0 {
+		Logger.Warn("Using the configured challenge completion time, the allocation has none",
+			zap.String("allocation_id", allocationID), zap.Error(err))
+		return completionTimeSeconds()
+	}
+	return int64(sa.CCT / time.Second)
+}
+
+// completionTimeSeconds returns the configured challenge completion time, in
+// seconds.
+func completionTimeSeconds() int64 {
+	return int64(config.Get().ChallengeCompletionTime / time.Second)
+}
+
+// hopeless challenges are past the deadline or have failed validation the
+// max number of times; they are processed after all the others.
+func (cr *ChallengeEntity) hopeless(now common.Timestamp, maxAttempts int) bool {
+	return cr.Deadline() < now || (maxAttempts > 0 && cr.Attempts >= maxAttempts)
+}
+
+// challengeQueue is a priority queue of challenges, the earliest deadline
+// first and hopeless challenges last.
+type challengeQueue struct {
+	items       []*ChallengeEntity
+	now         common.Timestamp
+	maxAttempts int
+}
+
+func newChallengeQueue(crs []*ChallengeEntity, now common.Timestamp,
+	maxAttempts int) *challengeQueue {
+
+	q := &challengeQueue{now: now, maxAttempts: maxAttempts}
+	q.items = append(q.items, crs...)
+	heap.Init(q)
+	return q
+}
+
+func (q *challengeQueue) Len() int { return len(q.items) }
+
+func (q *challengeQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	ha, hb := a.hopeless(q.now, q.maxAttempts), b.hopeless(q.now, q.maxAttempts)
+	if ha != hb {
+		return hb
+	}
+	if da, db := a.Deadline(), b.Deadline(); da != db {
+		return da < db
+	}
+	return a.ChallengeID < b.ChallengeID
+}
+
+func (q *challengeQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *challengeQueue) Push(x interface{}) { q.items = append(q.items, x.(*ChallengeEntity)) }
+
+func (q *challengeQueue) Pop() interface{} {
+	n := len(q.items)
+	cr := q.items[n-1]
+	q.items = q.items[:n-1]
+	return cr
+}
+
+// Ordered pops all the challenges in the order of priority.
+func (q *challengeQueue) Ordered() []*ChallengeEntity {
+	crs := make([]*ChallengeEntity, 0, q.Len())
+	for q.Len() > 0 {
+		crs = append(crs, heap.Pop(q).(*ChallengeEntity))
+	}
+	return crs
+}
+
+// groupByAllocation splits the ordered challenges into groups of the same
+// allocation, keeping the order within and between the groups. Challenges
+// of different allocations are independent.
+func groupByAllocation(crs []*ChallengeEntity) [][]*ChallengeEntity {
+	var (
+		groups [][]*ChallengeEntity
+		index  = make(map[string]int)
+	)
+	for _, cr := range crs {
+		i, ok := index[cr.AllocationID]
+		if !ok {
+			i = len(groups)
+			index[cr.AllocationID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], cr)
+	}
+	return groups
+}
+
+// validateChallenges gets the validation tickets of the accepted challenges
+// by the deadline. Allocations are validated in parallel, the challenges of
+// an allocation in batches.
+func validateChallenges(ctx context.Context, crs []*ChallengeEntity) {
+	queue := newChallengeQueue(crs, common.Now(), config.Get().ChallengeMaxRetires)
+	swg := sizedwaitgroup.New(config.Get().ChallengeResolveNumWorkers)
+	for _, group := range groupByAllocation(queue.Ordered()) {
+		swg.Add()
+		go func(group []*ChallengeEntity) {
+			defer swg.Done()
+			for len(group) > 1 {
+				n := len(group)
+				if n > maxBatchSize {
+					n = maxBatchSize
+				}
+				validateBatch(ctx, group[:n])
+				group = group[n:]
+			}
+			if len(group) == 1 {
+				validateChallenge(ctx, group[0])
+			}
+		}(group)
+	}
+	swg.Wait()
+}
+
+func validateChallenge(ctx context.Context, cr *ChallengeEntity) {
+	Logger.Info("Processing the challenge", zap.String("challenge_id", cr.ChallengeID),
+		zap.Int64("deadline", int64(cr.Deadline())), zap.Int("attempts", cr.Attempts))
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	defer rctx.Done()
+	db := datastore.GetStore().GetTransaction(rctx)
+	finishValidation(db, cr, GetValidationTickets(rctx, cr))
+}
+
+// finishValidation counts the failed validation attempt and commits the
+// transaction of the challenge.
+func finishValidation(db *gorm.DB, cr *ChallengeEntity, err error) {
+	if err != nil {
+		Logger.Error("Getting validation tickets failed", zap.String("challenge_id", cr.ChallengeID), zap.Error(err))
+		err = db.Model(cr).Update("attempts", gorm.Expr("attempts + 1")).Error
+		if err != nil {
+			Logger.Error("Error counting the challenge validation attempt", zap.Error(err))
+		}
+	}
+	if err = db.Commit().Error; err != nil {
+		Logger.Error("Error committing the challenge validation", zap.Error(err))
+	}
+}
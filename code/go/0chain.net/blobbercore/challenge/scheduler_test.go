@@ -0,0 +1,55 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengeQueue(t *testing.T) {
+	config.Configuration.ChallengeCompletionTime = 2 * time.Minute
+
+	crs := []*ChallengeEntity{
+		{ChallengeID: "expired", AllocationID: "a", Created: 100},
+		{ChallengeID: "late", AllocationID: "b", Created: 300},
+		{ChallengeID: "retried", AllocationID: "a", Created: 150, Attempts: 3},
+		{ChallengeID: "soon", AllocationID: "a", Created: 200},
+	}
+	// the deadline of 'expired' is 220
+	q := newChallengeQueue(crs, 230, 3)
+
+	var ids []string
+	for _, cr := range q.Ordered() {
+		ids = append(ids, cr.ChallengeID)
+	}
+	require.Equal(t, []string{"soon", "late", "expired", "retried"}, ids)
+}
+
+func TestDeadline(t *testing.T) {
+	config.Configuration.ChallengeCompletionTime = 2 * time.Minute
+
+	cr := &ChallengeEntity{Created: 100, CompletionTime: 60}
+	require.EqualValues(t, 160, cr.Deadline())
+
+	// a reload doesn't shift the deadline of a challenge received
+	config.Configuration.ChallengeCompletionTime = 5 * time.Minute
+	require.EqualValues(t, 160, cr.Deadline())
+
+	// received before the completion time was stored
+	cr.CompletionTime = 0
+	require.EqualValues(t, 400, cr.Deadline())
+}
+
+func TestGroupByAllocation(t *testing.T) {
+	crs := []*ChallengeEntity{
+		{ChallengeID: "1", AllocationID: "a"},
+		{ChallengeID: "2", AllocationID: "b"},
+		{ChallengeID: "3", AllocationID: "a"},
+	}
+	groups := groupByAllocation(crs)
+	require.Len(t, groups, 2)
+	require.Equal(t, []*ChallengeEntity{crs[0], crs[2]}, groups[0])
+	require.Equal(t, []*ChallengeEntity{crs[1]}, groups[1])
+}
@@ -0,0 +1,124 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	vstorage "github.com/0chain/blobber/code/go/0chain.net/validatorcore/storage"
+)
+
+// AuditCheck is a step of the self-audit.
+type AuditCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SelfAuditReport is the result of a challenge dry-run against local data.
+type SelfAuditReport struct {
+	AllocationID    string        `json:"allocation_id"`
+	ChallengedRoot  string        `json:"challenged_root"`
+	LatestRoot      string        `json:"latest_root"`
+	Seed            int64         `json:"seed"`
+	BlockNum        int64         `json:"block_num"`
+	BlockOffset     int           `json:"block_offset"`
+	Path            string        `json:"path,omitempty"`
+	NumWriteMarkers int           `json:"num_write_markers"`
+	Passed          bool          `json:"passed"`
+	Checks          []*AuditCheck `json:"checks"`
+}
+
+func (r *SelfAuditReport) check(name string, err error) bool {
+	c := &AuditCheck{Name: name, Passed: err == nil}
+	if err != nil {
+		c.Reason = err.Error()
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Passed
+}
+
+func (r *SelfAuditReport) skip(name, reason string) {
+	r.Checks = append(r.Checks, &AuditCheck{Name: name, Skipped: true, Reason: reason})
+}
+
+// SelfAudit dry-runs a challenge of the allocation: it prepares the
+// validation request the same way a challenge does and verifies it as a
+// validator would, without contacting the chain or the validators. The
+// challenged allocation root is the latest redeemed one. The block number is
+// derived from the seed unless given; a random seed is used if it's zero.
+func SelfAudit(ctx context.Context, allocationID string, blockNum,
+	seed int64) (*SelfAuditReport, error) {
+
+	alloc, err := allocation.GetAllocationByID(ctx, allocationID)
+	if err != nil {
+		return nil, err
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	r := &SelfAuditReport{
+		AllocationID:   allocationID,
+		ChallengedRoot: alloc.LatestRedeemedWM,
+		LatestRoot:     alloc.AllocationRoot,
+		Seed:           seed,
+		BlockNum:       blockNum,
+		Passed:         true,
+	}
+	if r.ChallengedRoot == "" {
+		r.ChallengedRoot = alloc.AllocationRoot
+	}
+
+	in, err := loadChallengeInput(ctx, allocationID, r.ChallengedRoot,
+		r.LatestRoot, seed, blockNum)
+	if !r.check("challenge_input", err) {
+		return r, nil
+	}
+	r.BlockNum = in.BlockNum
+	r.BlockOffset = in.BlockOffset
+	r.NumWriteMarkers = len(in.WriteMarkers)
+	if path, ok := in.ObjectPath.Meta["path"].(string); ok {
+		r.Path = path
+	}
+
+	// decode the request as a validator does
+	var req vstorage.ChallengeRequest
+	data, err := in.postData("self-audit")
+	if err == nil {
+		err = json.Unmarshal(data, &req)
+	}
+	if !r.check("validation_request", err) {
+		return r, nil
+	}
+
+	challengeObj := &vstorage.Challenge{
+		ID:             "self-audit",
+		RandomNumber:   seed,
+		AllocationID:   allocationID,
+		AllocationRoot: r.ChallengedRoot,
+	}
+	allocationObj := &vstorage.Allocation{ID: allocationID}
+
+	pathOK := r.check("object_path", req.ObjPath.VerifyPath(allocationID))
+	switch {
+	case !pathOK:
+		r.skip("block_num", "invalid object path")
+	case blockNum > 0:
+		r.skip("block_num", "the block number is given")
+	default:
+		r.check("block_num", req.ObjPath.VerifyBlockNum(seed))
+	}
+	if !pathOK {
+		// both need the root of the object path
+		r.skip("write_markers", "invalid object path")
+		r.skip("data_block", "invalid object path")
+		return r, nil
+	}
+	r.check("write_markers", req.VerifyWriteMarkers(challengeObj, allocationObj))
+	r.check("data_block", req.VerifyDataBlock())
+	return r, nil
+}
@@ -0,0 +1,219 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/util"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// ValidatorStat is the latency and errors of a validator answering
+// the challenges of the blobber.
+type ValidatorStat struct {
+	ValidatorID string           `json:"validator_id"`
+	URL         string           `json:"url"`
+	Requests    int64            `json:"requests"`
+	Errors      int64            `json:"errors"`
+	Successes   int64            `json:"successes"`
+	Failures    int64            `json:"failures"`
+	AvgLatency  time.Duration    `json:"avg_latency"`
+	MaxLatency  time.Duration    `json:"max_latency"`
+	LastError   string           `json:"last_error,omitempty"`
+	LastSeen    common.Timestamp `json:"last_seen"`
+
+	totalLatency time.Duration
+}
+
+var validatorStats = struct {
+	sync.Mutex
+	m map[string]*ValidatorStat
+}{m: make(map[string]*ValidatorStat)}
+
+// addValidatorStat records a response of the validator, or the error
+func addValidatorStat(v ValidationNode, latency time.Duration,
+	vt *ValidationTicket, err error) {
+
+	validatorStats.Lock()
+	defer validatorStats.Unlock()
+
+	vs, ok := validatorStats.m[v.ID]
+	if !ok {
+		vs = &ValidatorStat{ValidatorID: v.ID}
+		validatorStats.m[v.ID] = vs
+	}
+	vs.URL = v.URL
+	vs.Requests++
+	if err != nil {
+		vs.Errors++
+		vs.LastError = err.Error()
+		return
+	}
+	vs.LastSeen = common.Now()
+	vs.totalLatency += latency
+	vs.AvgLatency = vs.totalLatency / time.Duration(vs.Requests-vs.Errors)
+	if latency > vs.MaxLatency {
+		vs.MaxLatency = latency
+	}
+	if vt.Result {
+		vs.Successes++
+	} else {
+		vs.Failures++
+	}
+}
+
+// GetValidatorStats returns the stats of all the validators the blobber
+// requested, ordered by ID.
+func GetValidatorStats() []*ValidatorStat {
+	validatorStats.Lock()
+	defer validatorStats.Unlock()
+
+	stats := make([]*ValidatorStat, 0, len(validatorStats.m))
+	for _, vs := range validatorStats.m {
+		cp := *vs
+		stats = append(stats, &cp)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ValidatorID < stats[j].ValidatorID
+	})
+	return stats
+}
+
+// tally of the validation tickets
+type tally struct {
+	validators       int
+	success, failure int
+	responded        int
+}
+
+func (t *tally) add(vt *ValidationTicket) {
+	if vt == nil {
+		return
+	}
+	if vt.Result {
+		t.success++
+	} else {
+		t.failure++
+	}
+	t.responded++
+}
+
+// quorum is reached when the majority of the validators agree or all of
+// them have responded
+func (t *tally) quorum() bool {
+	return t.success > t.validators/2 || t.failure > t.validators/2 ||
+		t.responded == t.validators
+}
+
+type ticketResult struct {
+	index   int
+	ticket  *ValidationTicket
+	latency time.Duration
+	err     error
+}
+
+// requestTicket requests the validation ticket from the validator and checks
+// its signature.
+func requestTicket(ctx context.Context, v ValidationNode, data []byte) (
+	*ValidationTicket, error) {
+
+	resp, err := util.SendPostRequestWithContext(ctx, v.URL+VALIDATOR_URL, data)
+	if err != nil {
+		return nil, err
+	}
+	vt := new(ValidationTicket)
+	if err = json.Unmarshal(resp, vt); err != nil {
+		Logger.Info("Got error decoding from the validator response .", zap.Any("resp", string(resp)), zap.Any("error", err.Error()))
+		return nil, err
+	}
+	Logger.Info("Got response from the validator.", zap.Any("validator_response", vt))
+	if err = verifyTicket(vt); err != nil {
+		return nil, err
+	}
+	return vt, nil
+}
+
+func verifyTicket(vt *ValidationTicket) error {
+	verified, err := vt.VerifySign()
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return common.NewError("invalid_ticket", "Validation ticket from validator could not be verified")
+	}
+	return nil
+}
+
+// cachedTickets tallies the tickets of a previous attempt and returns the
+// indexes of the validators having no ticket.
+func (cr *ChallengeEntity) cachedTickets() (t *tally, missing []int) {
+	t = &tally{validators: len(cr.Validators)}
+	for i, vt := range cr.ValidationTickets {
+		if vt != nil && len(vt.Signature) > 0 && vt.ChallengeID == cr.ChallengeID {
+			t.add(vt)
+			continue
+		}
+		cr.ValidationTickets[i] = nil
+		missing = append(missing, i)
+	}
+	return t, missing
+}
+
+// validatorContext limits the request to the validator by the timeout.
+func validatorContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := config.Get().ChallengeValidatorTimeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// collectTickets requests the validators having no ticket yet concurrently,
+// each limited by the validator timeout. It returns as soon as the quorum
+// is reached, the rest of the requests are cancelled.
+func (cr *ChallengeEntity) collectTickets(ctx context.Context, data []byte) *tally {
+	t, missing := cr.cachedTickets()
+	if t.quorum() || len(missing) == 0 {
+		return t
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan ticketResult, len(missing))
+	for _, i := range missing {
+		go func(i int, v ValidationNode) {
+			vctx, vcancel := validatorContext(ctx)
+			defer vcancel()
+			start := time.Now()
+			vt, err := requestTicket(vctx, v, data)
+			results <- ticketResult{index: i, ticket: vt, latency: time.Since(start), err: err}
+		}(i, cr.Validators[i])
+	}
+
+	for range missing {
+		r := <-results
+		v := cr.Validators[r.index]
+		if r.err != nil && errors.Is(ctx.Err(), context.Canceled) {
+			continue // cancelled after the quorum
+		}
+		addValidatorStat(v, r.latency, r.ticket, r.err)
+		if r.err != nil {
+			Logger.Info("Got error from the validator.", zap.String("validator", v.ID), zap.Error(r.err))
+			continue
+		}
+		cr.ValidationTickets[r.index] = r.ticket
+		t.add(r.ticket)
+		if t.quorum() {
+			break
+		}
+	}
+	return t
+}
@@ -0,0 +1,75 @@
+package challenge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTallyQuorum(t *testing.T) {
+	tl := &tally{validators: 3}
+	require.False(t, tl.quorum())
+	tl.add(&ValidationTicket{Result: true})
+	tl.add(&ValidationTicket{Result: false})
+	require.False(t, tl.quorum())
+	tl.add(&ValidationTicket{Result: true})
+	require.True(t, tl.quorum())
+	require.Equal(t, 2, tl.success)
+	require.Equal(t, 1, tl.failure)
+}
+
+func TestCollectTicketsCached(t *testing.T) {
+	cr := &ChallengeEntity{
+		ChallengeID: "c1",
+		Validators:  []ValidationNode{{ID: "v1"}, {ID: "v2"}, {ID: "v3"}},
+	}
+	cr.ValidationTickets = []*ValidationTicket{
+		{ChallengeID: "c1", Result: true, Signature: "s1"},
+		nil,
+		{ChallengeID: "c1", Result: true, Signature: "s3"},
+	}
+	// the quorum is reached without requesting the validator
+	tl := cr.collectTickets(context.Background(), nil)
+	require.True(t, tl.quorum())
+	require.Equal(t, 2, tl.success)
+}
+
+func TestCollectTicketsTimeout(t *testing.T) {
+	logging.Logger = zap.NewNop()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	config.Configuration.ChallengeValidatorTimeout = 100 * time.Millisecond
+	defer func() { config.Configuration.ChallengeValidatorTimeout = 0 }()
+
+	cr := &ChallengeEntity{
+		ChallengeID: "c2",
+		Validators:  []ValidationNode{{ID: "down", URL: srv.URL}},
+	}
+	cr.ValidationTickets = make([]*ValidationTicket, 1)
+
+	start := time.Now()
+	tl := cr.collectTickets(context.Background(), []byte("{}"))
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.False(t, tl.quorum())
+	require.Nil(t, cr.ValidationTickets[0])
+
+	var found bool
+	for _, vs := range GetValidatorStats() {
+		if vs.ValidatorID == "down" {
+			found = true
+			require.EqualValues(t, 1, vs.Errors)
+		}
+	}
+	require.True(t, found)
+}
@@ -9,12 +9,13 @@ import (
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 
-	"github.com/remeh/sizedwaitgroup"
 	"gorm.io/gorm"
 
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
@@ -27,13 +28,16 @@ type BCChallengeResponse struct {
 }
 
 func SetupWorkers(ctx context.Context) {
+	txnmanager.RegisterCallback(transaction.CHALLENGE_RESPONSE, onChallengeCommitted)
 	go FindChallenges(ctx)
 	go SubmitProcessedChallenges(ctx) //nolint:errcheck // goroutines
 }
 
 func GetValidationTickets(ctx context.Context, challengeObj *ChallengeEntity) error {
-	mutex := lock.GetMutex(challengeObj.TableName(), challengeObj.ChallengeID)
-	mutex.Lock()
+	mutex := lock.GetLocker(challengeObj.TableName(), challengeObj.ChallengeID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return err
+	}
 	err := challengeObj.GetValidationTickets(ctx)
 	if err != nil {
 		Logger.Error("Error getting the validation tickets", zap.Error(err), zap.String("challenge_id", challengeObj.ChallengeID))
@@ -42,110 +46,81 @@ func GetValidationTickets(ctx context.Context, challengeObj *ChallengeEntity) er
 	return err
 }
 
+// SubmitProcessedChallenges commits the processed challenges by their
+// deadlines. Challenges past the deadline are only verified against the
+// transactions submitted already, and expire if none is committed.
 func SubmitProcessedChallenges(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			end, err := common.StartOperation("worker", "submit_challenges")
+			if err != nil {
+				return err
+			}
 			rctx := datastore.GetStore().CreateTransaction(ctx)
 			db := datastore.GetStore().GetTransaction(rctx)
-			//lastChallengeRedeemed := &ChallengeEntity{}
-			rows, err := db.Table("challenges").
-				Select("commit_txn_id, sequence").
-				Where(ChallengeEntity{Status: Committed}).
-				Order("sequence desc").Limit(1).Rows()
-
-			if rows != nil && err == nil {
-				lastSeq := 0
-				lastCommitTxn := ""
-				for rows.Next() {
-					if err := rows.Scan(&lastCommitTxn, &lastSeq); err != nil {
-						Logger.Error("Rows_Scan", zap.Error(err))
-					}
-				}
-
-				openchallenges := make([]*ChallengeEntity, 0)
 
-				db.Where(ChallengeEntity{Status: Processed}).
-					Where("sequence > ?", lastSeq).
-					Order("sequence").
-					Find(&openchallenges)
+			openchallenges := make([]*ChallengeEntity, 0)
+			err = db.Where(ChallengeEntity{Status: Processed}).
+				Find(&openchallenges).Error
+			if err != nil {
+				Logger.Error("Error in getting the challenges for blockchain processing.",
+					zap.Error(err))
+				openchallenges = nil
+			}
 
-				if len(openchallenges) > 0 {
-					for _, openchallenge := range openchallenges {
-						Logger.Info("Attempting to commit challenge", zap.Any("challenge_id", openchallenge.ChallengeID), zap.Any("openchallenge", openchallenge))
-						if err := openchallenge.UnmarshalFields(); err != nil {
-							Logger.Error("ChallengeEntity_UnmarshalFields", zap.String("challenge_id", openchallenge.ChallengeID), zap.Error(err))
-						}
-						mutex := lock.GetMutex(openchallenge.TableName(), openchallenge.ChallengeID)
-						mutex.Lock()
-						redeemCtx := datastore.GetStore().CreateTransaction(ctx)
-						err := openchallenge.CommitChallenge(redeemCtx, false)
-						if err != nil {
-							Logger.Error("Error committing to blockchain",
-								zap.Error(err),
-								zap.String("challenge_id", openchallenge.ChallengeID))
-						}
-						mutex.Unlock()
-						db := datastore.GetStore().GetTransaction(redeemCtx)
-						db.Commit()
-						if err == nil && openchallenge.Status == Committed {
-							Logger.Info("Challenge has been submitted to blockchain",
-								zap.Any("id", openchallenge.ChallengeID),
-								zap.String("txn", openchallenge.CommitTxnID))
-						} else {
-							Logger.Info("Challenge was not committed", zap.Any("challenge_id", openchallenge.ChallengeID))
-							break
-						}
-					}
+			// challenges with a queued response are committed by the
+			// transaction callback
+			pending, err := txnmanager.GetPendingRefIDs(rctx, transaction.CHALLENGE_RESPONSE)
+			if err != nil {
+				Logger.Error("Error getting the pending challenge responses", zap.Error(err))
+				openchallenges = nil
+			}
+			db.Rollback()
+			rctx.Done()
+
+			now := common.Now()
+			queue := newChallengeQueue(openchallenges, now, config.Get().ChallengeMaxRetires)
+			for _, openchallenge := range queue.Ordered() {
+				if _, ok := pending[openchallenge.ChallengeID]; ok {
+					continue
 				}
-				db.Rollback()
-				rctx.Done()
-
-				rctx = datastore.GetStore().CreateTransaction(ctx)
-				db = datastore.GetStore().GetTransaction(rctx)
-				toBeVerifiedChallenges := make([]*ChallengeEntity, 0)
-				// commit challenges on local state for all challenges that
-				// have missed the commit txn from blockchain
-				db.Where(ChallengeEntity{Status: Processed}).
-					Where("sequence < ?", lastSeq).
-					Find(&toBeVerifiedChallenges)
-
-				for _, toBeVerifiedChallenge := range toBeVerifiedChallenges {
-					Logger.Info("Attempting to commit challenge through verification", zap.Any("challenge_id", toBeVerifiedChallenge.ChallengeID), zap.Any("openchallenge", toBeVerifiedChallenge))
-					if err := toBeVerifiedChallenge.UnmarshalFields(); err != nil {
-						Logger.Error("ChallengeEntity_UnmarshalFields", zap.String("challenge_id", toBeVerifiedChallenge.ChallengeID), zap.Error(err))
-					}
-					mutex := lock.GetMutex(toBeVerifiedChallenge.TableName(), toBeVerifiedChallenge.ChallengeID)
-					mutex.Lock()
-					redeemCtx := datastore.GetStore().CreateTransaction(ctx)
-					err := toBeVerifiedChallenge.CommitChallenge(redeemCtx, true)
-					if err != nil {
-						Logger.Error("Error committing to blockchain",
-							zap.Error(err),
-							zap.String("challenge_id", toBeVerifiedChallenge.ChallengeID))
-					}
-					mutex.Unlock()
-					db := datastore.GetStore().GetTransaction(redeemCtx)
-					db.Commit()
-					if err == nil && toBeVerifiedChallenge.Status == Committed {
-						Logger.Info("Challenge has been submitted to blockchain",
-							zap.Any("id", toBeVerifiedChallenge.ChallengeID),
-							zap.String("txn", toBeVerifiedChallenge.CommitTxnID))
-					} else {
-						Logger.Info("Challenge was not committed after verification", zap.Any("challenge_id", toBeVerifiedChallenge.ChallengeID))
-					}
+				if err := openchallenge.UnmarshalFields(); err != nil {
+					Logger.Error("ChallengeEntity_UnmarshalFields", zap.String("challenge_id", openchallenge.ChallengeID), zap.Error(err))
+				}
+				verifyOnly := openchallenge.Deadline() < now
+				Logger.Info("Attempting to commit challenge", zap.String("challenge_id", openchallenge.ChallengeID),
+					zap.Int64("deadline", int64(openchallenge.Deadline())), zap.Bool("verify_only", verifyOnly))
+				mutex := lock.GetLocker(openchallenge.TableName(), openchallenge.ChallengeID)
+				mutex.Lock()
+				redeemCtx := datastore.GetStore().CreateTransaction(ctx)
+				err := openchallenge.CommitChallenge(redeemCtx, verifyOnly)
+				if err != nil {
+					Logger.Error("Error committing to blockchain",
+						zap.Error(err),
+						zap.String("challenge_id", openchallenge.ChallengeID))
+				}
+				mutex.Unlock()
+				db := datastore.GetStore().GetTransaction(redeemCtx)
+				db.Commit()
+				switch {
+				case err != nil:
+					Logger.Info("Challenge was not committed", zap.String("challenge_id", openchallenge.ChallengeID))
+				case openchallenge.Status == Expired:
+					Logger.Warn("Challenge expired without a committed response", zap.String("challenge_id", openchallenge.ChallengeID))
+				case openchallenge.Status == Committed:
+					Logger.Info("Challenge has been committed", zap.String("challenge_id", openchallenge.ChallengeID))
+				default:
+					Logger.Info("Challenge has been submitted to blockchain",
+						zap.String("id", openchallenge.ChallengeID),
+						zap.Any("status", openchallenge.Status))
 				}
-
-				db.Rollback()
-				rctx.Done()
-			} else {
-				Logger.Error("Error in getting the challenges for blockchain processing.",
-					zap.Error(err))
 			}
+			end()
 		}
-		time.Sleep(time.Duration(config.Configuration.ChallengeResolveFreq) * time.Second)
+		time.Sleep(time.Duration(config.Get().ChallengeResolveFreq) * time.Second)
 	}
 
 	return nil //nolint:govet // need more time to verify
@@ -154,44 +129,32 @@ func SubmitProcessedChallenges(ctx context.Context) error {
 var iterInprogress = false
 
 func FindChallenges(ctx context.Context) {
-	ticker := time.NewTicker(time.Duration(config.Configuration.ChallengeResolveFreq) * time.Second)
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-time.After(time.Duration(config.Get().ChallengeResolveFreq) * time.Second):
 			if !iterInprogress {
+				end, err := common.StartOperation("worker", "find_challenges")
+				if err != nil {
+					return
+				}
 				iterInprogress = true
 				rctx := datastore.GetStore().CreateTransaction(ctx)
 				db := datastore.GetStore().GetTransaction(rctx)
 				openchallenges := make([]*ChallengeEntity, 0)
 				db.Where(ChallengeEntity{Status: Accepted}).Find(&openchallenges)
 				if len(openchallenges) > 0 {
-					swg := sizedwaitgroup.New(config.Configuration.ChallengeResolveNumWorkers)
+					toValidate := make([]*ChallengeEntity, 0, len(openchallenges))
 					for _, openchallenge := range openchallenges {
-						Logger.Info("Processing the challenge", zap.Any("challenge_id", openchallenge.ChallengeID), zap.Any("openchallenge", openchallenge))
 						err := openchallenge.UnmarshalFields()
 						if err != nil {
 							Logger.Error("Error unmarshaling challenge entity.", zap.Error(err))
 							continue
 						}
-						swg.Add()
-						go func(redeemCtx context.Context, challengeEntity *ChallengeEntity) {
-							redeemCtx = datastore.GetStore().CreateTransaction(redeemCtx)
-							defer redeemCtx.Done()
-							err := GetValidationTickets(redeemCtx, challengeEntity)
-							if err != nil {
-								Logger.Error("Getting validation tickets failed", zap.Any("challenge_id", challengeEntity.ChallengeID), zap.Error(err))
-							}
-							db := datastore.GetStore().GetTransaction(redeemCtx)
-							err = db.Commit().Error
-							if err != nil {
-								Logger.Error("Error commiting the readmarker redeem", zap.Error(err))
-							}
-							swg.Done()
-						}(ctx, openchallenge)
+						toValidate = append(toValidate, openchallenge)
 					}
-					swg.Wait()
+					validateChallenges(ctx, toValidate)
 				}
 				db.Rollback()
 				rctx.Done()
@@ -232,6 +195,10 @@ func FindChallenges(ctx context.Context) {
 									if (latestChallenge == nil && len(challengeObj.PrevChallengeID) == 0) || latestChallenge.ChallengeID == challengeObj.PrevChallengeID {
 										Logger.Info("Adding new challenge found from blockchain", zap.String("challenge", v.ChallengeID))
 										challengeObj.Status = Accepted
+										if challengeObj.Created == 0 {
+											challengeObj.Created = common.Now()
+										}
+										challengeObj.CompletionTime = challengeCompletionTime(challengeObj.AllocationID)
 										if err := challengeObj.Save(tCtx); err != nil {
 											Logger.Error("ChallengeEntity_Save", zap.String("challenge_id", challengeObj.ChallengeID), zap.Error(err))
 										}
@@ -247,6 +214,7 @@ func FindChallenges(ctx context.Context) {
 					tCtx.Done()
 				}
 				iterInprogress = false
+				end()
 			}
 		}
 	}
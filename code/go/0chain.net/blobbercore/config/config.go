@@ -21,9 +21,31 @@ func SetupDefaultConfig() {
 	viper.SetDefault("writemarker_redeem.num_workers", 5)
 	viper.SetDefault("readmarker_redeem.frequency", 10)
 	viper.SetDefault("readmarker_redeem.num_workers", 5)
+	viper.SetDefault("readmarker_redeem.batch_size", 100)
+	viper.SetDefault("readmarker_redeem.threshold", 0.0)
+	viper.SetDefault("readmarker_redeem.expiry_margin", 600)
+	viper.SetDefault("readmarker_redeem.max_age", 24*60*60)
+	viper.SetDefault("transaction_manager.frequency", 1)
+	viper.SetDefault("transaction_manager.num_workers", 5)
+	viper.SetDefault("transaction_manager.batch_size", 100)
+	viper.SetDefault("transaction_manager.max_attempts", 10)
+	viper.SetDefault("transaction_manager.backoff_base", 5)
+	viper.SetDefault("transaction_manager.backoff_max", 300)
+	viper.SetDefault("transaction_manager.confirmation_timeout", 60)
 	viper.SetDefault("challenge_response.frequency", 10)
 	viper.SetDefault("challenge_response.num_workers", 5)
 	viper.SetDefault("challenge_response.max_retries", 10)
+	viper.SetDefault("db.driver", "postgres")
+	viper.SetDefault("db.path", "data/blobber_meta.db")
+	viper.SetDefault("db.auto_migrate", true)
+	viper.SetDefault("lock.backend", "local")
+	viper.SetDefault("lock.lease", 10*time.Minute)
+	viper.SetDefault("lock.max_connections", 100)
+	viper.SetDefault("max_upload_parts", 10000)
+	viper.SetDefault("shutdown_timeout", 30*time.Second)
+	viper.SetDefault("leader_election.enabled", false)
+	viper.SetDefault("leader_election.lease", 15*time.Second)
+	viper.SetDefault("leader_election.renew_interval", 5*time.Second)
 
 	viper.SetDefault("capacity", -1)
 	viper.SetDefault("read_price", 0.0)
@@ -70,6 +92,17 @@ type GeolocationConfig struct {
 
 type Config struct {
 	*config.Config
+	DBDriver                      string
+	DBPath                        string
+	DBAutoMigrate                 bool
+	LockBackend                   string
+	LockLease                     time.Duration
+	LockMaxConns                  int
+	ShutdownTimeout               time.Duration
+	LeaderElection                bool
+	LeaderID                      string
+	LeaderLease                   time.Duration
+	LeaderRenewInterval           time.Duration
 	DBHost                        string
 	DBPort                        string
 	DBName                        string
@@ -83,12 +116,31 @@ type Config struct {
 	WMRedeemNumWorkers            int
 	RMRedeemFreq                  int64
 	RMRedeemNumWorkers            int
+	RMRedeemBatchSize             int
+	RMRedeemThreshold             int64 // minimal value of pending reads to redeem
+	RMRedeemExpiryMargin          int64 // seconds, redeem regardless of value if a read pool expires sooner
+	RMRedeemMaxAge                int64 // seconds, redeem regardless of value if not redeemed for longer
+	TxnManagerFreq                int64
+	TxnManagerNumWorkers          int
+	TxnManagerBatchSize           int
+	TxnManagerMaxAttempts         int
+	TxnManagerBackoffBase         int64 // seconds
+	TxnManagerBackoffMax          int64 // seconds
+	TxnManagerConfirmationTimeout int64 // seconds
+	PoolCacheTTL                  time.Duration
+	PoolCacheRefreshAhead         time.Duration
+	PoolCacheStaleWhileRevalidate bool
+	PoolCacheRefreshInterval      time.Duration
+	PoolCacheNumWorkers           int
 	ChallengeResolveFreq          int64
 	ChallengeResolveNumWorkers    int
 	ChallengeMaxRetires           int
+	ChallengeValidatorTimeout     time.Duration
 	TempFilesCleanupFreq          int64
 	TempFilesCleanupNumWorkers    int
 	MaxFileSize                   int64
+	MaxUploadParts                int64   // parts of a multipart upload
+	RateLimit                     float64 // requests per second of the handlers
 
 	ColdStorageMinimumFileSize   int64
 	ColdStorageTimeLimitInHours  int64
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The configuration is reloaded as a whole, the readers of the reloadable
+// settings get the current snapshot by Get.
+
+var current atomic.Value // *Config
+
+// Get returns the current configuration snapshot, it must not be modified.
+// It's the Configuration until a snapshot is set.
+func Get() *Config {
+	if c, ok := current.Load().(*Config); ok {
+		return c
+	}
+	return &Configuration
+}
+
+// Set sets the current configuration snapshot.
+func Set(c *Config) {
+	current.Store(c)
+}
+
+// Change of a setting on reload.
+type Change struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Reload of the configuration, rejected with the error if invalid.
+type Reload struct {
+	Time    time.Time `json:"time"`
+	Changes []*Change `json:"changes"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// MaxReloadHistory is the number of the last reloads kept.
+const MaxReloadHistory = 50
+
+var reloads struct {
+	sync.Mutex
+	history []*Reload
+}
+
+// ReloadConfig validates the configuration and sets it as the current
+// snapshot, it returns the changes to the current one. An invalid
+// configuration is rejected and the current one is kept.
+func ReloadConfig(next *Config) ([]*Change, error) {
+	changes := Diff(Get(), next)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	reload := &Reload{Time: time.Now(), Changes: changes}
+	err := next.Validate()
+	if err != nil {
+		reload.Error = err.Error()
+	} else {
+		Set(next)
+	}
+
+	reloads.Lock()
+	reloads.history = append(reloads.history, reload)
+	if len(reloads.history) > MaxReloadHistory {
+		reloads.history = reloads.history[len(reloads.history)-MaxReloadHistory:]
+	}
+	reloads.Unlock()
+	return changes, err
+}
+
+// ReloadHistory returns the last reloads, the latest first.
+func ReloadHistory() []*Reload {
+	reloads.Lock()
+	defer reloads.Unlock()
+	history := make([]*Reload, 0, len(reloads.history))
+	for i := len(reloads.history) - 1; i >= 0; i-- {
+		history = append(history, reloads.history[i])
+	}
+	return history
+}
+
+// Diff returns the changes of the settings from the old to the new
+// configuration.
+func Diff(old, new *Config) []*Change {
+	var (
+		ov      = reflect.ValueOf(old).Elem()
+		nv      = reflect.ValueOf(new).Elem()
+		t       = ov.Type()
+		changes []*Change
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+		o, n := ov.Field(i).Interface(), nv.Field(i).Interface()
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, &Change{Key: f.Name, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// Validate validates the reloadable settings.
+func (c *Config) Validate() error {
+	switch {
+	case c.ReadPrice < 0 || c.WritePrice < 0:
+		return fmt.Errorf("negative read or write price")
+	case c.MinLockDemand < 0 || c.MinLockDemand > 1:
+		return fmt.Errorf("min_lock_demand %v not in [0; 1] range", c.MinLockDemand)
+	case c.ServiceCharge < 0 || c.ServiceCharge > 1:
+		return fmt.Errorf("service_charge %v not in [0; 1] range", c.ServiceCharge)
+	case c.MinStake > c.MaxStake:
+		return fmt.Errorf("min_stake greater than max_stake")
+	case c.RateLimit < 0:
+		return fmt.Errorf("negative handlers.rate_limit")
+	case c.MaxFileSize <= 0:
+		return fmt.Errorf("max_file_size must be positive")
+	}
+
+	for name, freq := range map[string]int64{
+		"openconnection_cleaner.frequency": c.OpenConnectionWorkerFreq,
+		"writemarker_redeem.frequency":     c.WMRedeemFreq,
+		"readmarker_redeem.frequency":      c.RMRedeemFreq,
+		"transaction_manager.frequency":    c.TxnManagerFreq,
+		"challenge_response.frequency":     c.ChallengeResolveFreq,
+	} {
+		if freq <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	for name, num := range map[string]int64{
+		"cold_storage.job_query_limit":     c.ColdStorageJobQueryLimit,
+		"max_upload_parts":                 c.MaxUploadParts,
+		"readmarker_redeem.batch_size":     int64(c.RMRedeemBatchSize),
+		"transaction_manager.batch_size":   int64(c.TxnManagerBatchSize),
+		"transaction_manager.max_attempts": int64(c.TxnManagerMaxAttempts),
+	} {
+		if num <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	for name, num := range map[string]int{
+		"writemarker_redeem.num_workers":  c.WMRedeemNumWorkers,
+		"readmarker_redeem.num_workers":   c.RMRedeemNumWorkers,
+		"transaction_manager.num_workers": c.TxnManagerNumWorkers,
+		"challenge_response.num_workers":  c.ChallengeResolveNumWorkers,
+	} {
+		if num < 0 {
+			return fmt.Errorf("negative %s", name)
+		}
+	}
+	if c.MinioStart && c.MinioWorkerFreq <= 0 {
+		return fmt.Errorf("minio.worker_frequency must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfig(t *testing.T) {
+	base := Config{
+		ReadPrice:                1,
+		WritePrice:               1,
+		MaxFileSize:              1 << 20,
+		MaxUploadParts:           10000,
+		OpenConnectionWorkerFreq: 30,
+		WMRedeemFreq:             10,
+		RMRedeemFreq:             10,
+		TxnManagerFreq:           1,
+		ChallengeResolveFreq:     10,
+		ColdStorageJobQueryLimit: 100,
+		RMRedeemBatchSize:        100,
+		TxnManagerBatchSize:      100,
+		TxnManagerMaxAttempts:    10,
+	}
+	Set(&base)
+	defer Set(&Configuration)
+	reloads.Lock()
+	reloads.history = nil
+	reloads.Unlock()
+
+	// unchanged
+	same := base
+	changes, err := ReloadConfig(&same)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	next := base
+	next.ReadPrice = 2
+	next.WMRedeemFreq = 5
+	changes, err = ReloadConfig(&next)
+	require.NoError(t, err)
+	require.Equal(t, []*Change{
+		{Key: "WMRedeemFreq", Old: int64(10), New: int64(5)},
+		{Key: "ReadPrice", Old: 1.0, New: 2.0},
+	}, changes)
+	require.Equal(t, 2.0, Get().ReadPrice)
+
+	// invalid, the current configuration is kept
+	invalid := next
+	invalid.MinLockDemand = 2
+	_, err = ReloadConfig(&invalid)
+	require.Error(t, err)
+	require.Equal(t, &next, Get())
+
+	// the cold storage job doesn't advance by a zero limit
+	invalid = next
+	invalid.ColdStorageJobQueryLimit = 0
+	_, err = ReloadConfig(&invalid)
+	require.Error(t, err)
+	require.Equal(t, &next, Get())
+
+	history := ReloadHistory()
+	require.Len(t, history, 3)
+	require.NotEmpty(t, history[0].Error)
+	require.Equal(t, "ColdStorageJobQueryLimit", history[0].Changes[0].Key)
+	require.Equal(t, "MinLockDemand", history[1].Changes[0].Key)
+	require.Empty(t, history[2].Error)
+}
@@ -0,0 +1,359 @@
+package datastore
+
+import (
+	"strings"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned change of the schema of the meta data DB.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up applies the change and Down reverts it, an irreversible change has
+	// no Down.
+	Up   string
+	Down string
+	// SQLiteUp and SQLiteDown are used instead of Up and Down on a SQLite
+	// DB, when their statements can't be translated from the Postgres ones.
+	// A migration with SQLiteUp but no SQLiteDown is irreversible on SQLite.
+	SQLiteUp   string
+	SQLiteDown string
+}
+
+func (m *Migration) up(driver string) string {
+	if driver != SQLiteDriver {
+		return m.Up
+	}
+	if m.SQLiteUp != "" {
+		return m.SQLiteUp
+	}
+	return sqliteStatements(m.Up)
+}
+
+func (m *Migration) down(driver string) string {
+	if driver != SQLiteDriver {
+		return m.Down
+	}
+	if m.SQLiteUp != "" {
+		return m.SQLiteDown
+	}
+	return sqliteStatements(m.Down)
+}
+
+func (m *Migration) reversible(driver string) bool {
+	if driver == SQLiteDriver && m.SQLiteUp != "" {
+		return m.SQLiteDown != ""
+	}
+	return m.Down != ""
+}
+
+// SchemaMigration is a migration applied to the DB.
+type SchemaMigration struct {
+	Version   int64     `gorm:"column:version;primaryKey" json:"version"`
+	Name      string    `gorm:"column:name" json:"name"`
+	AppliedAt time.Time `gorm:"column:applied_at" json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+const createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+const (
+	// schemaLockID is the key of the Postgres advisory lock held migrating.
+	schemaLockID = 7305020
+)
+
+// Migrations returns the migrations known, by version.
+func Migrations() []*Migration {
+	return migrations
+}
+
+// LatestVersion returns the version of the last migration known.
+func LatestVersion() int64 {
+	return migrations[len(migrations)-1].Version
+}
+
+// legacyMarkers are the tables, columns and indexes created by the sql
+// scripts, by the version of their migration. The markers found tell the
+// version of a DB created by the scripts, before the versions were recorded.
+// The grants of the script 2 and the column types of the script 14 can't be
+// told, their versions are passed. The create-indexes script run last is the
+// migration 26, it recreates its indexes when applied again.
+var legacyMarkers = []struct {
+	version int64
+	has     func(db *gorm.DB) bool
+}{
+	{1, func(db *gorm.DB) bool { return db.Migrator().HasTable("allocations") }},
+	{3, func(db *gorm.DB) bool { return db.Migrator().HasTable("terms") }},
+	{4, func(db *gorm.DB) bool { return hasColumn(db, "reference_objects", "on_cloud") }},
+	{5, func(db *gorm.DB) bool { return db.Migrator().HasTable("commit_meta_txns") }},
+	{6, func(db *gorm.DB) bool { return hasColumn(db, "allocations", "cleaned_up") }},
+	{7, func(db *gorm.DB) bool { return hasColumn(db, "terms", "allocation_id") }},
+	{8, func(db *gorm.DB) bool { return hasColumn(db, "allocations", "payer_id") }},
+	{9, func(db *gorm.DB) bool { return hasColumn(db, "read_markers", "suspend") }},
+	{10, func(db *gorm.DB) bool { return hasColumn(db, "allocations", "time_unit") }},
+	{11, func(db *gorm.DB) bool { return hasColumn(db, "read_markers", "auth_ticket") }},
+	{12, func(db *gorm.DB) bool { return hasColumn(db, "reference_objects", "attributes") }},
+	{13, func(db *gorm.DB) bool { return db.Migrator().HasTable("collaborators") }},
+	{15, func(db *gorm.DB) bool { return hasColumn(db, "allocations", "is_immutable") }},
+	{16, func(db *gorm.DB) bool { return db.Migrator().HasTable("marketplace_share_info") }},
+	{17, func(db *gorm.DB) bool { return hasIndex(db, "reference_objects", "idx_reference_objects_for_path") }},
+}
+
+// hasIndex and hasColumn look the schema up by the table name, the gorm
+// migrator needs a model for them.
+func hasIndex(db *gorm.DB, table, name string) bool {
+	var count int64
+	if db.Dialector.Name() == SQLiteDriver {
+		db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?",
+			table, name).Row().Scan(&count) //nolint:errcheck
+	} else {
+		db.Raw("SELECT count(*) FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = ? AND indexname = ?",
+			table, name).Row().Scan(&count) //nolint:errcheck
+	}
+	return count > 0
+}
+
+func hasColumn(db *gorm.DB, table, name string) bool {
+	var count int64
+	if db.Dialector.Name() == SQLiteDriver {
+		db.Raw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?",
+			table, name).Row().Scan(&count) //nolint:errcheck
+	} else {
+		db.Raw("SELECT count(*) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?",
+			table, name).Row().Scan(&count) //nolint:errcheck
+	}
+	return count > 0
+}
+
+// SchemaVersion returns the version of the schema of the DB, 0 for an empty
+// DB.
+func SchemaVersion(db *gorm.DB) (int64, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return legacyVersion(db)
+	}
+	version, err := recordedVersion(db)
+	if err == nil && version == 0 {
+		return legacyVersion(db)
+	}
+	return version, err
+}
+
+// legacyVersion returns the version of a DB created by the sql scripts, 0
+// for an empty DB. It fails if the markers found don't match any version,
+// the version has to be recorded by hand then.
+func legacyVersion(db *gorm.DB) (int64, error) {
+	if !db.Migrator().HasTable("allocations") {
+		return 0, nil
+	}
+	var version int64
+	for i, lm := range legacyMarkers {
+		if !lm.has(db) {
+			continue
+		}
+		if i > 0 && version != legacyMarkers[i-1].version {
+			version = 0
+			break
+		}
+		version = lm.version
+	}
+	if version == 0 {
+		return 0, common.NewError("unknown_schema_version",
+			"The DB was created by the sql scripts but its schema version can't be found, "+
+				"check the schema and record its version with the 'blobber migrate force <version>' command")
+	}
+	return version, nil
+}
+
+// AppliedMigrations returns the migrations recorded in the DB, by version.
+func AppliedMigrations(db *gorm.DB) ([]*SchemaMigration, error) {
+	var applied []*SchemaMigration
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	err := db.Order("version").Find(&applied).Error
+	return applied, err
+}
+
+// CheckSchema fails unless the DB has the schema of the latest migration.
+func CheckSchema(db *gorm.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return common.NewErrorf("schema_version_error", "Error getting the schema version: %v", err)
+	}
+	if err = checkKnown(version); err != nil {
+		return err
+	}
+	if version < LatestVersion() {
+		return common.NewErrorf("schema_outdated",
+			"The schema version %d is older than %d, the DB has to be migrated", version, LatestVersion())
+	}
+	return nil
+}
+
+// Migrate migrates the schema of the DB up or down to the version, holding
+// the migration lock. It fails if the DB has a newer version than the latest
+// known.
+func Migrate(db *gorm.DB, version int64) error {
+	if version < 0 || version > LatestVersion() {
+		return common.NewErrorf("invalid_schema_version", "Unknown schema version %d", version)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSchema(tx); err != nil {
+			return err
+		}
+		current, err := currentVersion(tx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case current < version:
+			return migrateUp(tx, current, version)
+		case current > version:
+			return migrateDown(tx, current, version)
+		}
+		return nil
+	})
+}
+
+// ForceVersion records the version as the one of the schema of the DB, for
+// a DB migrated by hand, without applying any migration.
+func ForceVersion(db *gorm.DB, version int64) error {
+	if version < 0 || version > LatestVersion() {
+		return common.NewErrorf("invalid_schema_version", "Unknown schema version %d", version)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSchema(tx); err != nil {
+			return err
+		}
+		if err := tx.Where("version > ?", 0).Delete(&SchemaMigration{}).Error; err != nil {
+			return err
+		}
+		return record(tx, version)
+	})
+}
+
+func checkKnown(version int64) error {
+	if version > LatestVersion() {
+		return common.NewErrorf("schema_too_new",
+			"The schema version %d is newer than the latest known %d, upgrade the blobber",
+			version, LatestVersion())
+	}
+	return nil
+}
+
+func recordedVersion(db *gorm.DB) (version int64, err error) {
+	err = db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Row().Scan(&version)
+	return
+}
+
+// lockSchema takes the migration lock for the transaction and creates the
+// schema_migrations table.
+func lockSchema(tx *gorm.DB) error {
+	// a SQLite transaction holds the write lock of the DB already
+	if tx.Dialector.Name() == PostgresDriver {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", schemaLockID).Error; err != nil {
+			return common.NewErrorf("schema_lock_error", "Error locking the schema: %v", err)
+		}
+	}
+	if err := tx.Exec(createSchemaMigrations).Error; err != nil {
+		return common.NewErrorf("schema_version_error", "Error creating the schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// currentVersion returns the schema version recorded, recording the version
+// of a DB created by the sql scripts.
+func currentVersion(tx *gorm.DB) (int64, error) {
+	current, err := recordedVersion(tx)
+	if err != nil {
+		return 0, common.NewErrorf("schema_version_error", "Error getting the schema version: %v", err)
+	}
+	if current == 0 {
+		if current, err = legacyVersion(tx); err != nil || current == 0 {
+			return current, err
+		}
+		Logger.Info("Recording the schema version of the DB created by the sql scripts",
+			zap.Int64("version", current))
+		if err = record(tx, current); err != nil {
+			return 0, err
+		}
+	}
+	return current, checkKnown(current)
+}
+
+// record records the migrations up to the version as applied.
+func record(tx *gorm.DB, version int64) error {
+	now := time.Now()
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		sm := &SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: now}
+		if err := tx.Create(sm).Error; err != nil {
+			return common.NewErrorf("schema_version_error", "Error recording the migration %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
+
+func migrateUp(tx *gorm.DB, current, version int64) error {
+	driver := tx.Dialector.Name()
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > version {
+			continue
+		}
+		Logger.Info("Applying the migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+		if err := exec(tx, m.up(driver)); err != nil {
+			return common.NewErrorf("migration_error", "Error applying the migration %d %s: %v", m.Version, m.Name, err)
+		}
+		sm := &SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		if err := tx.Create(sm).Error; err != nil {
+			return common.NewErrorf("schema_version_error", "Error recording the migration %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
+
+func migrateDown(tx *gorm.DB, current, version int64) error {
+	driver := tx.Dialector.Name()
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= version {
+			continue
+		}
+		if !m.reversible(driver) {
+			return common.NewErrorf("irreversible_migration", "The migration %d %s can't be reverted", m.Version, m.Name)
+		}
+		Logger.Info("Reverting the migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+		if err := exec(tx, m.down(driver)); err != nil {
+			return common.NewErrorf("migration_error", "Error reverting the migration %d %s: %v", m.Version, m.Name, err)
+		}
+		if err := tx.Delete(&SchemaMigration{Version: m.Version}).Error; err != nil {
+			return common.NewErrorf("schema_version_error", "Error recording the migration %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// exec runs the statements of a migration, the ones translated to SQLite can
+// be empty.
+func exec(tx *gorm.DB, statements string) error {
+	if strings.TrimSpace(statements) == "" {
+		return nil
+	}
+	return tx.Exec(statements).Error
+}
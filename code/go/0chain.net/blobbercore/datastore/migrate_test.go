@@ -0,0 +1,236 @@
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) (*gorm.DB, func()) {
+	logging.Logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "blobber_meta")
+	require.NoError(t, err)
+
+	config.Configuration.DBDriver = SQLiteDriver
+	config.Configuration.DBPath = filepath.Join(dir, "blobber_meta.db")
+	db, err := OpenDB()
+	require.NoError(t, err)
+	return db, func() {
+		config.Configuration.DBDriver = ""
+		if sqldb, err := db.DB(); err == nil {
+			sqldb.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, version)
+	require.Error(t, CheckSchema(db))
+
+	require.NoError(t, Migrate(db, LatestVersion()))
+	require.NoError(t, Migrate(db, LatestVersion()))
+	require.NoError(t, CheckSchema(db))
+	applied, err := AppliedMigrations(db)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations))
+
+	// a new migration is applied and reverted
+	defer func(known []*Migration) { migrations = known }(migrations)
+	migrations = append(migrations[:len(migrations):len(migrations)], &Migration{
+		Version: LatestVersion() + 1,
+		Name:    "add-test-table",
+		Up:      "CREATE TABLE test_table (id INTEGER PRIMARY KEY)",
+		Down:    "DROP TABLE test_table",
+	})
+	require.Error(t, CheckSchema(db))
+	require.NoError(t, Migrate(db, LatestVersion()))
+	require.True(t, db.Migrator().HasTable("test_table"))
+	version, err = SchemaVersion(db)
+	require.NoError(t, err)
+	require.Equal(t, LatestVersion(), version)
+
+	require.NoError(t, Migrate(db, LatestVersion()-1))
+	require.False(t, db.Migrator().HasTable("test_table"))
+	// a column can't be dropped on SQLite, nothing is reverted
+	require.Error(t, Migrate(db, 18))
+	version, err = SchemaVersion(db)
+	require.NoError(t, err)
+	require.Equal(t, LatestVersion()-1, version)
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, Migrate(db, LatestVersion()))
+	require.NoError(t, db.Create(&SchemaMigration{Version: LatestVersion() + 1, Name: "unknown"}).Error)
+
+	require.Error(t, Migrate(db, LatestVersion()))
+	require.Error(t, CheckSchema(db))
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	// created by the sql scripts, without the versions
+	require.NoError(t, Migrate(db, 17))
+	require.NoError(t, db.Migrator().DropTable(&SchemaMigration{}))
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.EqualValues(t, 17, version)
+
+	require.NoError(t, Migrate(db, LatestVersion()))
+	applied, err := AppliedMigrations(db)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations))
+}
+
+func TestLegacyVersion(t *testing.T) {
+	for _, lm := range legacyMarkers {
+		db, cleanup := openTestDB(t)
+		require.NoError(t, Migrate(db, lm.version))
+		require.NoError(t, db.Migrator().DropTable(&SchemaMigration{}))
+		version, err := SchemaVersion(db)
+		require.NoError(t, err)
+		require.Equal(t, lm.version, version)
+		cleanup()
+	}
+}
+
+func TestForceVersion(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, Migrate(db, LatestVersion()))
+	require.NoError(t, ForceVersion(db, 10))
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, version)
+	require.Error(t, ForceVersion(db, LatestVersion()+1))
+}
+
+func openMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	logging.Logger = zap.NewNop()
+	sqldb, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		DriverName:           "postgres",
+		Conn:                 sqldb,
+		PreferSimpleProtocol: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+	return db, mock
+}
+
+// expectLegacySchema expects the lookup of the markers of a DB created by
+// the sql scripts, the ones present are found.
+func expectLegacySchema(mock sqlmock.Sqlmock, present ...int64) {
+	count := func(found bool) *sqlmock.Rows {
+		if found {
+			return sqlmock.NewRows([]string{"count"}).AddRow(1)
+		}
+		return sqlmock.NewRows([]string{"count"}).AddRow(0)
+	}
+	mock.ExpectQuery("FROM information_schema.tables").
+		WithArgs("allocations", "BASE TABLE").
+		WillReturnRows(count(true))
+	for _, lm := range legacyMarkers {
+		found := false
+		for _, v := range present {
+			found = found || v == lm.version
+		}
+		mock.ExpectQuery("SELECT count").WillReturnRows(count(found))
+	}
+}
+
+// legacyVersions returns the versions of the markers of a DB created by the
+// sql scripts up to the version.
+func legacyVersions(version int64) []int64 {
+	var versions []int64
+	for _, lm := range legacyMarkers {
+		if lm.version <= version {
+			versions = append(versions, lm.version)
+		}
+	}
+	return versions
+}
+
+func TestSchemaVersion_Postgres(t *testing.T) {
+	tests := []struct {
+		name    string
+		present []int64
+		version int64
+		err     bool
+	}{
+		{name: "baseline", present: legacyVersions(17), version: 17},
+		{name: "older_scripts", present: legacyVersions(9), version: 9},
+		{name: "create_table", present: []int64{1}, version: 1},
+		{name: "no_markers", present: nil, err: true},
+		{name: "gap", present: []int64{1, 3, 5}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := openMockDB(t)
+			mock.ExpectQuery("FROM information_schema.tables").
+				WithArgs("schema_migrations", "BASE TABLE").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			expectLegacySchema(mock, tt.present...)
+
+			version, err := SchemaVersion(db)
+			if tt.err {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "migrate force")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.version, version)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMigrateLegacySchema_Postgres(t *testing.T) {
+	db, mock := openMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("pg_advisory_xact_lock").WithArgs(schemaLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	expectLegacySchema(mock, legacyVersions(17)...)
+	// the versions up to 17 are recorded, the later migrations applied
+	for _, m := range migrations {
+		if m.Version > 17 {
+			break
+		}
+		mock.ExpectQuery(`INSERT INTO "schema_migrations"`).
+			WithArgs(m.Name, sqlmock.AnyArg(), m.Version).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(m.Version))
+	}
+	mock.ExpectExec("CREATE TABLE resumable_uploads").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "schema_migrations"`).
+		WithArgs("add-resumable-uploads-table", sqlmock.AnyArg(), 18).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(18))
+	mock.ExpectCommit()
+
+	require.NoError(t, Migrate(db, 18))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
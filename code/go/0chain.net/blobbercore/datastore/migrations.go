@@ -0,0 +1,778 @@
+package datastore
+
+// migrations of the schema by version, the only source of the schema. The
+// first ones were the sql scripts run by the Postgres container, without the
+// grants of the tables created by the postgres user to the blobber user:
+// version 2 granted the privileges of the tables of version 1. The container
+// only creates the DB and the user now. A new migration is added here only,
+// its statements are translated to SQLite by sqliteStatements, the ones
+// SQLite can't run, as dropping a column, are rewritten for it.
+var migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create-table",
+		Up: `
+CREATE OR REPLACE FUNCTION update_modified_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TABLE allocations(
+    id VARCHAR (64) PRIMARY KEY,
+    size BIGINT NOT NULL DEFAULT 0,
+    used_size BIGINT NOT NULL DEFAULT 0,
+    owner_id VARCHAR(64) NOT NULL,
+    owner_public_key VARCHAR(256) NOT NULL,
+    expiration_date BIGINT NOT NULL,
+    allocation_root VARCHAR(255) NOT NULL DEFAULT '',
+    blobber_size BIGINT NOT NULL DEFAULT 0,
+    blobber_size_used BIGINT NOT NULL DEFAULT 0,
+    latest_redeemed_write_marker VARCHAR(255),
+    is_redeem_required BOOLEAN,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER allocation_modtime BEFORE UPDATE ON allocations FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE allocation_connections(
+    connection_id VARCHAR (64) PRIMARY KEY,
+    allocation_id VARCHAR(64) NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    status INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER allocation_connections_modtime BEFORE UPDATE ON allocation_connections FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE allocation_changes(
+    id BIGSERIAL PRIMARY KEY,
+    connection_id VARCHAR (64) REFERENCES allocation_connections(connection_id),
+    operation VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    input TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER allocation_changes_modtime BEFORE UPDATE ON allocation_changes FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE reference_objects (
+    id BIGSERIAL PRIMARY KEY,
+    lookup_hash VARCHAR (64) NOT NULL,
+    path_hash VARCHAR (64) NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    path TEXT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    num_of_blocks BIGINT NOT NULL DEFAULT 0,
+    parent_path TEXT,
+    level INT NOT NULL DEFAULT 0,
+    custom_meta TEXT NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    merkle_root VARCHAR(64) NOT NULL,
+    actual_file_size BIGINT NOT NULL DEFAULT 0,
+    actual_file_hash VARCHAR(64) NOT NULL,
+    mimetype VARCHAR(64) NOT NULL,
+    write_marker VARCHAR(64) NOT NULL,
+    thumbnail_hash VARCHAR(64) NOT NULL,
+    thumbnail_size BIGINT NOT NULL DEFAULT 0,
+    actual_thumbnail_size BIGINT NOT NULL DEFAULT 0,
+    actual_thumbnail_hash VARCHAR(64) NOT NULL,
+    encrypted_key TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP
+);
+
+CREATE TRIGGER reference_objects_modtime BEFORE UPDATE ON reference_objects FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE write_markers (
+    allocation_root VARCHAR (64) PRIMARY KEY,
+    prev_allocation_root VARCHAR (64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    blobber_id VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    timestamp BIGINT NOT NULL,
+    signature VARCHAR(256) NOT NULL,
+    status INT NOT NULL DEFAULT 0,
+    status_message TEXT,
+    redeem_retries INT NOT NULL DEFAULT 0,
+    close_txn_id VARCHAR(64),
+    connection_id VARCHAR(64) NOT NULL,
+    client_key VARCHAR(256) NOT NULL,
+    sequence BIGSERIAL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER write_markers_modtime BEFORE UPDATE ON write_markers FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE read_markers (
+    client_id VARCHAR(64) NOT NULL PRIMARY KEY,
+    client_public_key VARCHAR(256) NOT NULL,
+    blobber_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    owner_id VARCHAR(64) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    counter BIGINT NOT NULL DEFAULT 0,
+    signature VARCHAR(256) NOT NULL,
+    latest_redeemed_rm JSON,
+    redeem_required boolean,
+    latest_redeem_txn_id VARCHAR(64),
+    status_message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER read_markers_modtime BEFORE UPDATE ON read_markers FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE challenges (
+    challenge_id VARCHAR(64) NOT NULL PRIMARY KEY,
+    prev_challenge_id VARCHAR(64),
+    seed BIGINT NOT NULL DEFAULT 0,
+    allocation_id VARCHAR(64) NOT NULL,
+    allocation_root VARCHAR(255),
+    responded_allocation_root VARCHAR(255),
+    status INT NOT NULL DEFAULT 0,
+    result INT NOT NULL DEFAULT 0,
+    status_message TEXT,
+    commit_txn_id VARCHAR(64),
+    block_num BIGINT,
+    ref_id BIGINT,
+    validation_tickets JSON,
+    validators JSON,
+    last_commit_txn_ids JSON,
+    object_path JSON,
+    sequence BIGSERIAL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER challenges_modtime BEFORE UPDATE ON challenges FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+CREATE TABLE file_stats (
+    id BIGSERIAL PRIMARY KEY,
+    ref_id BIGINT UNIQUE REFERENCES reference_objects(id),
+    num_of_updates BIGINT,
+    num_of_block_downloads BIGINT,
+    num_of_challenges BIGINT,
+    num_of_failed_challenges BIGINT,
+    last_challenge_txn VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER file_stats_modtime BEFORE UPDATE ON file_stats FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+`,
+	},
+	{
+		Version: 3,
+		Name:    "add-allocation-prices",
+		Up: `
+ALTER TABLE allocations ADD COLUMN tx varchar (64) NOT NULL;
+
+CREATE UNIQUE INDEX idx_unique_allocations_tx ON allocations (tx);
+
+CREATE TABLE terms (
+    id             bigserial,
+
+    blobber_id     varchar(64) NOT NULL,
+    allocation_tx  varchar(64) REFERENCES allocations (tx),
+
+    read_price     bigint NOT NULL,
+    write_price    bigint NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE pendings (
+    id             bigserial,
+
+    client_id      varchar(64) NOT NULL,
+    allocation_id  varchar(64) NOT NULL,
+    blobber_id     varchar(64) NOT NULL,
+
+    pending_read   bigint NOT NULL DEFAULT 0,
+    pending_write  bigint NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX idx_pendings_cab
+    ON pendings (client_id, allocation_id, blobber_id);
+
+CREATE TABLE read_pools (
+    pool_id        text NOT NULL,
+
+    client_id      varchar(64) NOT NULL,
+    blobber_id     varchar(64) NOT NULL,
+    allocation_id  varchar(64) NOT NULL,
+
+    balance        bigint NOT NULL,
+    expire_at      bigint NOT NULL,
+
+    PRIMARY KEY (pool_id)
+);
+
+CREATE UNIQUE INDEX idx_read_pools_cab
+    ON read_pools (client_id, allocation_id, blobber_id);
+
+CREATE TABLE write_pools (
+    pool_id        text NOT NULL,
+
+    client_id      varchar(64) NOT NULL,
+    blobber_id     varchar(64) NOT NULL,
+    allocation_id  varchar(64) NOT NULL,
+
+    balance        bigint NOT NULL,
+    expire_at      bigint NOT NULL,
+
+    PRIMARY KEY (pool_id)
+);
+
+CREATE UNIQUE INDEX idx_write_pools_cab
+    ON write_pools (client_id, allocation_id, blobber_id);
+
+CREATE TABLE read_redeems (
+    id             bigserial,
+
+    read_counter   bigint NOT NULL,
+    value          bigint NOT NULL,
+
+    client_id      varchar(64) NOT NULL,
+    blobber_id     varchar(64) NOT NULL,
+    allocation_id  varchar(64) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE write_redeems (
+    id             bigserial,
+
+    signature      varchar(256) NOT NULL,
+
+    size           bigint NOT NULL,
+    value          bigint NOT NULL,
+
+    client_id      varchar(64) NOT NULL,
+    blobber_id     varchar(64) NOT NULL,
+    allocation_id  varchar(64) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_write_redeems_signature ON write_redeems (signature);
+`,
+	},
+	{
+		Version: 4,
+		Name:    "add-on-cloud",
+		Up: `
+ALTER TABLE reference_objects ADD COLUMN on_cloud BOOLEAN DEFAULT FALSE;
+`,
+	},
+	{
+		Version: 5,
+		Name:    "add-commit-meta-txns-table",
+		Up: `
+CREATE TABLE commit_meta_txns (
+    ref_id BIGSERIAL NOT NULL,
+    txn_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+`,
+	},
+	{
+		Version: 6,
+		Name:    "add-cleaned_up-column-to-allocations",
+		Up: `
+ALTER TABLE allocations
+    ADD COLUMN cleaned_up boolean NOT NULL DEFAULT false;
+
+ALTER TABLE allocations
+    ADD COLUMN finalized boolean NOT NULL DEFAULT false;
+`,
+	},
+	{
+		Version: 7,
+		Name:    "terms-belongs-to-allocation-id",
+		Up: `
+ALTER TABLE terms
+    ADD COLUMN allocation_id varchar(64) REFERENCES allocations (id);
+
+UPDATE terms AS t
+SET allocation_id = a.id
+FROM allocations AS a
+WHERE t.allocation_tx = a.tx;
+
+ALTER TABLE terms DROP COLUMN allocation_tx;
+
+DROP INDEX idx_read_pools_cab;
+DROP INDEX idx_write_pools_cab;
+
+CREATE INDEX idx_read_pools_cab
+    ON read_pools (client_id, allocation_id, blobber_id);
+CREATE INDEX idx_write_pools_cab
+    ON write_pools (client_id, allocation_id, blobber_id);
+`,
+		SQLiteUp: `
+CREATE TABLE terms_new (
+    id INTEGER PRIMARY KEY,
+    blobber_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) REFERENCES allocations (id),
+    read_price BIGINT NOT NULL,
+    write_price BIGINT NOT NULL
+);
+
+INSERT INTO terms_new (id, blobber_id, allocation_id, read_price, write_price)
+SELECT t.id, t.blobber_id, a.id, t.read_price, t.write_price
+FROM terms AS t LEFT JOIN allocations AS a ON t.allocation_tx = a.tx;
+
+DROP TABLE terms;
+ALTER TABLE terms_new RENAME TO terms;
+
+DROP INDEX idx_read_pools_cab;
+DROP INDEX idx_write_pools_cab;
+
+CREATE INDEX idx_read_pools_cab
+    ON read_pools (client_id, allocation_id, blobber_id);
+CREATE INDEX idx_write_pools_cab
+    ON write_pools (client_id, allocation_id, blobber_id);
+`,
+	},
+	{
+		Version: 8,
+		Name:    "add-payer-id-to-allocations",
+		Up: `
+ALTER TABLE allocations ADD COLUMN payer_id VARCHAR(64) NOT NULL;
+`,
+	},
+	{
+		Version: 9,
+		Name:    "add-suspend-column-to-read-markers",
+		Up: `
+ALTER TABLE read_markers
+    ADD COLUMN suspend BIGINT NOT NULL DEFAULT -1;
+
+ALTER TABLE pendings
+    DROP COLUMN pending_read;
+
+UPDATE pendings SET pending_write = 0;
+
+DROP TABLE read_redeems CASCADE;
+DROP TABLE write_redeems CASCADE;
+`,
+		SQLiteUp: `
+ALTER TABLE read_markers
+    ADD COLUMN suspend BIGINT NOT NULL DEFAULT -1;
+
+CREATE TABLE pendings_new (
+    id INTEGER PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    blobber_id VARCHAR(64) NOT NULL,
+    pending_write BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO pendings_new (id, client_id, allocation_id, blobber_id)
+SELECT id, client_id, allocation_id, blobber_id FROM pendings;
+
+DROP TABLE pendings;
+ALTER TABLE pendings_new RENAME TO pendings;
+
+CREATE UNIQUE INDEX idx_pendings_cab
+    ON pendings (client_id, allocation_id, blobber_id);
+
+DROP TABLE read_redeems;
+DROP TABLE write_redeems;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "add-time_unit-column-to-allocations",
+		Up: `
+ALTER TABLE allocations
+    ADD COLUMN time_unit BIGINT NOT NULL DEFAULT 172800000000000;
+`,
+		Down: `
+ALTER TABLE allocations DROP COLUMN time_unit;
+`,
+	},
+	{
+		Version: 11,
+		Name:    "add-payer_id-and-auth_tiket-columns-to-read_markers",
+		Up: `
+ALTER TABLE read_markers ADD COLUMN payer_id VARCHAR(64) NOT NULL;
+ALTER TABLE read_markers ADD COLUMN auth_ticket JSON;
+`,
+		Down: `
+ALTER TABLE read_markers DROP COLUMN payer_id;
+ALTER TABLE read_markers DROP COLUMN auth_ticket;
+`,
+	},
+	{
+		Version: 12,
+		Name:    "add-attributes-column-to-reference_objects",
+		Up: `
+ALTER TABLE reference_objects
+    ADD COLUMN attributes JSON DEFAULT '{}'::jsonb;
+`,
+		Down: `
+ALTER TABLE reference_objects DROP COLUMN attributes;
+`,
+	},
+	{
+		Version: 13,
+		Name:    "add-collaborators-table",
+		Up: `
+CREATE TABLE collaborators (
+    ref_id BIGSERIAL NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+`,
+		Down: `
+DROP TABLE collaborators;
+`,
+	},
+	{
+		Version: 14,
+		Name:    "increase_owner_pubkey",
+		Up: `
+ALTER TABLE allocations
+    ALTER COLUMN owner_public_key TYPE varchar(512);
+ALTER TABLE read_markers
+    ALTER COLUMN client_public_key TYPE varchar(512);
+ALTER TABLE write_markers
+    ALTER COLUMN client_key TYPE varchar(512);
+`,
+		Down: `
+ALTER TABLE allocations ALTER COLUMN owner_public_key TYPE varchar(256);
+ALTER TABLE read_markers ALTER COLUMN client_public_key TYPE varchar(256);
+ALTER TABLE write_markers ALTER COLUMN client_key TYPE varchar(256);
+`,
+	},
+	{
+		Version: 15,
+		Name:    "add-allocation-columns",
+		Up: `
+ALTER TABLE allocations ADD COLUMN repairer_id VARCHAR(64) NOT NULL;
+ALTER TABLE allocations ADD COLUMN is_immutable BOOLEAN NOT NULL;
+`,
+		Down: `
+ALTER TABLE allocations DROP COLUMN repairer_id;
+ALTER TABLE allocations DROP COLUMN is_immutable;
+`,
+	},
+	{
+		Version: 16,
+		Name:    "add-marketplace-table",
+		Up: `
+CREATE TABLE marketplace_share_info (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id VARCHAR(64) NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    file_path_hash TEXT NOT NULL,
+    re_encryption_key TEXT NOT NULL,
+    client_encryption_public_key TEXT NOT NULL,
+    expiry_at TIMESTAMP NULL,
+    revoked BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_marketplace_share_info_for_owner ON marketplace_share_info(owner_id, file_path_hash);
+CREATE INDEX idx_marketplace_share_info_for_client ON marketplace_share_info(client_id, file_path_hash);
+
+CREATE TRIGGER share_info_modtime BEFORE UPDATE ON marketplace_share_info FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+`,
+		Down: `
+DROP TABLE marketplace_share_info;
+`,
+	},
+	{
+		Version: 17,
+		Name:    "add-indexes-to-reference-objects",
+		Up: `
+CREATE INDEX idx_reference_objects_for_lookup_hash ON reference_objects(allocation_id, lookup_hash);
+CREATE INDEX idx_reference_objects_for_path ON reference_objects(allocation_id, path);
+`,
+		Down: `
+DROP INDEX idx_reference_objects_for_lookup_hash;
+DROP INDEX idx_reference_objects_for_path;
+`,
+	},
+	{
+		Version: 18,
+		Name:    "add-resumable-uploads-table",
+		Up: `
+CREATE TABLE resumable_uploads (
+    connection_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    path TEXT NOT NULL,
+    filename VARCHAR(100) NOT NULL,
+    upload_length BIGINT NOT NULL DEFAULT 0,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (connection_id, path)
+);
+
+CREATE TRIGGER resumable_uploads_modtime BEFORE UPDATE ON resumable_uploads FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+`,
+		Down: `
+DROP TABLE resumable_uploads;
+`,
+	},
+	{
+		Version: 19,
+		Name:    "read-markers-per-allocation-and-payer",
+		Up: `
+ALTER TABLE read_markers
+    DROP CONSTRAINT read_markers_pkey;
+
+ALTER TABLE read_markers
+    ADD PRIMARY KEY (client_id, allocation_id, payer_id);
+
+CREATE INDEX idx_read_markers_allocation_id ON read_markers(allocation_id);
+`,
+		Down: `
+DROP INDEX idx_read_markers_allocation_id;
+ALTER TABLE read_markers DROP CONSTRAINT read_markers_pkey;
+ALTER TABLE read_markers ADD PRIMARY KEY (client_id);
+`,
+		SQLiteUp: `
+CREATE TABLE read_markers_new (
+    client_id VARCHAR(64) NOT NULL,
+    client_public_key VARCHAR(512) NOT NULL,
+    blobber_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    owner_id VARCHAR(64) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    counter BIGINT NOT NULL DEFAULT 0,
+    signature VARCHAR(256) NOT NULL,
+    latest_redeemed_rm JSON,
+    redeem_required boolean,
+    latest_redeem_txn_id VARCHAR(64),
+    status_message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    suspend BIGINT NOT NULL DEFAULT -1,
+    payer_id VARCHAR(64) NOT NULL DEFAULT '',
+    auth_ticket JSON,
+    PRIMARY KEY (client_id, allocation_id, payer_id)
+);
+
+INSERT INTO read_markers_new SELECT * FROM read_markers;
+
+DROP TABLE read_markers;
+ALTER TABLE read_markers_new RENAME TO read_markers;
+
+CREATE INDEX idx_read_markers_allocation_id ON read_markers(allocation_id);
+
+` + sqliteModTime("read_markers_modtime", "read_markers"),
+	},
+	{
+		Version: 20,
+		Name:    "add-outgoing-transactions-table",
+		Up: `
+CREATE TABLE outgoing_transactions (
+    seq BIGSERIAL PRIMARY KEY,
+    lane VARCHAR(200) NOT NULL,
+    kind VARCHAR(64) NOT NULL,
+    ref_id VARCHAR(200) NOT NULL,
+    sc_address VARCHAR(64) NOT NULL,
+    sc_name VARCHAR(64) NOT NULL,
+    sc_input TEXT NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    status SMALLINT NOT NULL DEFAULT 0,
+    txn_hash VARCHAR(64),
+    prev_txn_hashes TEXT,
+    txn_output TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    submitted_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_outgoing_transactions_status ON outgoing_transactions(status, next_attempt_at);
+CREATE INDEX idx_outgoing_transactions_lane ON outgoing_transactions(lane, seq);
+CREATE INDEX idx_outgoing_transactions_ref ON outgoing_transactions(kind, ref_id);
+
+CREATE TRIGGER outgoing_transactions_modtime BEFORE UPDATE ON outgoing_transactions FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+`,
+		Down: `
+DROP TABLE outgoing_transactions;
+`,
+	},
+	{
+		Version: 21,
+		Name:    "add-price-history-table",
+		Up: `
+CREATE TABLE price_history (
+    id BIGSERIAL PRIMARY KEY,
+    read_price BIGINT NOT NULL,
+    write_price BIGINT NOT NULL,
+    dynamic BOOLEAN NOT NULL DEFAULT FALSE,
+    utilization DOUBLE PRECISION NOT NULL DEFAULT 0,
+    read_bandwidth DOUBLE PRECISION NOT NULL DEFAULT 0,
+    txn_hash VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_price_history_created_at ON price_history(created_at);
+`,
+		Down: `
+DROP TABLE price_history;
+`,
+	},
+	{
+		Version: 22,
+		Name:    "add-earnings-ledger-table",
+		Up: `
+CREATE TABLE earnings_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    client_id VARCHAR(64) NOT NULL DEFAULT '',
+    payer_id VARCHAR(64) NOT NULL DEFAULT '',
+    ref_id VARCHAR(200) NOT NULL,
+    tokens BIGINT NOT NULL DEFAULT 0,
+    num_blocks BIGINT NOT NULL DEFAULT 0,
+    size BIGINT NOT NULL DEFAULT 0,
+    txn_hash VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_earnings_ledger_unique ON earnings_ledger(kind, ref_id, txn_hash);
+CREATE INDEX idx_earnings_ledger_allocation ON earnings_ledger(allocation_id, created_at);
+CREATE INDEX idx_earnings_ledger_client ON earnings_ledger(client_id, created_at);
+CREATE INDEX idx_earnings_ledger_payer ON earnings_ledger(payer_id, created_at);
+CREATE INDEX idx_earnings_ledger_created_at ON earnings_ledger(created_at);
+`,
+		Down: `
+DROP TABLE earnings_ledger;
+`,
+	},
+	{
+		Version: 23,
+		Name:    "add-pool-cache-table",
+		Up: `
+CREATE TABLE pool_cache (
+    kind VARCHAR(8) NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    blobber_id VARCHAR(64) NOT NULL,
+    refreshed_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (kind, client_id, allocation_id, blobber_id)
+);
+
+CREATE INDEX idx_pool_cache_refreshed_at ON pool_cache(refreshed_at);
+`,
+		Down: `
+DROP TABLE pool_cache;
+`,
+	},
+	{
+		Version: 24,
+		Name:    "add-challenge-deadline-columns",
+		Up: `
+ALTER TABLE challenges ADD COLUMN created BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE challenges ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+
+UPDATE challenges SET created = EXTRACT(EPOCH FROM created_at)::BIGINT;
+
+CREATE INDEX idx_challenges_status ON challenges(status);
+`,
+		Down: `
+DROP INDEX idx_challenges_status;
+ALTER TABLE challenges DROP COLUMN attempts;
+ALTER TABLE challenges DROP COLUMN created;
+`,
+	},
+	{
+		Version: 25,
+		Name:    "add-challenge-history-indexes",
+		Up: `
+CREATE INDEX idx_challenges_allocation_created ON challenges(allocation_id, created);
+CREATE INDEX idx_challenges_created ON challenges(created);
+CREATE INDEX idx_challenges_ref_id ON challenges(ref_id);
+`,
+		Down: `
+DROP INDEX idx_challenges_allocation_created;
+DROP INDEX idx_challenges_created;
+DROP INDEX idx_challenges_ref_id;
+`,
+	},
+	{
+		Version: 26,
+		Name:    "create-indexes",
+		Up: `
+DROP INDEX IF EXISTS path_idx;
+DROP INDEX IF EXISTS update_idx;
+CREATE INDEX path_idx ON reference_objects (path);
+CREATE INDEX update_idx ON reference_objects (updated_at);
+`,
+		Down: `
+DROP INDEX path_idx;
+DROP INDEX update_idx;
+`,
+	},
+	{
+		Version: 27,
+		Name:    "add-leader-leases-table",
+		Up: `
+CREATE TABLE leader_leases (
+    name VARCHAR(64) PRIMARY KEY,
+    holder VARCHAR(200) NOT NULL DEFAULT '',
+    acquired_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL DEFAULT 0
+);
+`,
+		Down: `
+DROP TABLE leader_leases;
+`,
+	},
+	{
+		Version: 28,
+		Name:    "add-challenge-completion-time-column",
+		Up: `
+ALTER TABLE challenges ADD COLUMN completion_time BIGINT NOT NULL DEFAULT 0;
+`,
+		Down: `
+ALTER TABLE challenges DROP COLUMN completion_time;
+`,
+	},
+	{
+		Version: 29,
+		Name:    "add-outgoing-transactions-callback-attempts-column",
+		Up: `
+ALTER TABLE outgoing_transactions ADD COLUMN callback_attempts INT NOT NULL DEFAULT 0;
+`,
+		Down: `
+ALTER TABLE outgoing_transactions DROP COLUMN callback_attempts;
+`,
+	},
+	{
+		Version: 30,
+		Name:    "add-resumable-uploads-hash-state-column",
+		Up: `
+ALTER TABLE resumable_uploads ADD COLUMN hash_state BYTEA;
+`,
+		Down: `
+ALTER TABLE resumable_uploads DROP COLUMN hash_state;
+`,
+	},
+}
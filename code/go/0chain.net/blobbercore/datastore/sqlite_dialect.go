@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sqliteRules translate the Postgres statements of the migrations to
+// SQLite. The BIGSERIAL primary keys are INTEGER ones, the types aren't
+// enforced by SQLite so the columns aren't altered to change them.
+var sqliteRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?s)CREATE OR REPLACE FUNCTION update_modified_column\(\).*?\$\$ language 'plpgsql';`), ""},
+	{regexp.MustCompile(`(?i)\bBIGSERIAL PRIMARY KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\bBIGSERIAL\b`), "INTEGER"},
+	{regexp.MustCompile(`(?i)\bNOW\(\)`), "CURRENT_TIMESTAMP"},
+	{regexp.MustCompile(`(?i)EXTRACT\(EPOCH FROM (\w+)\)::BIGINT`), "CAST(strftime('%s', $1) AS BIGINT)"},
+	{regexp.MustCompile(`::jsonb\b`), ""},
+	{regexp.MustCompile(`(?i)\s+CASCADE;`), ";"},
+	{regexp.MustCompile(`(?i)ALTER TABLE \w+\s+ALTER COLUMN \w+ TYPE [^;]+;`), ""},
+}
+
+var (
+	sqliteTable      = regexp.MustCompile(`(?s)CREATE TABLE (\w+)\s*\((.*?)\n\);`)
+	sqliteSerial     = regexp.MustCompile(`(?i)(\w+)\s+BIGSERIAL\s+UNIQUE`)
+	sqliteModTrigger = regexp.MustCompile(`(?i)CREATE TRIGGER (\w+) BEFORE UPDATE ON (\w+) FOR EACH ROW EXECUTE PROCEDURE\s+update_modified_column\(\);`)
+	sqliteNotNull    = regexp.MustCompile(`(?i)ADD COLUMN\s+\w+\s+(\w+)[^;]*?NOT NULL\s*;`)
+)
+
+// sqliteStatements returns the statements of a migration for SQLite.
+func sqliteStatements(sql string) string {
+	// the unique BIGSERIAL columns are set from the rowid
+	sql = sqliteTable.ReplaceAllStringFunc(sql, func(table string) string {
+		m := sqliteTable.FindStringSubmatch(table)
+		for _, serial := range sqliteSerial.FindAllStringSubmatch(m[2], -1) {
+			table += sqliteSequence(m[1], serial[1])
+		}
+		return table
+	})
+	sql = sqliteModTrigger.ReplaceAllStringFunc(sql, func(trigger string) string {
+		m := sqliteModTrigger.FindStringSubmatch(trigger)
+		return sqliteModTime(m[1], m[2])
+	})
+	// a column added NOT NULL needs a default value
+	sql = sqliteNotNull.ReplaceAllStringFunc(sql, func(column string) string {
+		if strings.Contains(strings.ToUpper(column), "DEFAULT") {
+			return column
+		}
+		def := "''"
+		switch strings.ToUpper(sqliteNotNull.FindStringSubmatch(column)[1]) {
+		case "BOOLEAN":
+			def = "FALSE"
+		case "INT", "INTEGER", "BIGINT", "SMALLINT":
+			def = "0"
+		}
+		return strings.TrimSuffix(strings.TrimSpace(column), ";") + " DEFAULT " + def + ";"
+	})
+	for _, rule := range sqliteRules {
+		sql = rule.re.ReplaceAllString(sql, rule.repl)
+	}
+	return sql
+}
+
+// sqliteSequence returns the trigger setting the column of a row inserted
+// without it to the rowid, like a Postgres sequence.
+func sqliteSequence(table, column string) string {
+	return `
+
+CREATE TRIGGER ` + table + `_` + column + ` AFTER INSERT ON ` + table + `
+    FOR EACH ROW WHEN NEW.` + column + ` IS NULL
+BEGIN
+    UPDATE ` + table + ` SET ` + column + ` = NEW.rowid WHERE rowid = NEW.rowid;
+END;`
+}
+
+// sqliteModTime returns the trigger setting the updated_at column of an
+// updated row of the table to the current time, like the Postgres
+// update_modified_column.
+func sqliteModTime(name, table string) string {
+	return `CREATE TRIGGER ` + name + ` AFTER UPDATE ON ` + table + `
+    FOR EACH ROW
+BEGIN
+    UPDATE ` + table + ` SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;`
+}
@@ -0,0 +1,36 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStatements(t *testing.T) {
+	sql := sqliteStatements(`
+CREATE TABLE things (
+    id BIGSERIAL PRIMARY KEY,
+    sequence BIGSERIAL UNIQUE,
+    attributes JSON DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER things_modtime BEFORE UPDATE ON things FOR EACH ROW EXECUTE PROCEDURE  update_modified_column();
+
+ALTER TABLE things ADD COLUMN owner_id VARCHAR(64) NOT NULL;
+ALTER TABLE things ADD COLUMN size BIGINT NOT NULL;
+ALTER TABLE things ALTER COLUMN owner_id TYPE varchar(512);
+UPDATE things SET size = EXTRACT(EPOCH FROM created_at)::BIGINT;
+`)
+
+	require.Contains(t, sql, "id INTEGER PRIMARY KEY AUTOINCREMENT,")
+	require.Contains(t, sql, "sequence INTEGER UNIQUE,")
+	require.Contains(t, sql, "CREATE TRIGGER things_sequence AFTER INSERT ON things")
+	require.Contains(t, sql, "attributes JSON DEFAULT '{}',")
+	require.Contains(t, sql, "DEFAULT CURRENT_TIMESTAMP")
+	require.Contains(t, sql, "CREATE TRIGGER things_modtime AFTER UPDATE ON things")
+	require.Contains(t, sql, "ADD COLUMN owner_id VARCHAR(64) NOT NULL DEFAULT '';")
+	require.Contains(t, sql, "ADD COLUMN size BIGINT NOT NULL DEFAULT 0;")
+	require.NotContains(t, sql, "ALTER COLUMN")
+	require.Contains(t, sql, "SET size = CAST(strftime('%s', created_at) AS BIGINT);")
+}
@@ -3,12 +3,15 @@ package datastore
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
@@ -32,28 +35,75 @@ func GetStore() *Store {
 	return &store
 }
 
+// The drivers of the meta data DB.
+const (
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+)
+
 func (store *Store) Open() error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	// Enable Logger, show detailed log
+	//db.LogMode(true)
+	store.db = db
+	return nil
+}
+
+// OpenDB opens the meta data DB of the configured driver, its schema is
+// created by Migrate.
+func OpenDB() (*gorm.DB, error) {
+	switch config.Configuration.DBDriver {
+	case PostgresDriver, "":
+		return openPostgres()
+	case SQLiteDriver:
+		return openSQLite(config.Configuration.DBPath)
+	default:
+		return nil, common.NewErrorf("db_open_error", "Unknown DB driver: %v",
+			config.Configuration.DBDriver)
+	}
+}
+
+func openPostgres() (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(fmt.Sprintf(
 		"host=%v port=%v user=%v dbname=%v password=%v sslmode=disable",
 		config.Configuration.DBHost, config.Configuration.DBPort,
 		config.Configuration.DBUserName, config.Configuration.DBName,
 		config.Configuration.DBPassword)), &gorm.Config{})
 	if err != nil {
-		return common.NewErrorf("db_open_error", "Error opening the DB connection: %v", err)
+		return nil, common.NewErrorf("db_open_error", "Error opening the DB connection: %v", err)
 	}
 
 	sqldb, err := db.DB()
 	if err != nil {
-		return common.NewErrorf("db_open_error", "Error opening the DB connection: %v", err)
+		return nil, common.NewErrorf("db_open_error", "Error opening the DB connection: %v", err)
 	}
 
 	sqldb.SetMaxIdleConns(100)
 	sqldb.SetMaxOpenConns(200)
 	sqldb.SetConnMaxLifetime(30 * time.Second)
-	// Enable Logger, show detailed log
-	//db.LogMode(true)
-	store.db = db
-	return nil
+	return db, nil
+}
+
+func openSQLite(path string) (*gorm.DB, error) {
+	if path == "" {
+		return nil, common.NewError("db_open_error", "No path of the SQLite DB")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, common.NewErrorf("db_open_error", "Error creating the SQLite DB directory: %v", err)
+	}
+
+	// the transactions take the write lock when they begin, the others wait
+	// for it instead of failing on the first write
+	db, err := gorm.Open(sqlite.Open("file:"+path+
+		"?_busy_timeout=10000&_journal_mode=WAL&_foreign_keys=1&_txlock=immediate"),
+		&gorm.Config{})
+	if err != nil {
+		return nil, common.NewErrorf("db_open_error", "Error opening the SQLite DB: %v", err)
+	}
+	return db, nil
 }
 
 func (store *Store) Close() {
@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobber_meta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config.Configuration.DBDriver = SQLiteDriver
+	config.Configuration.DBPath = filepath.Join(dir, "data", "blobber_meta.db")
+	defer func() { config.Configuration.DBDriver = "" }()
+
+	db, err := OpenDB()
+	require.NoError(t, err)
+	require.NoError(t, Migrate(db, LatestVersion()))
+
+	require.NoError(t, db.Exec(
+		"INSERT INTO challenges (challenge_id, allocation_id) VALUES (?, ?), (?, ?)",
+		"c1", "a1", "c2", "a1").Error)
+	var sequences []int64
+	require.NoError(t, db.Table("challenges").Order("challenge_id").
+		Pluck("sequence", &sequences).Error)
+	require.Len(t, sequences, 2)
+	require.True(t, sequences[0] > 0 && sequences[1] > sequences[0])
+
+	var before, after time.Time
+	require.NoError(t, db.Table("challenges").Where("challenge_id = ?", "c1").
+		Select("updated_at").Row().Scan(&before))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, db.Exec("UPDATE challenges SET status = 1 WHERE challenge_id = ?", "c1").Error)
+	require.NoError(t, db.Table("challenges").Where("challenge_id = ?", "c1").
+		Select("updated_at").Row().Scan(&after))
+	require.True(t, after.After(before))
+
+	// the foreign keys are enforced
+	require.Error(t, db.Exec("INSERT INTO terms (blobber_id, allocation_id, read_price, write_price) "+
+		"VALUES ('b1', 'missing', 1, 1)").Error)
+
+	// the data survives a restart
+	sqldb, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqldb.Close())
+	db, err = OpenDB()
+	require.NoError(t, err)
+	require.NoError(t, Migrate(db, LatestVersion()))
+	var count int64
+	require.NoError(t, db.Table("challenges").Count(&count).Error)
+	require.EqualValues(t, 2, count)
+	sqldb, err = db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqldb.Close())
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	config.Configuration.DBDriver = "mysql"
+	defer func() { config.Configuration.DBDriver = "" }()
+
+	_, err := OpenDB()
+	require.Error(t, err)
+}
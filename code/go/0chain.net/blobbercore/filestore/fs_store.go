@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha1"
+	"encoding"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -353,9 +354,56 @@ func (fs *FileFSStore) DeleteTempFile(allocationID string, fileData *FileInputDa
 
 	fileObjectPath := fs.generateTempPath(allocation, fileData, connectionID)
 
+	partsPath := generatePartsPath(fileObjectPath)
+	if _, err := os.Stat(partsPath); err == nil {
+		if err := os.RemoveAll(partsPath); err != nil {
+			return err
+		}
+		//parts have not been assembled into temp file yet
+		if _, err := os.Stat(fileObjectPath); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
 	return os.Remove(fileObjectPath)
 }
 
+//HashOfState returns sha1 hash of the bytes of the resumable upload written already, from the
+//hash state kept with the upload, so the temp file isn't read again
+func HashOfState(state []byte) (string, error) {
+	h := sha1.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return "", common.NewError("invalid_hash_state", err.Error())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//resumeHash returns sha1 hash of the bytes of the temp file before the upload offset. It's restored
+//from the state of the previous chunk, the bytes are read again only if the chunk is not appended
+//right after the previous one
+func resumeHash(tempFilePath string, fileData *FileInputData) (hash.Hash, error) {
+	h := sha1.New()
+	if len(fileData.HashState) > 0 {
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(fileData.HashState); err != nil {
+			return nil, common.NewError("invalid_hash_state", err.Error())
+		}
+		return h, nil
+	}
+	if fileData.UploadOffset == 0 {
+		return h, nil
+	}
+
+	file, err := os.Open(tempFilePath)
+	if err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+	defer file.Close()
+	if _, err = io.CopyN(h, file, fileData.UploadOffset); err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+	return h, nil
+}
+
 func (fs *FileFSStore) generateTempPath(allocation *StoreAllocation, fileData *FileInputData, connectionID string) string {
 	return filepath.Join(allocation.TempObjectsPath, fileData.Name+"."+encryption.Hash(fileData.Path)+"."+connectionID)
 }
@@ -416,7 +464,7 @@ func (fs *FileFSStore) DeleteFile(allocationID string, contentHash string) error
 	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
 	fileObjectPath = filepath.Join(fileObjectPath, destFile)
 
-	if config.Configuration.ColdStorageDeleteCloudCopy {
+	if config.Get().ColdStorageDeleteCloudCopy {
 		err = fs.RemoveFromCloud(contentHash)
 		if err != nil {
 			Logger.Error("Unable to delete object from minio", zap.Error(err))
@@ -519,14 +567,32 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 	var fileReader io.Reader = infile
 
 	if fileData.IsResumable {
+		//check the chunk before it's written, so a corrupted one doesn't overwrite the bytes written already
 		h := sha1.New()
-		offset, err := dest.WriteChunk(context.TODO(), fileData.UploadOffset, io.TeeReader(fileReader, h))
+		if _, err := io.Copy(h, infile); err != nil {
+			return nil, common.NewError("file_read_error", err.Error())
+		}
+		fileRef.ContentHash = hex.EncodeToString(h.Sum(nil))
+		if len(fileData.ChunkHash) > 0 && fileData.ChunkHash != fileRef.ContentHash {
+			return nil, common.NewError("checksum_mismatch", "Upload-Checksum does not match the uploaded chunk")
+		}
+		if _, err := infile.Seek(0, io.SeekStart); err != nil {
+			return nil, common.NewError("file_read_error", err.Error())
+		}
 
+		uploaded, err := resumeHash(tempFilePath, fileData)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := dest.WriteChunk(context.TODO(), fileData.UploadOffset, io.TeeReader(fileReader, uploaded))
+		if err != nil {
+			return nil, common.NewError("file_write_error", err.Error())
+		}
+		fileRef.HashState, err = uploaded.(encoding.BinaryMarshaler).MarshalBinary()
 		if err != nil {
 			return nil, common.NewError("file_write_error", err.Error())
 		}
 
-		fileRef.ContentHash = hex.EncodeToString(h.Sum(nil))
 		fileRef.Size = dest.Size()
 		fileRef.Name = fileData.Name
 		fileRef.Path = fileData.Path
@@ -541,6 +607,40 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 		fileReader = dest
 	}
 
+	var dst io.Writer = dest
+	if fileData.IsResumable {
+		//all chunks have been written, only read bytes from local file , and compute hash
+		dst = ioutil.Discard
+	}
+
+	fileSize, contentHash, merkleRoot, err := writeAndHash(dst, fileReader)
+	if err != nil {
+		return nil, err
+	}
+
+	//only update hash for whole file when it is not a resumable upload or is final chunk.
+	if !fileData.IsResumable || fileData.IsFinal {
+		fileRef.ContentHash = contentHash
+	}
+
+	//whole file is the chunk for the non-resumable upload
+	if !fileData.IsResumable && len(fileData.ChunkHash) > 0 && fileData.ChunkHash != fileRef.ContentHash {
+		return nil, common.NewError("checksum_mismatch", "Upload-Checksum does not match the uploaded file")
+	}
+
+	fileRef.Size = fileSize
+	fileRef.Name = fileData.Name
+	fileRef.Path = fileData.Path
+	fileRef.MerkleRoot = merkleRoot
+	fileRef.UploadOffset = fileSize
+	fileRef.UploadLength = fileData.UploadLength
+
+	return fileRef, nil
+}
+
+//writeAndHash copies content of the reader into dest, and computes the sha1 and the merkle root of the content
+func writeAndHash(dest io.Writer, fileReader io.Reader) (int64, string, string, error) {
+	var err error
 	h := sha1.New()
 	bytesBuffer := bytes.NewBuffer(nil)
 	multiHashWriter := io.MultiWriter(h, bytesBuffer)
@@ -553,16 +653,10 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 	fileSize := int64(0)
 	for {
 		var written int64
-
-		if fileData.IsResumable {
-			//all chunks have been written, only read bytes from local file , and compute hash
-			written, err = io.CopyN(ioutil.Discard, tReader, CHUNK_SIZE)
-		} else {
-			written, err = io.CopyN(dest, tReader, CHUNK_SIZE)
-		}
+		written, err = io.CopyN(dest, tReader, CHUNK_SIZE)
 
 		if err != io.EOF && err != nil {
-			return nil, common.NewError("file_write_error", err.Error())
+			return 0, "", "", common.NewError("file_write_error", err.Error())
 		}
 		fileSize += written
 		dataBytes := bytesBuffer.Bytes()
@@ -588,19 +682,83 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 	var mt util.MerkleTreeI = &util.MerkleTree{}
 	mt.ComputeTree(merkleLeaves)
 
-	//only update hash for whole file when it is not a resumable upload or is final chunk.
-	if !fileData.IsResumable || fileData.IsFinal {
-		fileRef.ContentHash = hex.EncodeToString(h.Sum(nil))
+	return fileSize, hex.EncodeToString(h.Sum(nil)), mt.GetRoot(), nil
+}
+
+//PatchFile creates a new version of the stored object given by fileData.Hash in the temp file of the connection.
+//Content of infile replaces the bytes of the object starting at the offset, and extends the object if it goes
+//beyond the end of it. The unchanged bytes are copied from the object, so client doesn't upload them again.
+func (fs *FileFSStore) PatchFile(allocationID string, fileData *FileInputData, offset int64,
+	infile multipart.File, connectionID string) (*FileOutputData, error) {
+
+	allocation, err := fs.SetupAllocation(allocationID, false)
+	if err != nil {
+		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
 	}
 
-	fileRef.Size = fileSize
-	fileRef.Name = fileData.Name
-	fileRef.Path = fileData.Path
-	fileRef.MerkleRoot = mt.GetRoot()
-	fileRef.UploadOffset = fileSize
-	fileRef.UploadLength = fileData.UploadLength
+	dirPath, destFile := GetFilePathFromHash(fileData.Hash)
+	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath, destFile)
+	if _, err = os.Stat(fileObjectPath); os.IsNotExist(err) && fileData.OnCloud {
+		if err = fs.DownloadFromCloud(fileData.Hash, fileObjectPath); err != nil {
+			return nil, common.NewError("minio_download_failed", "Unable to download from minio with err "+err.Error())
+		}
+	}
 
-	return fileRef, nil
+	object, err := os.Open(fileObjectPath)
+	if err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+	defer object.Close()
+
+	objectInfo, err := object.Stat()
+	if err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+
+	objectSize := objectInfo.Size()
+	if offset < 0 || offset > objectSize {
+		return nil, common.NewError("invalid_offset", "Offset should be within the file or at the end of it")
+	}
+
+	patchSize, err := infile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+	if _, err = infile.Seek(0, io.SeekStart); err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+
+	h := sha1.New()
+	readers := []io.Reader{io.NewSectionReader(object, 0, offset), io.TeeReader(infile, h)}
+	if tail := offset + patchSize; tail < objectSize {
+		readers = append(readers, io.NewSectionReader(object, tail, objectSize-tail))
+	}
+
+	dest, err := os.Create(fs.generateTempPath(allocation, fileData, connectionID))
+	if err != nil {
+		return nil, common.NewError("file_creation_error", err.Error())
+	}
+	defer dest.Close()
+
+	//every merkle leaf covers a segment of each 64KB block of the file, so all leaves are computed in the same pass
+	fileSize, contentHash, merkleRoot, err := writeAndHash(dest, io.MultiReader(readers...))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fileData.ChunkHash) > 0 && fileData.ChunkHash != hex.EncodeToString(h.Sum(nil)) {
+		return nil, common.NewError("checksum_mismatch", "Upload-Checksum does not match the uploaded patch")
+	}
+
+	return &FileOutputData{
+		Name:         fileData.Name,
+		Path:         fileData.Path,
+		ContentHash:  contentHash,
+		MerkleRoot:   merkleRoot,
+		Size:         fileSize,
+		UploadOffset: fileSize,
+		UploadLength: fileSize,
+	}, nil
 }
 
 func (fs *FileFSStore) IterateObjects(allocationID string, handler FileObjectHandler) error {
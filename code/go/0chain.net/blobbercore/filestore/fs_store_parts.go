@@ -0,0 +1,204 @@
+package filestore
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+)
+
+const (
+	partsDirSuffix          = ".parts"
+	maxMissingPartsReported = 10
+)
+
+//generatePartsPath returns the directory the parts of the multipart upload are kept in
+func generatePartsPath(tempFilePath string) string {
+	return tempFilePath + partsDirSuffix
+}
+
+//WritePart stores a single part of the multipart upload. Parts are independent of each other,
+//so they can be uploaded in any order. The part is checked against its Upload-Checksum, which
+//is required, as a corrupted part would be noticed only when the whole file is assembled.
+func (fs *FileFSStore) WritePart(allocationID string, fileData *FileInputData,
+	infile multipart.File, connectionID string) (*FileOutputData, error) {
+
+	if fileData.PartNumber < 1 {
+		return nil, common.NewError("invalid_part_number", "Part number should be greater than 0")
+	}
+	if len(fileData.ChunkHash) == 0 {
+		return nil, common.NewError("checksum_required", "Upload-Checksum is required for the parts")
+	}
+
+	allocation, err := fs.SetupAllocation(allocationID, false)
+	if err != nil {
+		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+
+	partsPath := generatePartsPath(fs.generateTempPath(allocation, fileData, connectionID))
+	if err = createDirs(partsPath); err != nil {
+		return nil, common.NewError("file_creation_error", err.Error())
+	}
+
+	//write into unique file first, so concurrent uploads of the same part don't corrupt each other
+	dest, err := ioutil.TempFile(partsPath, "upload")
+	if err != nil {
+		return nil, common.NewError("file_creation_error", err.Error())
+	}
+	defer os.Remove(dest.Name()) //nolint:errcheck // it is renamed on success
+	defer dest.Close()
+
+	h := sha1.New()
+	size, err := io.Copy(dest, io.TeeReader(infile, h))
+	if err != nil {
+		return nil, common.NewError("file_write_error", err.Error())
+	}
+
+	contentHash := hex.EncodeToString(h.Sum(nil))
+	if fileData.ChunkHash != contentHash {
+		return nil, common.NewError("checksum_mismatch", "Upload-Checksum does not match the uploaded part")
+	}
+
+	if err = dest.Close(); err != nil {
+		return nil, common.NewError("file_write_error", err.Error())
+	}
+
+	err = os.Rename(dest.Name(), filepath.Join(partsPath, strconv.Itoa(fileData.PartNumber)))
+	if err != nil {
+		return nil, common.NewError("file_write_error", err.Error())
+	}
+
+	return &FileOutputData{
+		Name:         fileData.Name,
+		Path:         fileData.Path,
+		ContentHash:  contentHash,
+		Size:         size,
+		UploadLength: fileData.UploadLength,
+	}, nil
+}
+
+//ListParts returns the parts of the multipart upload that have been stored already, ordered by number
+func (fs *FileFSStore) ListParts(allocationID string, fileData *FileInputData, connectionID string) ([]*FilePart, error) {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return nil, common.NewError("invalid_allocation", "Invalid allocation. "+err.Error())
+	}
+
+	partsPath := generatePartsPath(fs.generateTempPath(allocation, fileData, connectionID))
+	files, err := ioutil.ReadDir(partsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*FilePart{}, nil
+		}
+		return nil, err
+	}
+
+	parts := make([]*FilePart, 0, len(files))
+	for _, f := range files {
+		number, err := strconv.Atoi(f.Name())
+		if err != nil || f.IsDir() {
+			continue // part which is being uploaded now
+		}
+		parts = append(parts, &FilePart{Number: number, Size: f.Size()})
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+
+	return parts, nil
+}
+
+//AssembleParts concatenates parts 1..numParts into the temp file of the connection and computes
+//the content hash and the merkle root of the whole file. The parts are removed on success.
+func (fs *FileFSStore) AssembleParts(allocationID string, fileData *FileInputData,
+	numParts int, connectionID string) (*FileOutputData, error) {
+
+	if numParts < 1 {
+		return nil, common.NewError("invalid_parameters", "Number of parts should be greater than 0")
+	}
+
+	allocation, err := fs.SetupAllocation(allocationID, false)
+	if err != nil {
+		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+
+	tempFilePath := fs.generateTempPath(allocation, fileData, connectionID)
+	partsPath := generatePartsPath(tempFilePath)
+
+	parts, err := fs.ListParts(allocationID, fileData, connectionID)
+	if err != nil {
+		return nil, common.NewError("file_read_error", err.Error())
+	}
+	stored := make(map[int]bool, len(parts))
+	for _, part := range parts {
+		stored[part.Number] = true
+	}
+
+	//list a few of the missing parts only, numParts can be large
+	var missing []string
+	numMissing := 0
+	for i := 1; i <= numParts; i++ {
+		if stored[i] {
+			continue
+		}
+		if numMissing < maxMissingPartsReported {
+			missing = append(missing, strconv.Itoa(i))
+		}
+		numMissing++
+	}
+	if numMissing > len(missing) {
+		missing = append(missing, fmt.Sprintf("and %d more", numMissing-len(missing)))
+	}
+	if numMissing > 0 {
+		return nil, common.NewError("missing_parts", "Parts are missing: "+strings.Join(missing, ","))
+	}
+
+	readers := make([]io.Reader, 0, numParts)
+	for i := 1; i <= numParts; i++ {
+		f, err := os.Open(filepath.Join(partsPath, strconv.Itoa(i)))
+		if err != nil {
+			return nil, common.NewError("file_read_error", err.Error())
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	dest, err := os.Create(tempFilePath)
+	if err != nil {
+		return nil, common.NewError("file_creation_error", err.Error())
+	}
+	defer dest.Close()
+
+	fileSize, contentHash, merkleRoot, err := writeAndHash(dest, io.MultiReader(readers...))
+	if err != nil {
+		return nil, err
+	}
+
+	if fileData.UploadLength > 0 && fileData.UploadLength != fileSize {
+		return nil, common.NewError("invalid_upload_length", "Size of the assembled parts does not match the upload length")
+	}
+
+	if err = os.RemoveAll(partsPath); err != nil {
+		return nil, common.NewError("file_delete_error", err.Error())
+	}
+
+	return &FileOutputData{
+		Name:         fileData.Name,
+		Path:         fileData.Path,
+		ContentHash:  contentHash,
+		MerkleRoot:   merkleRoot,
+		Size:         fileSize,
+		UploadOffset: fileSize,
+		UploadLength: fileData.UploadLength,
+	}, nil
+}
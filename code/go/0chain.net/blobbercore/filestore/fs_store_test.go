@@ -0,0 +1,102 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAllocationID = "4f928c7857fabb5737347c42204eea919a4777f893f35724f563b932f64e2367"
+
+type testMultipartFile struct {
+	*bytes.Reader
+}
+
+func (testMultipartFile) Close() error {
+	return nil
+}
+
+func newTestMultipartFile(data string) testMultipartFile {
+	return testMultipartFile{bytes.NewReader([]byte(data))}
+}
+
+func sha1Hex(data string) string {
+	h := sha1.New()
+	h.Write([]byte(data)) //nolint:errcheck
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestFileFSStore_ResumableUpload(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "blobber_fs_store")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	fs := &FileFSStore{RootDirectory: rootDir}
+
+	chunk1 := "this is 1st chunk"
+	chunk2 := "this is 2nd chunk"
+	chunk3 := "this is 3rd chunk"
+	fileData := &FileInputData{
+		Name:         "file.txt",
+		Path:         "/file.txt",
+		IsResumable:  true,
+		UploadLength: int64(len(chunk1 + chunk2 + chunk3)),
+		ChunkHash:    sha1Hex(chunk1),
+	}
+	allocation, err := fs.SetupAllocation(testAllocationID, false)
+	require.NoError(t, err)
+	tempFilePath := fs.generateTempPath(allocation, fileData, "connection_id")
+	tempFile := func() string {
+		data, err := ioutil.ReadFile(tempFilePath)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	out, err := fs.WriteFile(testAllocationID, fileData, newTestMultipartFile(chunk1), "connection_id")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(chunk1)), out.UploadOffset)
+	hash, err := HashOfState(out.HashState)
+	require.NoError(t, err)
+	assert.Equal(t, sha1Hex(chunk1), hash)
+
+	// corrupted chunk is rejected and the bytes written already are kept
+	fileData.UploadOffset = out.UploadOffset
+	fileData.HashState = out.HashState
+	fileData.ChunkHash = sha1Hex("something else")
+	_, err = fs.WriteFile(testAllocationID, fileData, newTestMultipartFile(chunk2), "connection_id")
+	require.Error(t, err)
+	assert.Equal(t, chunk1, tempFile())
+
+	fileData.ChunkHash = sha1Hex(chunk2)
+	out, err = fs.WriteFile(testAllocationID, fileData, newTestMultipartFile(chunk2), "connection_id")
+	require.NoError(t, err)
+	hash, err = HashOfState(out.HashState)
+	require.NoError(t, err)
+	assert.Equal(t, sha1Hex(chunk1+chunk2), hash)
+
+	// a corrupted chunk resent at an offset written already doesn't cut the later bytes
+	fileData.UploadOffset = 0
+	fileData.HashState = nil
+	fileData.ChunkHash = sha1Hex("something else")
+	_, err = fs.WriteFile(testAllocationID, fileData, newTestMultipartFile(chunk1), "connection_id")
+	require.Error(t, err)
+	assert.Equal(t, chunk1+chunk2, tempFile())
+
+	// the hash is read from the temp file again without the state
+	fileData.UploadOffset = int64(len(chunk1 + chunk2))
+	fileData.ChunkHash = sha1Hex(chunk3)
+	fileData.IsFinal = true
+	out, err = fs.WriteFile(testAllocationID, fileData, newTestMultipartFile(chunk3), "connection_id")
+	require.NoError(t, err)
+	hash, err = HashOfState(out.HashState)
+	require.NoError(t, err)
+	assert.Equal(t, sha1Hex(chunk1+chunk2+chunk3), hash)
+	assert.Equal(t, sha1Hex(chunk1+chunk2+chunk3), out.ContentHash)
+	assert.Equal(t, int64(len(chunk1+chunk2+chunk3)), out.Size)
+}
@@ -23,6 +23,12 @@ type FileInputData struct {
 	UploadOffset int64
 	//IsFinal  the request is final chunk
 	IsFinal bool
+	//ChunkHash is the expected sha1 (hex) of the uploaded chunk, it is sent by client in Upload-Checksum header
+	ChunkHash string
+	//PartNumber is the 1-based number of the part for the multipart upload
+	PartNumber int
+	//HashState is the sha1 state of the bytes of the resumable upload before the UploadOffset
+	HashState []byte
 }
 
 type FileOutputData struct {
@@ -36,6 +42,14 @@ type FileOutputData struct {
 	UploadLength int64
 	//Upload-Offset indicates a byte offset within a resource. The value MUST be a non-negative integer.
 	UploadOffset int64
+	//HashState is the sha1 state of the bytes of the resumable upload before the UploadOffset
+	HashState []byte
+}
+
+//FilePart is a part of the multipart upload that has been stored already
+type FilePart struct {
+	Number int   `json:"part_number"`
+	Size   int64 `json:"size"`
 }
 
 type FileObjectHandler func(contentHash string, contentSize int64)
@@ -43,6 +57,10 @@ type FileObjectHandler func(contentHash string, contentSize int64)
 type FileStore interface {
 	WriteFile(allocationID string, fileData *FileInputData, infile multipart.File, connectionID string) (*FileOutputData, error)
 	DeleteTempFile(allocationID string, fileData *FileInputData, connectionID string) error
+	WritePart(allocationID string, fileData *FileInputData, infile multipart.File, connectionID string) (*FileOutputData, error)
+	ListParts(allocationID string, fileData *FileInputData, connectionID string) ([]*FilePart, error)
+	AssembleParts(allocationID string, fileData *FileInputData, numParts int, connectionID string) (*FileOutputData, error)
+	PatchFile(allocationID string, fileData *FileInputData, offset int64, infile multipart.File, connectionID string) (*FileOutputData, error)
 	CreateDir(dirName string) error
 	DeleteDir(allocationID, dirPath, connectionID string) error
 	GetFileBlock(allocationID string, fileData *FileInputData, blockNum int64, numBlocks int64) ([]byte, error)
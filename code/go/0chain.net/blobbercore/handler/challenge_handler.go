@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/challenge"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultChallenges = 100
+	maxChallenges     = 1000
+)
+
+// challengeFilter reads the 'allocation', 'status', 'result', 'from' and 'to'
+// parameters; the 'to' time is exclusive.
+func challengeFilter(r *http.Request) (*challenge.Filter, error) {
+	from, err := parseLedgerTime(r.FormValue("from"))
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid from passed. "+err.Error())
+	}
+	to, err := parseLedgerTime(r.FormValue("to"))
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid to passed. "+err.Error())
+	}
+	f := &challenge.Filter{
+		AllocationID: r.FormValue("allocation"),
+		From:         from,
+		To:           to,
+	}
+	if v := r.FormValue("status"); v != "" {
+		status, err := challenge.ParseStatus(v)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid status passed. "+err.Error())
+		}
+		f.Status = &status
+	}
+	if v := r.FormValue("result"); v != "" {
+		result, err := challenge.ParseResult(v)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid result passed. "+err.Error())
+		}
+		f.Result = &result
+	}
+	return f, nil
+}
+
+func pageParams(r *http.Request) (offset, limit int, err error) {
+	if offset, err = intParam(r, "offset", 0, 1<<31-1); err != nil {
+		return
+	}
+	if limit, err = intParam(r, "limit", defaultChallenges, maxChallenges); err != nil {
+		return
+	}
+	// challenge.Find doesn't limit by 0
+	if limit == 0 {
+		limit = defaultChallenges
+	}
+	return
+}
+
+// ChallengesHandler returns the challenges of the blobber, the latest first.
+func ChallengesHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	f, err := challengeFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	crs, err := challenge.Find(ctx, f, offset, limit)
+	if err != nil {
+		return nil, common.NewError("challenges", "Error getting the challenges. "+err.Error())
+	}
+	return crs, nil
+}
+
+// ChallengesSummaryHandler returns totals of the challenges per day or per
+// failure reason given by the 'group_by' parameter.
+func ChallengesSummaryHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	f, err := challengeFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	var totals interface{}
+	switch group := r.FormValue("group_by"); group {
+	case "", "day":
+		totals, err = challenge.SummarizeByDay(ctx, f)
+	case "reason":
+		totals, err = challenge.SummarizeByReason(ctx, f)
+	default:
+		return nil, common.NewError("invalid_parameters", "Invalid group_by passed, expected day or reason")
+	}
+	if err != nil {
+		return nil, common.NewError("challenges", "Error summarizing the challenges. "+err.Error())
+	}
+	return totals, nil
+}
+
+// FileChallengesHandler returns the challenge history of the file given by
+// the 'path' parameter.
+func FileChallengesHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	allocationID := mux.Vars(r)["allocation"]
+	path := r.FormValue("path")
+	if path == "" {
+		return nil, common.NewError("invalid_parameters", "Invalid path passed")
+	}
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := challenge.GetFileHistory(ctx, allocationID, path, offset, limit)
+	if err != nil {
+		return nil, common.NewError("challenges", "Error getting the challenges of the file. "+err.Error())
+	}
+	return fh, nil
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
@@ -13,11 +14,17 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
-	grpc_ratelimit "github.com/grpc-ecosystem/go-grpc-middleware/ratelimit"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -28,6 +35,12 @@ func unaryDatabaseTransactionInjector() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		logger := ctxzap.Extract(ctx)
 
+		ctx, end, err := common.StartAbortableOperation(ctx, "request", info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer end()
+
 		ctx = GetMetaDataStore().CreateTransaction(ctx)
 		resp, err := handler(ctx, req)
 		if err != nil {
@@ -48,6 +61,139 @@ func unaryDatabaseTransactionInjector() grpc.UnaryServerInterceptor {
 	}
 }
 
+// unaryQuotaLimiter applies the same per client and per allocation limits as
+// common.UserRateLimit does for HTTP handlers. Rejected requests get
+// ResourceExhausted with RetryInfo details and a retry-after header.
+func unaryQuotaLimiter() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ql := common.GetQuotaLimiter()
+
+		allocationID := grpcAllocation(req)
+		ctx, clientID := grpcQuotaClient(ctx, allocationID)
+		if retryAfter, ok := ql.Allow(clientID, allocationID, grpcMessageSize(req)); !ok {
+			return nil, rateLimitedError(ctx, retryAfter)
+		}
+
+		resp, err := handler(ctx, req)
+		if err == nil {
+			ql.ChargeDownload(clientID, allocationID, grpcMessageSize(resp))
+		}
+		return resp, err
+	}
+}
+
+// streamQuotaLimiter applies the limits of unaryQuotaLimiter to the streams.
+// The stream is allowed on its first message, since the allocation is known
+// from it, the following messages are charged as received and sent.
+func streamQuotaLimiter() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &quotaServerStream{ServerStream: ss, ql: common.GetQuotaLimiter()})
+	}
+}
+
+type quotaServerStream struct {
+	grpc.ServerStream
+	ql           *common.QuotaLimiter
+	ctx          context.Context
+	clientID     string
+	allocationID string
+}
+
+func (s *quotaServerStream) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return s.ServerStream.Context()
+}
+
+func (s *quotaServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.ctx != nil {
+		s.ql.ChargeUpload(s.clientID, s.allocationID, grpcMessageSize(m))
+		return nil
+	}
+
+	s.allocationID = grpcAllocation(m)
+	s.ctx, s.clientID = grpcQuotaClient(s.ServerStream.Context(), s.allocationID)
+	if retryAfter, ok := s.ql.Allow(s.clientID, s.allocationID, grpcMessageSize(m)); !ok {
+		return rateLimitedError(s.ctx, retryAfter)
+	}
+	return nil
+}
+
+func (s *quotaServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.ql.ChargeDownload(s.clientID, s.allocationID, grpcMessageSize(m))
+	}
+	return err
+}
+
+// grpcQuotaClient returns the key of the client budget of the request, the
+// verified client is kept in the returned context.
+func grpcQuotaClient(ctx context.Context, allocationID string) (context.Context, string) {
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	md := getGRPCMetaDataFromCtx(ctx)
+	return common.QuotaClient(ctx, md.Client, md.ClientKey, md.ClientSignature,
+		allocationID, remoteAddr)
+}
+
+func grpcAllocation(m interface{}) string {
+	if r, ok := m.(interface{ GetAllocation() string }); ok {
+		return r.GetAllocation()
+	}
+	return ""
+}
+
+func grpcMessageSize(m interface{}) int64 {
+	if pm, ok := m.(proto.Message); ok {
+		return int64(proto.Size(pm))
+	}
+	return 0
+}
+
+// unaryRateLimiter rejects the requests over the handlers.rate_limit the same
+// way as unaryQuotaLimiter does.
+func unaryRateLimiter(limiter *common.GRPCRateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if retryAfter, ok := limiter.Allow(); !ok {
+			return nil, rateLimitedError(ctx, retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamRateLimiter rejects the streams over the handlers.rate_limit, a
+// stream is charged as a single request.
+func streamRateLimiter(limiter *common.GRPCRateLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if retryAfter, ok := limiter.Allow(); !ok {
+			return rateLimitedError(ss.Context(), retryAfter)
+		}
+		return handler(srv, ss)
+	}
+}
+
+func rateLimitedError(ctx context.Context, retryAfter time.Duration) error {
+	secs := common.RetryAfterSeconds(retryAfter)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(secs, 10)))
+
+	st := status.Newf(codes.ResourceExhausted, "%s: rate limit exceeded, retry after %ds",
+		common.RateLimitExceededCode, secs)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Duration(secs) * time.Second),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
 func unaryTimeoutInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		deadline := time.Now().Add(time.Duration(TIMEOUT_SECONDS * time.Second))
@@ -58,17 +204,20 @@ func unaryTimeoutInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
-func NewGRPCServerWithMiddlewares(limiter grpc_ratelimit.Limiter, r *mux.Router) *grpc.Server {
+func NewGRPCServerWithMiddlewares(limiter *common.GRPCRateLimiter, r *mux.Router) *grpc.Server {
 	srv := grpc.NewServer(
 		grpc.ChainStreamInterceptor(
 			grpc_zap.StreamServerInterceptor(logging.Logger),
 			grpc_recovery.StreamServerInterceptor(),
+			streamRateLimiter(limiter),
+			streamQuotaLimiter(),
 		),
 		grpc.ChainUnaryInterceptor(
 			grpc_zap.UnaryServerInterceptor(logging.Logger),
 			grpc_recovery.UnaryServerInterceptor(),
+			unaryRateLimiter(limiter),
+			unaryQuotaLimiter(),
 			unaryDatabaseTransactionInjector(),
-			grpc_ratelimit.UnaryServerInterceptor(limiter),
 			unaryTimeoutInterceptor(), // should always be the lastest, to be "innermost"
 		),
 	)
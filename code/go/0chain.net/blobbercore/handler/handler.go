@@ -9,10 +9,15 @@ import (
 	"net/http"
 	"os"
 	"runtime/pprof"
+	"strconv"
 	"time"
 
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/challenge"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/readmarker"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
 	"github.com/0chain/gosdk/zboxcore/fileref"
 	"gorm.io/gorm"
 
@@ -21,8 +26,10 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/constants"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/leader"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/stats"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	"github.com/gorilla/mux"
 )
@@ -37,6 +44,7 @@ func GetMetaDataStore() *datastore.Store {
 func SetupHandlers(r *mux.Router) {
 	//object operations
 	r.HandleFunc("/v1/file/upload/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UploadHandler))))
+	r.HandleFunc("/v1/file/upload/status/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(UploadStatusHandler)))).Methods("GET", "HEAD")
 	r.HandleFunc("/v1/file/download/{allocation}", common.UserRateLimit(common.ToByteStream(WithConnection(DownloadHandler)))).Methods("POST")
 	r.HandleFunc("/v1/file/rename/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(RenameHandler))))
 	r.HandleFunc("/v1/file/copy/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CopyHandler))))
@@ -59,13 +67,28 @@ func SetupHandlers(r *mux.Router) {
 	r.HandleFunc("/v1/file/referencepath/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ReferencePathHandler))))
 	r.HandleFunc("/v1/file/objecttree/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ObjectTreeHandler))))
 	r.HandleFunc("/v1/file/refs/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(RefsHandler)))).Methods("GET")
+	r.HandleFunc("/v1/file/sync/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(SyncHandler)))).Methods("POST")
 	//admin related
 	r.HandleFunc("/_debug", common.UserRateLimit(common.ToJSONResponse(DumpGoRoutines)))
 	r.HandleFunc("/_config", common.UserRateLimit(common.ToJSONResponse(GetConfig)))
+	r.HandleFunc("/_config/history", common.UserRateLimit(common.ToJSONResponse(ConfigHistoryHandler))).Methods("GET")
 	r.HandleFunc("/_stats", common.UserRateLimit(stats.StatsHandler))
 	r.HandleFunc("/_statsJSON", common.UserRateLimit(common.ToJSONResponse(stats.StatsJSONHandler)))
 	r.HandleFunc("/_cleanupdisk", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(CleanupDiskHandler))))
+	r.HandleFunc("/_writemarkers/audit", common.UserRateLimit(common.ToJSONResponse(WithDelegateWallet(WithReadOnlyConnection(WriteMarkerAuditHandler))))).Methods("GET")
+	r.HandleFunc("/_writemarkers/resync/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithDelegateWallet(WithConnection(WriteMarkerResyncHandler))))).Methods("POST")
+	r.HandleFunc("/_challenge/selfaudit/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(SelfAuditHandler)))).Methods("GET")
+	r.HandleFunc("/_challenges", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ChallengesHandler)))).Methods("GET")
+	r.HandleFunc("/_challenges/summary", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ChallengesSummaryHandler)))).Methods("GET")
+	r.HandleFunc("/_challenges/file/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(FileChallengesHandler)))).Methods("GET")
+	r.HandleFunc("/_validators/stats", common.UserRateLimit(common.ToJSONResponse(ValidatorStatsHandler))).Methods("GET")
+	r.HandleFunc("/_locks", common.UserRateLimit(common.ToJSONResponse(LockStatsHandler))).Methods("GET")
+	r.HandleFunc("/_leader", common.UserRateLimit(common.ToJSONResponse(LeaderStatusHandler))).Methods("GET")
 	r.HandleFunc("/getstats", common.UserRateLimit(common.ToJSONResponse(stats.GetStatsHandler)))
+	r.HandleFunc("/_ledger", common.UserRateLimit(common.ToJSONResponse(WithDelegateWallet(WithReadOnlyConnection(LedgerHandler))))).Methods("GET")
+	r.HandleFunc("/_ledger/summary", common.UserRateLimit(common.ToJSONResponse(WithDelegateWallet(WithReadOnlyConnection(LedgerSummaryHandler))))).Methods("GET")
+	r.HandleFunc("/_ledger/export", common.UserRateLimit(LedgerExportHandler)).Methods("GET")
+	r.HandleFunc("/v1/pricing/history", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(PriceHistoryHandler)))).Methods("GET")
 
 	//marketplace related
 	r.HandleFunc("/v1/marketplace/shareinfo/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(MarketPlaceShareInfoHandler))))
@@ -86,6 +109,14 @@ func WithConnection(handler common.JSONResponderF) common.JSONResponderF {
 	return func(ctx context.Context, r *http.Request) (
 		resp interface{}, err error) {
 
+		// the request is in flight until its transaction is committed, an
+		// aborted handler gives up before the changes it can't undo
+		ctx, end, err := common.StartAbortableOperation(ctx, "request", r.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer end()
+
 		ctx = GetMetaDataStore().CreateTransaction(ctx)
 		resp, err = handler(ctx, r)
 
@@ -305,6 +336,28 @@ func UploadHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	return response, nil
 }
 
+/*SyncHandler is the handler to respond to manifest diff requests from clients*/
+func SyncHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.GetSyncDiff(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*UploadStatusHandler is the handler to respond to resumable upload status requests from clients*/
+func UploadStatusHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.UploadStatus(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 func UpdateAttributesHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
 	response, err := storageHandler.UpdateObjectAttributes(ctx, r)
@@ -326,15 +379,13 @@ func CalculateHashHandler(ctx context.Context, r *http.Request) (interface{}, er
 	return response, nil
 }
 
-//nolint:gosimple // need more time to verify
-func HandleShutdown(ctx context.Context) {
-	go func() {
-		select {
-		case <-ctx.Done():
-			Logger.Info("Shutting down server")
-			datastore.GetStore().Close()
-		}
-	}()
+// HandleShutdown closes the DB on shutdown, once the in-flight requests and
+// workers committed their transactions or were aborted.
+func HandleShutdown() {
+	common.OnShutdown(func() {
+		Logger.Info("Closing the DB")
+		datastore.GetStore().Close()
+	})
 }
 
 func DumpGoRoutines(ctx context.Context, r *http.Request) (interface{}, error) {
@@ -343,7 +394,54 @@ func DumpGoRoutines(ctx context.Context, r *http.Request) (interface{}, error) {
 }
 
 func GetConfig(ctx context.Context, r *http.Request) (interface{}, error) {
-	return config.Configuration, nil
+	return config.Get(), nil
+}
+
+// ConfigHistoryHandler returns the last reloads of the config file with the
+// changed settings, the latest first.
+func ConfigHistoryHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	return config.ReloadHistory(), nil
+}
+
+// ValidatorStatsHandler returns the latency and errors of the validators
+// requested for the challenges.
+func ValidatorStatsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	return challenge.GetValidatorStats(), nil
+}
+
+// LockStatsHandler returns the stats of the locks by table, with the times
+// waited for them.
+func LockStatsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	return lock.GetStats(), nil
+}
+
+// LeaderStatusHandler returns the leader election status of the replica, the
+// leader runs the background workers.
+func LeaderStatusHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	return leader.GetStatus(), nil
+}
+
+// SelfAuditHandler dry-runs a challenge of the allocation against the local
+// data, the 'block' and 'seed' parameters are optional.
+func SelfAuditHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	allocationID := mux.Vars(r)["allocation"]
+	var blockNum, seed int64
+	var err error
+	if v := r.FormValue("block"); v != "" {
+		if blockNum, err = strconv.ParseInt(v, 10, 64); err != nil || blockNum < 1 {
+			return nil, common.NewError("invalid_parameters", "Invalid block passed, expected a positive number")
+		}
+	}
+	if v := r.FormValue("seed"); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid seed passed. "+err.Error())
+		}
+	}
+	report, err := challenge.SelfAudit(ctx, allocationID, blockNum, seed)
+	if err != nil {
+		return nil, common.NewError("self_audit", "Error auditing the allocation. "+err.Error())
+	}
+	return report, nil
 }
 
 func CleanupDiskHandler(ctx context.Context, r *http.Request) (interface{}, error) {
@@ -351,6 +449,72 @@ func CleanupDiskHandler(ctx context.Context, r *http.Request) (interface{}, erro
 	return "cleanup", err
 }
 
+// WriteMarkerAuditHandler reports write marker chains of allocations. The
+// 'allocation' parameter limits the audit to one allocation, the 'broken'
+// parameter reports only chains with issues.
+func WriteMarkerAuditHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	reports, err := writemarker.AuditAllocations(ctx, r.FormValue("allocation"))
+	if err != nil {
+		return nil, err
+	}
+	if broken, _ := strconv.ParseBool(r.FormValue("broken")); broken {
+		filtered := make([]*writemarker.ChainReport, 0, len(reports))
+		for _, report := range reports {
+			if !report.Healthy() {
+				filtered = append(filtered, report)
+			}
+		}
+		reports = filtered
+	}
+	return reports, nil
+}
+
+// WriteMarkerResyncHandler returns the actions re-syncing the write marker
+// chain of the allocation with the chain state. The actions are applied only
+// if the 'apply' parameter is true.
+func WriteMarkerResyncHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	allocationID := mux.Vars(r)["allocation"]
+	alloc, err := allocation.GetAllocationByID(ctx, allocationID)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed. "+err.Error())
+	}
+	apply, _ := strconv.ParseBool(r.FormValue("apply"))
+	return writemarker.ResyncAllocation(ctx, alloc, apply)
+}
+
+// PriceHistoryHandler returns the current prices and the prices advertised
+// on chain since the 'since' unix time, the newest first.
+func PriceHistoryHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	var since time.Time
+	if v := r.FormValue("since"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid since passed. "+err.Error())
+		}
+		since = time.Unix(ts, 0)
+	}
+	limit := 100
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 || l > 1000 {
+			return nil, common.NewError("invalid_parameters", "Invalid limit passed, expected 1 to 1000")
+		}
+		limit = l
+	}
+
+	history, err := pricing.GetHistory(ctx, since, limit)
+	if err != nil {
+		return nil, common.NewError("price_history", "Error getting the price history. "+err.Error())
+	}
+	readPrice, writePrice := pricing.Current()
+	return map[string]interface{}{
+		"read_price":  readPrice,
+		"write_price": writePrice,
+		"dynamic":     pricing.Enabled(),
+		"history":     history,
+	}, nil
+}
+
 func RevokeShare(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
 
@@ -365,7 +529,7 @@ func RevokeShare(ctx context.Context, r *http.Request) (interface{}, error) {
 	if !ok {
 		return false, common.NewError("invalid_params", "Missing allocation tx")
 	}
-	valid, err := verifySignatureFromRequest(allocation, sign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocation, sign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -416,7 +580,7 @@ func InsertShare(ctx context.Context, r *http.Request) (interface{}, error) {
 	if !ok {
 		return false, common.NewError("invalid_params", "Missing allocation tx")
 	}
-	valid, err := verifySignatureFromRequest(allocation, sign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocation, sign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
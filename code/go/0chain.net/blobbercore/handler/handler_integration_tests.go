@@ -64,6 +64,12 @@ func SetupHandlers(r *mux.Router) {
 
 func WithReadOnlyConnection(handler common.JSONResponderF) common.JSONResponderF {
 	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		ctx, end, err := common.StartAbortableOperation(ctx, "request", r.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer end()
+
 		ctx = GetMetaDataStore().CreateTransaction(ctx)
 		res, err := handler(ctx, r)
 		defer func() {
@@ -75,6 +81,12 @@ func WithReadOnlyConnection(handler common.JSONResponderF) common.JSONResponderF
 
 func WithConnection(handler common.JSONResponderF) common.JSONResponderF {
 	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		ctx, end, err := common.StartAbortableOperation(ctx, "request", r.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer end()
+
 		ctx = GetMetaDataStore().CreateTransaction(ctx)
 		res, err := handler(ctx, r)
 		defer func() {
@@ -329,14 +341,13 @@ func UploadHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	return response, nil
 }
 
-func HandleShutdown(ctx context.Context) {
-	go func() {
-		select {
-		case <-ctx.Done():
-			Logger.Info("Shutting down server")
-			datastore.GetStore().Close()
-		}
-	}()
+// HandleShutdown closes the DB on shutdown, once the in-flight requests and
+// workers committed their transactions or were aborted.
+func HandleShutdown() {
+	common.OnShutdown(func() {
+		Logger.Info("Closing the DB")
+		datastore.GetStore().Close()
+	})
 }
 
 func DumpGoRoutines(ctx context.Context, r *http.Request) (interface{}, error) {
@@ -345,7 +356,7 @@ func DumpGoRoutines(ctx context.Context, r *http.Request) (interface{}, error) {
 }
 
 func GetConfig(ctx context.Context, r *http.Request) (interface{}, error) {
-	return config.Configuration, nil
+	return config.Get(), nil
 }
 
 func CleanupDiskHandler(ctx context.Context, r *http.Request) (interface{}, error) {
@@ -86,6 +86,7 @@ func init() {
 		panic(err)
 	}
 	bconfig.Configuration.MaxFileSize = int64(1 << 30)
+	bconfig.Configuration.MaxUploadParts = 10000
 }
 
 func setup(t *testing.T) {
@@ -1627,7 +1628,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 					WillReturnError(gorm.ErrRecordNotFound)
 
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "read_markers" WHERE`)).
-					WithArgs(client.GetClientID()).
+					WithArgs(client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"client_id"}).
 							AddRow(client.GetClientID()),
@@ -1636,7 +1637,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 				aa := sqlmock.AnyArg()
 
 				mock.ExpectExec(`UPDATE "read_markers"`).
-					WithArgs(client.GetClientPublicKey(), alloc.ID, alloc.OwnerID, aa, aa, aa, aa, aa, aa).
+					WithArgs(client.GetClientPublicKey(), alloc.OwnerID, aa, aa, aa, aa, client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 
 				mock.ExpectCommit()
@@ -1742,7 +1743,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 					WillReturnError(gorm.ErrRecordNotFound)
 
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "read_markers" WHERE`)).
-					WithArgs(client.GetClientID()).
+					WithArgs(client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"client_id"}).
 							AddRow(client.GetClientID()),
@@ -1751,7 +1752,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 				aa := sqlmock.AnyArg()
 
 				mock.ExpectExec(`UPDATE "read_markers"`).
-					WithArgs(client.GetClientPublicKey(), alloc.ID, alloc.OwnerID, aa, aa, aa, aa, aa, aa, aa).
+					WithArgs(client.GetClientPublicKey(), alloc.OwnerID, aa, aa, aa, aa, aa, client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "marketplace_share_info" WHERE`)).
@@ -1874,7 +1875,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 					WillReturnError(gorm.ErrRecordNotFound)
 
 				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "read_markers" WHERE`)).
-					WithArgs(client.GetClientID()).
+					WithArgs(client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"client_id"}).
 							AddRow(client.GetClientID()),
@@ -1883,7 +1884,7 @@ func TestHandlers_Requiring_Signature(t *testing.T) {
 				aa := sqlmock.AnyArg()
 
 				mock.ExpectExec(`UPDATE "read_markers"`).
-					WithArgs(client.GetClientPublicKey(), alloc.ID, alloc.OwnerID, aa, aa, aa, aa, aa, aa, aa).
+					WithArgs(client.GetClientPublicKey(), alloc.OwnerID, aa, aa, aa, aa, aa, client.GetClientID(), alloc.ID, alloc.OwnerID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 
 				reEncryptionKey, _ := encscheme.GetReGenKey(encscheme.GetEncryptedKey(), "filetype:audio")
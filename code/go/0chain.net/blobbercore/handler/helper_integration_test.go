@@ -13,11 +13,11 @@ import (
 
 
 	"google.golang.org/grpc"
-	"gorm.io/driver/postgres"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
 	"github.com/spf13/viper"
 
 	"testing"
@@ -68,11 +68,7 @@ func setupHandlerIntegrationTests(t *testing.T) (blobbergrpc.BlobberServiceClien
 	bClient := blobbergrpc.NewBlobberServiceClient(conn)
 
 	setupIntegrationTestConfig(t)
-	db, err := gorm.Open(postgres.Open(fmt.Sprintf(
-		"host=%v port=%v user=%v dbname=%v password=%v sslmode=disable",
-		config.Configuration.DBHost, config.Configuration.DBPort,
-		config.Configuration.DBUserName, config.Configuration.DBName,
-		config.Configuration.DBPassword)), &gorm.Config{})
+	db, err := datastore.OpenDB()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -114,39 +110,22 @@ func (c *TestDataController) ClearDatabase() error {
 		return err
 	}
 
-	_, err = tx.Exec("truncate allocations cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate reference_objects cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate commit_meta_txns cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate collaborators cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate allocation_changes cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate allocation_connections cascade")
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("truncate write_markers cascade")
-	if err != nil {
-		return err
+	// children first, the SQLite DB can't truncate
+	for _, table := range []string{
+		"allocation_changes",
+		"allocation_connections",
+		"terms",
+		"allocations",
+		"file_stats",
+		"reference_objects",
+		"commit_meta_txns",
+		"collaborators",
+		"write_markers",
+	} {
+		_, err = tx.Exec("DELETE FROM " + table)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = tx.Commit()
@@ -522,6 +501,8 @@ func setupIntegrationTestConfig(t *testing.T) {
 	config.SetupDefaultConfig()
 	config.SetupConfig(configDir)
 
+	config.Configuration.DBDriver = viper.GetString("db.driver")
+	config.Configuration.DBPath = viper.GetString("db.path")
 	config.Configuration.DBHost = "localhost"
 	config.Configuration.DBName = viper.GetString("db.name")
 	config.Configuration.DBPort = viper.GetString("db.port")
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/ledger"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+const maxLedgerEntries = 10000
+
+// ledgerExportPage is the number of the entries an export reads at once.
+const ledgerExportPage = 1000
+
+// ledgerAuthWindow is the time a signed ledger request is valid for.
+const ledgerAuthWindow = 5 * time.Minute
+
+// ledgerAuthPayload is the message signed by the delegate wallet: the method,
+// the path and the query of the request with the parameters sorted by key,
+// so a signature can't be replayed for another request.
+func ledgerAuthPayload(r *http.Request) string {
+	return r.Method + ":" + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// verifyDelegateWallet checks the request is of the delegate wallet of the
+// blobber, signing the request by ledgerAuthPayload with the unix time of
+// the request in the 'timestamp' parameter. The earnings are of the blobber
+// owner only.
+func verifyDelegateWallet(r *http.Request) error {
+	clientID := r.Header.Get(common.ClientHeader)
+	if clientID == "" || clientID != config.Configuration.DelegateWallet {
+		return common.NewError("invalid_client", "The ledger is of the delegate wallet only")
+	}
+	timestamp := r.FormValue("timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return common.NewError("invalid_parameters", "Invalid timestamp passed")
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > ledgerAuthWindow || d < -ledgerAuthWindow {
+		return common.NewError("invalid_parameters", "The timestamp is expired")
+	}
+	if !verifyClient(clientID, r.Header.Get(common.ClientKeyHeader),
+		r.Header.Get(common.ClientSignatureHeader), ledgerAuthPayload(r)) {
+		return common.NewError("invalid_signature", "Invalid signature of the delegate wallet")
+	}
+	return nil
+}
+
+// WithDelegateWallet runs the handler for the requests of the delegate
+// wallet only.
+func WithDelegateWallet(handler common.JSONResponderF) common.JSONResponderF {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		if err := verifyDelegateWallet(r); err != nil {
+			return nil, err
+		}
+		return handler(ctx, r)
+	}
+}
+
+// parseLedgerTime accepts a date (2006-01-02), RFC 3339 time or unix seconds.
+func parseLedgerTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// ledgerFilter reads the 'kind', 'allocation', 'client', 'payer', 'from' and
+// 'to' parameters; the 'to' time is exclusive.
+func ledgerFilter(r *http.Request) (*ledger.Filter, error) {
+	from, err := parseLedgerTime(r.FormValue("from"))
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid from passed. "+err.Error())
+	}
+	to, err := parseLedgerTime(r.FormValue("to"))
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid to passed. "+err.Error())
+	}
+	return &ledger.Filter{
+		Kind:         ledger.Kind(r.FormValue("kind")),
+		AllocationID: r.FormValue("allocation"),
+		ClientID:     r.FormValue("client"),
+		PayerID:      r.FormValue("payer"),
+		From:         from,
+		To:           to,
+	}, nil
+}
+
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 || i > max {
+		return 0, common.NewErrorf("invalid_parameters", "Invalid %s passed, expected 0 to %d", name, max)
+	}
+	return i, nil
+}
+
+// LedgerHandler returns entries of the earnings ledger.
+func LedgerHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	f, err := ledgerFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := intParam(r, "offset", 0, 1<<31-1)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intParam(r, "limit", 100, maxLedgerEntries)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ledger.Find(ctx, f, offset, limit)
+	if err != nil {
+		return nil, common.NewError("ledger", "Error getting the ledger entries. "+err.Error())
+	}
+	return entries, nil
+}
+
+// LedgerSummaryHandler returns totals of the earnings ledger per kind and per
+// allocation, client or payer given by the 'group_by' parameter.
+func LedgerSummaryHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	f, err := ledgerFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	group := r.FormValue("group_by")
+	if group == "" {
+		group = "allocation"
+	}
+	if !ledger.IsGroup(group) {
+		return nil, common.NewError("invalid_parameters", "Invalid group_by passed, expected allocation, client or payer")
+	}
+	totals, err := ledger.Summarize(ctx, f, group)
+	if err != nil {
+		return nil, common.NewError("ledger", "Error summarizing the ledger. "+err.Error())
+	}
+	return totals, nil
+}
+
+// LedgerExportHandler sends entries of the earnings ledger as a CSV or JSON
+// ('format' parameter) file. All the entries matching the filter are sent,
+// read page by page.
+func LedgerExportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := verifyDelegateWallet(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ctx := GetMetaDataStore().CreateTransaction(r.Context())
+	defer GetMetaDataStore().GetTransaction(ctx).Rollback()
+
+	f, err := ledgerFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "invalid format, expected csv or json", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=earnings-%d.%s", time.Now().Unix(), format))
+	var exporter ledger.Exporter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		exporter = ledger.NewCSVExporter(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		exporter = ledger.NewJSONExporter(w)
+	}
+
+	// the status is sent with the first page, a failure after it leaves the
+	// file unfinished, without the closing of the JSON array
+	var pages int
+	err = ledger.Each(ctx, f, ledgerExportPage, func(entries []*ledger.Entry) error {
+		pages++
+		return exporter.Write(entries)
+	})
+	if err != nil && pages == 0 {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		err = exporter.Close()
+	}
+	if err != nil {
+		Logger.Error("Error exporting the ledger", zap.Error(err))
+	}
+}
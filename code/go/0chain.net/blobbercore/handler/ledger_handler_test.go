@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDelegateWallet(t *testing.T) {
+	prev := config.Configuration.DelegateWallet
+	config.Configuration.DelegateWallet = "delegate"
+	defer func() { config.Configuration.DelegateWallet = prev }()
+
+	request := func(clientID string, ts time.Time) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/_ledger?timestamp="+strconv.FormatInt(ts.Unix(), 10), nil)
+		r.Header.Set(common.ClientHeader, clientID)
+		r.Header.Set(common.ClientKeyHeader, "key")
+		r.Header.Set(common.ClientSignatureHeader, "signature")
+		return r
+	}
+
+	require.Error(t, verifyDelegateWallet(httptest.NewRequest(http.MethodGet, "/_ledger", nil)))
+	require.Error(t, verifyDelegateWallet(request("client", time.Now())))
+	require.Error(t, verifyDelegateWallet(request("delegate", time.Now().Add(-time.Hour))))
+	// not signed by the delegate wallet
+	require.Error(t, verifyDelegateWallet(request("delegate", time.Now())))
+}
+
+func TestLedgerAuthPayload(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/_ledger/export?timestamp=1&format=csv&allocation=a1", nil)
+	// the parameters are sorted by key, whatever the order sent
+	require.Equal(t, "GET:/_ledger/export?allocation=a1&format=csv&timestamp=1", ledgerAuthPayload(r))
+
+	r = httptest.NewRequest(http.MethodGet, "/_ledger?timestamp=1", nil)
+	require.Equal(t, "GET:/_ledger?timestamp=1", ledgerAuthPayload(r))
+}
@@ -3,11 +3,14 @@ package handler
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"math"
+	"mime/multipart"
 	"strings"
+	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/blobberhttp"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/stats"
@@ -23,6 +26,7 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/constants"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/readmarker"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/writemarker"
@@ -51,7 +55,7 @@ func readPreRedeem(ctx context.Context, alloc *allocation.Allocation,
 		db        = datastore.GetStore().GetTransaction(ctx)
 		blobberID = node.Self.ID
 		until     = common.Now() +
-			common.Timestamp(config.Configuration.ReadLockTimeout)
+			common.Timestamp(config.Get().ReadLockTimeout)
 
 		want = alloc.WantRead(blobberID, numBlocks)
 
@@ -62,38 +66,22 @@ func readPreRedeem(ctx context.Context, alloc *allocation.Allocation,
 		return // skip if read price is zero
 	}
 
-	rps, err = allocation.ReadPools(db, payerID, alloc.ID,
-		blobberID, until)
+	var refreshing bool
+	rps, refreshing, err = allocation.GetReadPools(db, payerID, alloc.ID,
+		blobberID, until, func(rps []*allocation.ReadPool) bool {
+			return alloc.HaveRead(rps, blobberID, pendNumBlocks) >= want
+		})
 	if err != nil {
 		return common.NewErrorf("read_pre_redeem",
-			"can't get read pools from DB: %v", err)
+			"can't get read pools: %v", err)
 	}
 
 	var have = alloc.HaveRead(rps, blobberID, pendNumBlocks)
 
-	if have < want {
-		rps, err = allocation.RequestReadPools(payerID,
-			alloc.ID)
-		if err != nil {
-			return common.NewErrorf("read_pre_redeem",
-				"can't request read pools from sharders: %v", err)
-		}
-
-		err = allocation.SetReadPools(db, payerID,
-			alloc.ID, blobberID, rps)
-		if err != nil {
-			return common.NewErrorf("read_pre_redeem",
-				"can't save requested read pools: %v", err)
-		}
-
-		rps, err = allocation.ReadPools(db, payerID, alloc.ID, blobberID,
-			until)
-		if err != nil {
-			return common.NewErrorf("read_pre_redeem",
-				"can't get read pools from DB: %v", err)
-		}
-
-		have = alloc.HaveRead(rps, blobberID, pendNumBlocks)
+	if have < want && refreshing {
+		return common.NewError("read_pre_redeem", "not enough "+
+			"tokens in client's read pools associated with the"+
+			" allocation->blobber, the pools are being refreshed, retry later")
 	}
 
 	if have < want {
@@ -113,7 +101,7 @@ func writePreRedeem(ctx context.Context, alloc *allocation.Allocation,
 		db        = datastore.GetStore().GetTransaction(ctx)
 		blobberID = node.Self.ID
 		until     = common.Now() +
-			common.Timestamp(config.Configuration.WriteLockTimeout)
+			common.Timestamp(config.Get().WriteLockTimeout)
 
 		want = alloc.WantWrite(blobberID, writeMarker.Size,
 			writeMarker.Timestamp)
@@ -133,32 +121,23 @@ func writePreRedeem(ctx context.Context, alloc *allocation.Allocation,
 			"can't get pending payments: %v", err)
 	}
 
-	wps, err = pend.WritePools(db, blobberID, until)
+	var refreshing bool
+	wps, refreshing, err = allocation.GetWritePools(db, pend, until,
+		func(wps []*allocation.WritePool) bool {
+			return pend.HaveWrite(wps, alloc, writeMarker.Timestamp) >= want
+		})
 	if err != nil {
 		return common.NewErrorf("write_pre_redeem",
-			"can't get read pools from DB: %v", err)
+			"can't get write pools: %v", err)
 	}
 
 	var have = pend.HaveWrite(wps, alloc, writeMarker.Timestamp)
-	if have < want {
-		wps, err = allocation.RequestWritePools(payerID,
-			alloc.ID)
-		if err != nil {
-			return common.NewErrorf("write_pre_redeem",
-				"can't request write pools from sharders: %v", err)
-		}
-		err = allocation.SetWritePools(db, payerID,
-			alloc.ID, blobberID, wps)
-		if err != nil {
-			return common.NewErrorf("write_pre_redeem",
-				"can't save requested write pools: %v", err)
-		}
-		wps, err = pend.WritePools(db, blobberID, until)
-		if err != nil {
-			return common.NewErrorf("write_pre_redeem",
-				"can't get write pools from DB: %v", err)
-		}
-		have = pend.HaveWrite(wps, alloc, writeMarker.Timestamp)
+	if have < want && refreshing {
+		return common.NewErrorf("write_pre_redeem", "not enough "+
+			"tokens in write pools (client -> allocation ->  blobber)"+
+			"(%s -> %s -> %s), have %d, want %d, the pools are being "+
+			"refreshed, retry later", payerID, alloc.ID,
+			writeMarker.BlobberID, have, want)
 	}
 
 	if have < want {
@@ -352,7 +331,7 @@ func (fsh *StorageHandler) DownloadFile(
 		pendNumBlocks int64
 	)
 
-	rme, err = readmarker.GetLatestReadMarkerEntity(ctx, clientID)
+	rme, err = readmarker.GetLatestReadMarkerEntity(ctx, clientID, alloc.ID, payerID)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, common.NewErrorf("download_file",
 			"couldn't get read marker from DB: %v", err)
@@ -494,6 +473,7 @@ func (fsh *StorageHandler) DownloadFile(
 	}
 
 	stats.FileBlockDownloaded(ctx, fileref.ID)
+	pricing.RecordRead(int64(len(respData)))
 	return respData, nil
 }
 
@@ -523,8 +503,10 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*b
 		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
 	}
 
-	mutex := lock.GetMutex(allocationObj.TableName(), allocationID)
-	mutex.Lock()
+	mutex := lock.GetLocker(allocationObj.TableName(), allocationID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("lock_error", "Error locking the allocation: %v", err)
+	}
 	defer mutex.Unlock()
 
 	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationID, clientID)
@@ -653,6 +635,11 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*b
 	if err != nil {
 		return nil, common.NewError("allocation_write_error", "Error persisting the allocation object")
 	}
+	// the files moved can't be undone, an aborted commit is rolled back
+	// before and its connection stays in progress for a retry
+	if common.Aborted(ctx) {
+		return nil, common.ErrShuttingDown
+	}
 	err = connectionObj.CommitToFileStore(ctx)
 	if err != nil {
 		return nil, common.NewError("file_store_error", "Error committing to file store. "+err.Error())
@@ -692,7 +679,7 @@ func (fsh *StorageHandler) RenameObject(ctx context.Context, r *http.Request) (i
 	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
 	_ = ctx.Value(constants.CLIENT_KEY_CONTEXT_KEY).(string)
 
-	valid, err := verifySignatureFromRequest(allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -725,8 +712,10 @@ func (fsh *StorageHandler) RenameObject(ctx context.Context, r *http.Request) (i
 		return nil, common.NewError("meta_error", "Error reading metadata for connection")
 	}
 
-	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
-	mutex.Lock()
+	mutex := lock.GetLocker(connectionObj.TableName(), connectionID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("lock_error", "Error locking the connection: %v", err)
+	}
 	defer mutex.Unlock()
 
 	objectRef, err := reference.GetReferenceFromLookupHash(ctx, allocationID, pathHash)
@@ -780,7 +769,7 @@ func (fsh *StorageHandler) UpdateObjectAttributes(ctx context.Context,
 			"Invalid allocation ID passed: %v", err)
 	}
 
-	valid, err := verifySignatureFromRequest(allocTx, r.Header.Get(common.ClientSignatureHeader), alloc.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocTx, r.Header.Get(common.ClientSignatureHeader), alloc.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -833,9 +822,12 @@ func (fsh *StorageHandler) UpdateObjectAttributes(ctx context.Context,
 			"reading metadata for connection: %v", err)
 	}
 
-	var mutex = lock.GetMutex(conn.TableName(), connID)
+	var mutex = lock.GetLocker(conn.TableName(), connID)
 
-	mutex.Lock()
+	if err = mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("update_object_attributes",
+			"locking the connection: %v", err)
+	}
 	defer mutex.Unlock()
 
 	var ref *reference.Ref
@@ -880,7 +872,7 @@ func (fsh *StorageHandler) CopyObject(ctx context.Context, r *http.Request) (int
 		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
 	}
 
-	valid, err := verifySignatureFromRequest(allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -922,8 +914,10 @@ func (fsh *StorageHandler) CopyObject(ctx context.Context, r *http.Request) (int
 		return nil, common.NewError("meta_error", "Error reading metadata for connection")
 	}
 
-	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
-	mutex.Lock()
+	mutex := lock.GetLocker(connectionObj.TableName(), connectionID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("lock_error", "Error locking the connection: %v", err)
+	}
 	defer mutex.Unlock()
 
 	objectRef, err := reference.GetReferenceFromLookupHash(ctx, allocationID, pathHash)
@@ -1010,7 +1004,7 @@ func (fsh *StorageHandler) CreateDir(ctx context.Context, r *http.Request) (*blo
 		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
 	}
 
-	valid, err := verifySignatureFromRequest(allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, r.Header.Get(common.ClientSignatureHeader), allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -1045,8 +1039,10 @@ func (fsh *StorageHandler) CreateDir(ctx context.Context, r *http.Request) (*blo
 		return nil, common.NewError("meta_error", "Error reading metadata for connection")
 	}
 
-	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
-	mutex.Lock()
+	mutex := lock.GetLocker(connectionObj.TableName(), connectionID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("lock_error", "Error locking the connection: %v", err)
+	}
 	defer mutex.Unlock()
 
 	allocationChange := &allocation.AllocationChange{}
@@ -1108,7 +1104,7 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 		publicKey = ctx.Value(constants.CLIENT_KEY_CONTEXT_KEY).(string)
 	}
 
-	valid, err := verifySignatureFromRequest(allocationTx, r.Header.Get(common.ClientSignatureHeader), publicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, r.Header.Get(common.ClientSignatureHeader), publicKey)
 
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
@@ -1132,13 +1128,36 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
 	}
 
+	end, err := common.StartOperation("upload", connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
 	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationID, clientID)
 	if err != nil {
 		return nil, common.NewError("meta_error", "Error reading metadata for connection")
 	}
 
-	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
-	mutex.Lock()
+	partNumber, numParts, err := getUploadParts(r, fileOperation)
+	if err != nil {
+		return nil, err
+	}
+
+	patchOffset, isPatch, err := getPatchOffset(r, fileOperation)
+	if err != nil {
+		return nil, err
+	}
+	if isPatch && (partNumber > 0 || numParts > 0) {
+		return nil, common.NewError("invalid_parameters", "Patch can't be uploaded in parts")
+	}
+
+	//parts of a multipart upload are locked too, so their total size is checked against the free space
+	//consistently. The request body is parsed already, so only storing the part waits for the lock.
+	mutex := lock.GetLocker(connectionObj.TableName(), connectionID)
+	if err := mutex.TryLock(ctx); err != nil {
+		return nil, common.NewErrorf("lock_error", "Error locking the connection: %v", err)
+	}
 	defer mutex.Unlock()
 
 	result := &blobberhttp.UploadResult{}
@@ -1185,20 +1204,81 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 			existingFileOnCloud = existingFileRef.OnCloud
 		}
 
-		origfile, _, err := r.FormFile("uploadFile")
-		if err != nil {
-			return nil, common.NewError("invalid_parameters", "Error Reading multi parts for file."+err.Error())
+		//a patch is applied to the committed file, so the file can't be patched along with another change of it
+		//in the same connection, the earlier change would be lost and the size change counted twice
+		if changed, patched := getPendingFileChange(connectionObj, formData.Path); (changed && isPatch) || patched {
+			return nil, common.NewError("duplicate_change", "The file is patched or changed in the connection already, commit the connection first")
+		}
+
+		//file content has been uploaded in parts already when the multipart upload is completed
+		var origfile multipart.File
+		var origHeader *multipart.FileHeader
+		if numParts == 0 {
+			origfile, origHeader, err = r.FormFile("uploadFile")
+			if err != nil {
+				return nil, common.NewError("invalid_parameters", "Error Reading multi parts for file."+err.Error())
+			}
+			defer origfile.Close()
 		}
-		defer origfile.Close()
 
 		thumbfile, thumbHeader, _ := r.FormFile("uploadThumbnailFile")
-		thumbnailPresent := thumbHeader != nil
-		if thumbnailPresent {
+		thumbnailPresent := thumbHeader != nil && partNumber == 0
+		if thumbHeader != nil {
 			defer thumbfile.Close()
 		}
 
-		fileInputData := &filestore.FileInputData{Name: formData.Filename, Path: formData.Path, OnCloud: existingFileOnCloud}
-		fileOutputData, err := filestore.GetFileStore().WriteFile(allocationID, fileInputData, origfile, connectionObj.ConnectionID)
+		chunkHash, err := getChunkHash(r)
+		if err != nil {
+			return nil, err
+		}
+
+		fileInputData := &filestore.FileInputData{
+			Name:         formData.Filename,
+			Path:         formData.Path,
+			OnCloud:      existingFileOnCloud,
+			IsResumable:  formData.IsResumable,
+			UploadLength: formData.UploadLength,
+			UploadOffset: formData.UploadOffset,
+			IsFinal:      formData.IsFinal,
+			ChunkHash:    chunkHash,
+			PartNumber:   partNumber,
+		}
+
+		var fileOutputData *filestore.FileOutputData
+		switch {
+		case partNumber > 0:
+			var partsSize int64
+			partsSize, err = getPartsSize(allocationID, fileInputData, connectionObj.ConnectionID, origHeader.Size)
+			if err != nil {
+				return nil, err
+			}
+			if partsSize > config.Get().MaxFileSize {
+				return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
+			}
+			if allocationObj.BlobberSizeUsed+connectionObj.Size+partsSize > allocationObj.BlobberSize {
+				return nil, common.NewError("max_allocation_size", "Max size reached for the allocation with this blobber")
+			}
+			fileOutputData, err = filestore.GetFileStore().WritePart(allocationID, fileInputData, origfile, connectionObj.ConnectionID)
+			if err == nil {
+				fileOutputData.UploadOffset = partsSize
+			}
+		case numParts > 0:
+			fileOutputData, err = filestore.GetFileStore().AssembleParts(allocationID, fileInputData, numParts, connectionObj.ConnectionID)
+		case isPatch:
+			if formData.IsResumable {
+				return nil, common.NewError("invalid_parameters", "Patch can't be a resumable upload")
+			}
+			fileInputData.Hash = existingFileRef.ContentHash
+			fileOutputData, err = filestore.GetFileStore().PatchFile(allocationID, fileInputData, patchOffset, origfile, connectionObj.ConnectionID)
+		default:
+			if formData.IsResumable && formData.UploadOffset > 0 {
+				fileInputData.HashState, err = getUploadHashState(ctx, connectionObj.ConnectionID, formData.Path, formData.UploadOffset)
+				if err != nil {
+					return nil, common.NewError("meta_error", "Error reading the resumable upload. "+err.Error())
+				}
+			}
+			fileOutputData, err = filestore.GetFileStore().WriteFile(allocationID, fileInputData, origfile, connectionObj.ConnectionID)
+		}
 		if err != nil {
 			return nil, common.NewError("upload_error", "Failed to upload the file. "+err.Error())
 		}
@@ -1207,6 +1287,24 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 		result.Hash = fileOutputData.ContentHash
 		result.MerkleRoot = fileOutputData.MerkleRoot
 		result.Size = fileOutputData.Size
+		result.UploadOffset = fileOutputData.UploadOffset
+		result.UploadLength = fileOutputData.UploadLength
+		result.PartNumber = partNumber
+
+		if (formData.IsResumable && !formData.IsFinal) || partNumber > 0 {
+			if fileOutputData.UploadOffset > config.Get().MaxFileSize || fileOutputData.Size > config.Get().MaxFileSize {
+				return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
+			}
+
+			return fsh.saveResumableUpload(ctx, connectionObj, &formData, result, fileOutputData.HashState)
+		}
+
+		if formData.IsResumable || numParts > 0 {
+			err = allocation.DeleteResumableUpload(ctx, connectionObj.ConnectionID, formData.Path)
+			if err != nil {
+				return nil, common.NewError("connection_write_error", "Error removing the resumable upload. "+err.Error())
+			}
+		}
 
 		if len(formData.Hash) > 0 && formData.Hash != fileOutputData.ContentHash {
 			return nil, common.NewError("content_hash_mismatch", "Content hash provided in the meta data does not match the file content")
@@ -1214,7 +1312,7 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 		if len(formData.MerkleRoot) > 0 && formData.MerkleRoot != fileOutputData.MerkleRoot {
 			return nil, common.NewError("content_merkle_root_mismatch", "Merkle root provided in the meta data does not match the file content")
 		}
-		if fileOutputData.Size > config.Configuration.MaxFileSize {
+		if fileOutputData.Size > config.Get().MaxFileSize {
 			return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
 		}
 
@@ -1222,6 +1320,7 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 		formData.MerkleRoot = fileOutputData.MerkleRoot
 		formData.AllocationID = allocationID
 		formData.Size = fileOutputData.Size
+		formData.IsPatch = isPatch
 
 		allocationSize := fileOutputData.Size
 		if thumbnailPresent {
@@ -1263,6 +1362,238 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*blo
 	return result, nil
 }
 
+// getUploadHashState returns the hash state of the resumable upload kept with
+// its previous chunk, if the chunk is appended right after it.
+func getUploadHashState(ctx context.Context, connectionID, path string, uploadOffset int64) ([]byte, error) {
+	upload, err := allocation.GetResumableUpload(ctx, connectionID, path)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.UploadOffset != uploadOffset {
+		return nil, nil
+	}
+	return upload.HashState, nil
+}
+
+// saveResumableUpload keeps track of a not yet finished resumable or multipart
+// upload. The file change is added to the connection only once the final chunk
+// arrives or the parts are assembled, but the connection is touched on every
+// chunk or part to postpone its expiration. The offset and the hash state of
+// the bytes written already are kept, so the status doesn't read them again.
+func (fsh *StorageHandler) saveResumableUpload(ctx context.Context, connectionObj *allocation.AllocationChangeCollector,
+	formData *allocation.UpdateFileChange, result *blobberhttp.UploadResult, hashState []byte) (*blobberhttp.UploadResult, error) {
+
+	err := connectionObj.Touch(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	upload := &allocation.ResumableUpload{
+		ConnectionID: connectionObj.ConnectionID,
+		AllocationID: connectionObj.AllocationID,
+		Path:         formData.Path,
+		Filename:     formData.Filename,
+		UploadLength: result.UploadLength,
+		UploadOffset: result.UploadOffset,
+		HashState:    hashState,
+	}
+	if err = upload.Save(ctx); err != nil {
+		Logger.Error("Error in writing the resumable upload", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the resumable upload")
+	}
+
+	return result, nil
+}
+
+//UploadStatus returns how many bytes of a resumable upload the blobber already has
+func (fsh *StorageHandler) UploadStatus(ctx context.Context, r *http.Request) (*blobberhttp.UploadStatusResult, error) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use GET or HEAD instead")
+	}
+
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+
+	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	if !valid || err != nil {
+		return nil, common.NewError("invalid_signature", "Invalid signature")
+	}
+
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	path := r.FormValue("path")
+	if len(path) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid path")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	if connectionObj.Status != allocation.InProgressConnection {
+		return nil, common.NewError("invalid_parameters", "No upload in progress for the connection")
+	}
+
+	upload, err := allocation.GetResumableUpload(ctx, connectionID, path)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "No resumable upload for the path. "+err.Error())
+	}
+
+	fileInputData := &filestore.FileInputData{Name: upload.Filename, Path: upload.Path}
+	parts, err := filestore.GetFileStore().ListParts(allocationObj.ID, fileInputData, connectionID)
+	if err != nil {
+		return nil, common.NewError("upload_status_error", "Failed to read the uploaded parts. "+err.Error())
+	}
+
+	tolerance := time.Duration(config.Get().OpenConnectionWorkerTolerance) * time.Second
+	result := &blobberhttp.UploadStatusResult{
+		ConnectionID: connectionID,
+		Filename:     upload.Filename,
+		Path:         upload.Path,
+		UploadLength: upload.UploadLength,
+		UploadOffset: upload.UploadOffset,
+		Parts:        parts,
+		ExpiresAt:    common.Timestamp(connectionObj.UpdatedAt.Add(tolerance).Unix()),
+	}
+
+	//the parts of the multipart upload are checked one by one, there's no hash of them all
+	if len(upload.HashState) > 0 {
+		result.Hash, err = filestore.HashOfState(upload.HashState)
+		if err != nil {
+			return nil, common.NewError("upload_status_error", "Failed to read the uploaded bytes. "+err.Error())
+		}
+	}
+
+	return result, nil
+}
+
+// getPendingFileChange returns whether the file at the path is changed in the
+// connection already, and whether the change is a patch.
+func getPendingFileChange(connectionObj *allocation.AllocationChangeCollector, path string) (changed, patched bool) {
+	for _, change := range connectionObj.AllocationChanges {
+		switch c := change.(type) {
+		case *allocation.NewFileChange:
+			if c.Path == path {
+				changed = true
+			}
+		case *allocation.UpdateFileChange:
+			if c.Path == path {
+				changed = true
+				patched = patched || c.IsPatch
+			}
+		}
+	}
+	return changed, patched
+}
+
+// getUploadParts returns the part number of the multipart upload part being
+// uploaded, or the number of parts to assemble when the upload is completed.
+func getUploadParts(r *http.Request, fileOperation string) (partNumber int, numParts int, err error) {
+	if v := r.FormValue("part_number"); len(v) > 0 {
+		if partNumber, err = strconv.Atoi(v); err != nil || partNumber < 1 {
+			return 0, 0, common.NewError("invalid_parameters", "Invalid part number passed")
+		}
+	}
+
+	if v := r.FormValue("num_parts"); len(v) > 0 {
+		if numParts, err = strconv.Atoi(v); err != nil || numParts < 1 {
+			return 0, 0, common.NewError("invalid_parameters", "Invalid number of parts passed")
+		}
+	}
+
+	maxParts := config.Get().MaxUploadParts
+	if int64(partNumber) > maxParts || int64(numParts) > maxParts {
+		return 0, 0, common.NewErrorf("invalid_parameters", "Number of parts can't exceed %d", maxParts)
+	}
+
+	if partNumber > 0 && numParts > 0 {
+		return 0, 0, common.NewError("invalid_parameters", "Part number and number of parts can't be passed together")
+	}
+
+	if (partNumber > 0 || numParts > 0) && fileOperation == allocation.DELETE_OPERATION {
+		return 0, 0, common.NewError("invalid_parameters", "Multipart upload is not supported for delete operation")
+	}
+
+	return partNumber, numParts, nil
+}
+
+// getPartsSize returns the size of the parts of the multipart upload stored
+// already, the part being uploaded included. A part uploaded again replaces
+// the stored one, so it's counted once.
+func getPartsSize(allocationID string, fileData *filestore.FileInputData, connectionID string, partSize int64) (int64, error) {
+	parts, err := filestore.GetFileStore().ListParts(allocationID, fileData, connectionID)
+	if err != nil {
+		return 0, common.NewError("upload_error", "Failed to read the uploaded parts. "+err.Error())
+	}
+
+	size := partSize
+	for _, part := range parts {
+		if part.Number != fileData.PartNumber {
+			size += part.Size
+		}
+	}
+	return size, nil
+}
+
+// getPatchOffset returns the offset the uploaded content is written at into
+// the existing file, when the update is a patch or an append of the file.
+func getPatchOffset(r *http.Request, fileOperation string) (int64, bool, error) {
+	v := r.FormValue("patch_offset")
+	if len(v) == 0 {
+		return 0, false, nil
+	}
+
+	if fileOperation != allocation.UPDATE_OPERATION {
+		return 0, false, common.NewError("invalid_parameters", "Patch is supported for update operation only")
+	}
+
+	offset, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false, common.NewError("invalid_parameters", "Invalid patch offset passed")
+	}
+
+	return offset, true, nil
+}
+
+// getChunkHash parses Upload-Checksum header, e.g. "sha1 <base64 digest>", and
+// returns the digest hex encoded. Empty string is returned if there is no header.
+func getChunkHash(r *http.Request) (string, error) {
+	checksum := strings.TrimSpace(r.Header.Get(common.UploadChecksumHeader))
+	if len(checksum) == 0 {
+		return "", nil
+	}
+
+	parts := strings.SplitN(checksum, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "sha1") {
+		return "", common.NewError("unsupported_checksum_algorithm", "Only sha1 is supported for Upload-Checksum")
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", common.NewError("invalid_parameters", "Invalid Upload-Checksum. "+err.Error())
+	}
+
+	return hex.EncodeToString(digest), nil
+}
+
 func getFormFieldName(mode string) string {
 	formField := "uploadMeta"
 	if mode == allocation.UPDATE_OPERATION {
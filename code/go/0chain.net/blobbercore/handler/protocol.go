@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
@@ -60,13 +61,13 @@ func (ar *apiResp) err() error { //nolint:unused,deadcode // might be used later
 
 func getStorageNode() (*transaction.StorageNode, error) {
 	var err error
+	conf := config.Get()
 	sn := &transaction.StorageNode{}
 	sn.ID = node.Self.ID
 	sn.BaseURL = node.Self.GetURLBase()
 	sn.Geolocation = transaction.StorageNodeGeolocation(config.Geolocation())
-	sn.Capacity = config.Configuration.Capacity
-	readPrice := config.Configuration.ReadPrice
-	writePrice := config.Configuration.WritePrice
+	sn.Capacity = conf.Capacity
+	readPrice, writePrice := pricing.Current()
 	if config.Configuration.PriceInUSD {
 		readPrice, err = zcncore.ConvertUSDToToken(readPrice)
 		if err != nil {
@@ -80,15 +81,15 @@ func getStorageNode() (*transaction.StorageNode, error) {
 	}
 	sn.Terms.ReadPrice = zcncore.ConvertToValue(readPrice)
 	sn.Terms.WritePrice = zcncore.ConvertToValue(writePrice)
-	sn.Terms.MinLockDemand = config.Configuration.MinLockDemand
-	sn.Terms.MaxOfferDuration = config.Configuration.MaxOfferDuration
-	sn.Terms.ChallengeCompletionTime = config.Configuration.ChallengeCompletionTime
+	sn.Terms.MinLockDemand = conf.MinLockDemand
+	sn.Terms.MaxOfferDuration = conf.MaxOfferDuration
+	sn.Terms.ChallengeCompletionTime = conf.ChallengeCompletionTime
 
 	sn.StakePoolSettings.DelegateWallet = config.Configuration.DelegateWallet
-	sn.StakePoolSettings.MinStake = config.Configuration.MinStake
-	sn.StakePoolSettings.MaxStake = config.Configuration.MaxStake
-	sn.StakePoolSettings.NumDelegates = config.Configuration.NumDelegates
-	sn.StakePoolSettings.ServiceCharge = config.Configuration.ServiceCharge
+	sn.StakePoolSettings.MinStake = conf.MinStake
+	sn.StakePoolSettings.MaxStake = conf.MaxStake
+	sn.StakePoolSettings.NumDelegates = conf.NumDelegates
+	sn.StakePoolSettings.ServiceCharge = conf.ServiceCharge
 	return sn, nil
 }
 
@@ -121,6 +122,11 @@ func BlobberAdd(ctx context.Context) (string, error) {
 		return "", err
 	}
 
+	err = pricing.RecordAdvertised(ctx, sn.Terms.ReadPrice, sn.Terms.WritePrice, txn.Hash)
+	if err != nil {
+		Logger.Error("Failed to save the advertised prices", zap.Error(err))
+	}
+
 	return txn.Hash, nil
 }
 
@@ -131,7 +137,7 @@ func BlobberAdd(ctx context.Context) (string, error) {
 var ErrBlobberHasRemoved = errors.New("blobber has removed")
 
 func BlobberHealthCheck(ctx context.Context) (string, error) {
-	if config.Configuration.Capacity == 0 {
+	if config.Get().Capacity == 0 {
 		return "", ErrBlobberHasRemoved
 	}
 
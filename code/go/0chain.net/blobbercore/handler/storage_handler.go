@@ -2,8 +2,10 @@ package handler
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -259,7 +261,7 @@ func (fsh *StorageHandler) AddCollaborator(ctx context.Context, r *http.Request)
 	}
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -346,7 +348,7 @@ func (fsh *StorageHandler) GetFileStats(ctx context.Context, r *http.Request) (i
 	allocationID := allocationObj.ID
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -484,7 +486,7 @@ func (fsh *StorageHandler) getReferencePath(ctx context.Context, r *http.Request
 	allocationID := allocationObj.ID
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		errCh <- common.NewError("invalid_signature", "Invalid signature")
 		return
@@ -556,7 +558,7 @@ func (fsh *StorageHandler) GetObjectPath(ctx context.Context, r *http.Request) (
 	allocationID := allocationObj.ID
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -615,7 +617,7 @@ func (fsh *StorageHandler) GetObjectTree(ctx context.Context, r *http.Request) (
 	allocationID := allocationObj.ID
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -669,6 +671,70 @@ func (fsh *StorageHandler) GetObjectTree(ctx context.Context, r *http.Request) (
 	return &refPathResult, nil
 }
 
+// GetSyncDiff returns refs under the path which differ from the manifest
+// (path -> hash) posted by client. Client may post the hash of the path only,
+// then the whole subtree of the path is returned if the hash differs.
+func (fsh *StorageHandler) GetSyncDiff(ctx context.Context, r *http.Request) (*blobberhttp.SyncResult, error) {
+	if r.Method != "POST" {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	allocationID := allocationObj.ID
+
+	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	if !valid || err != nil {
+		return nil, common.NewError("invalid_signature", "Invalid signature")
+	}
+
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	path := r.FormValue("path")
+	if len(path) == 0 {
+		path = "/"
+	}
+	path = filepath.Clean(path)
+
+	manifest := make(map[string]string)
+	if manifestStr := r.FormValue("manifest"); len(manifestStr) > 0 {
+		if err = json.Unmarshal([]byte(manifestStr), &manifest); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid manifest. "+err.Error())
+		}
+	}
+	if hash := r.FormValue("hash"); len(hash) > 0 {
+		manifest[path] = hash
+	}
+
+	ref, err := reference.GetReference(ctx, allocationID, path)
+	if err == nil && ref.Type != reference.DIRECTORY {
+		return nil, common.NewError("invalid_parameters", "Path is not a directory")
+	}
+
+	diff, err := reference.GetSyncDiff(ctx, allocationID, path, manifest)
+	if err != nil {
+		return nil, common.NewError("sync_diff_error", err.Error())
+	}
+
+	result := &blobberhttp.SyncResult{
+		AllocationRoot: allocationObj.AllocationRoot,
+		Path:           path,
+		Changed:        make([]map[string]interface{}, len(diff.Changed)),
+		Deleted:        diff.Deleted,
+	}
+	for i, changed := range diff.Changed {
+		result.Changed[i] = changed.GetListingData(ctx)
+	}
+
+	return result, nil
+}
+
 //Retrieves file refs. One can use three types to refer to regular, updated and deleted. Regular type gives all undeleted rows.
 //Updated gives rows that is updated compared to the date given. And deleted gives deleted refs compared to the date given.
 //Updated date time format should be as declared in above constant; OffsetDateLayout
@@ -681,7 +747,7 @@ func (fsh *StorageHandler) GetRefs(ctx context.Context, r *http.Request) (*blobb
 	}
 
 	clientSign, _ := ctx.Value(constants.CLIENT_SIGNATURE_HEADER_KEY).(string)
-	valid, err := verifySignatureFromRequest(allocationTx, clientSign, allocationObj.OwnerPublicKey)
+	valid, err := verifySignatureFromRequest(ctx, allocationTx, clientSign, allocationObj.OwnerPublicKey)
 	if !valid || err != nil {
 		return nil, common.NewError("invalid_signature", "Invalid signature")
 	}
@@ -818,8 +884,34 @@ func (fsh *StorageHandler) CalculateHash(ctx context.Context, r *http.Request) (
 	return result, nil
 }
 
+func init() {
+	common.SetClientVerifier(verifyClient)
+}
+
+// verifyClient verifies the client ID is of the client key and the allocation
+// is signed by it.
+func verifyClient(clientID, clientKey, sign, allocation string) bool {
+	if allocation == "" {
+		return false
+	}
+	clientKeyBytes, err := hex.DecodeString(clientKey)
+	if err != nil || encryption.Hash(clientKeyBytes) != clientID {
+		return false
+	}
+	valid, err := verifySignature(allocation, sign, clientKey)
+	return err == nil && valid
+}
+
 // verifySignatureFromRequest verifies signature passed as common.ClientSignatureHeader header.
-func verifySignatureFromRequest(allocation, sign, pbK string) (bool, error) {
+// The signature verified by the quota limiter already is not verified again.
+func verifySignatureFromRequest(ctx context.Context, allocation, sign, pbK string) (bool, error) {
+	if common.IsVerifiedClient(ctx, pbK, sign, allocation) {
+		return true, nil
+	}
+	return verifySignature(allocation, sign, pbK)
+}
+
+func verifySignature(allocation, sign, pbK string) (bool, error) {
 	sign = encryption.MiraclToHerumiSig(sign)
 
 	if len(sign) < 64 {
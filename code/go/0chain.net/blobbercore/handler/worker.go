@@ -9,6 +9,7 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/reference"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/stats"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/lock"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
@@ -19,6 +20,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// cleanupLockWait is how long the disk cleanup waits for the lock of an allocation
+const cleanupLockWait = time.Second
+
 func SetupWorkers(ctx context.Context) {
 	go CleanupTempFiles(ctx)
 	if config.Configuration.MinioStart {
@@ -31,8 +35,15 @@ func CleanupDiskFiles(ctx context.Context) error {
 	var allocations []allocation.Allocation
 	db.Find(&allocations)
 	for _, allocationObj := range allocations {
-		mutex := lock.GetMutex(allocationObj.TableName(), allocationObj.ID)
-		mutex.Lock()
+		//an allocation locked by a commit is skipped rather than waited for, it's cleaned up next time
+		mutex := lock.GetLocker(allocationObj.TableName(), allocationObj.ID)
+		lctx, cancel := context.WithTimeout(ctx, cleanupLockWait)
+		err := mutex.TryLock(lctx)
+		cancel()
+		if err != nil {
+			Logger.Info("Skipping the cleanup of disk files of the locked allocation", zap.String("allocation_id", allocationObj.ID), zap.Error(err))
+			continue
+		}
 		_ = filestore.GetFileStore().IterateObjects(allocationObj.ID, func(contentHash string, contentSize int64) {
 			var refs []reference.Ref
 			err := db.Table((reference.Ref{}).TableName()).Where(reference.Ref{ContentHash: contentHash, Type: reference.FILE}).Or(reference.Ref{ThumbnailHash: contentHash, Type: reference.FILE}).Find(&refs).Error
@@ -54,19 +65,22 @@ func CleanupDiskFiles(ctx context.Context) error {
 
 func CleanupTempFiles(ctx context.Context) {
 	var iterInprogress = false
-	ticker := time.NewTicker(time.Duration(config.Configuration.OpenConnectionWorkerFreq) * time.Second)
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-time.After(time.Duration(config.Get().OpenConnectionWorkerFreq) * time.Second):
 			//Logger.Info("Trying to redeem writemarkers.", zap.Any("iterInprogress", iterInprogress), zap.Any("numOfWorkers", numOfWorkers))
 			if !iterInprogress {
+				end, err := common.StartOperation("worker", "cleanup_temp_files")
+				if err != nil {
+					return
+				}
 				iterInprogress = true //nolint:ineffassign // probably has something to do with goroutines
 				rctx := datastore.GetStore().CreateTransaction(ctx)
 				db := datastore.GetStore().GetTransaction(rctx)
 				now := time.Now()
-				then := now.Add(time.Duration(-config.Configuration.OpenConnectionWorkerTolerance) * time.Second)
+				then := now.Add(time.Duration(-config.Get().OpenConnectionWorkerTolerance) * time.Second)
 				var openConnectionsToDelete []allocation.AllocationChangeCollector
 				db.Table((&allocation.AllocationChangeCollector{}).TableName()).Where("updated_at < ? AND status IN (?,?)", then, allocation.NewConnection, allocation.InProgressConnection).Preload("Changes").Find(&openConnectionsToDelete)
 				for _, connection := range openConnectionsToDelete {
@@ -79,6 +93,9 @@ func CleanupTempFiles(ctx context.Context) {
 							Logger.Error("AllocationChangeProcessor_DeleteTempFile", zap.Error(err))
 						}
 					}
+					if err := allocation.DeleteResumableUploads(nctx, connection.ConnectionID); err != nil {
+						Logger.Error("DeleteResumableUploads", zap.String("connection_id", connection.ConnectionID), zap.Error(err))
+					}
 					ndb.Model(connection).Updates(allocation.AllocationChangeCollector{Status: allocation.DeletedConnection})
 					ndb.Commit()
 					nctx.Done()
@@ -86,6 +103,7 @@ func CleanupTempFiles(ctx context.Context) {
 				db.Rollback()
 				rctx.Done()
 				iterInprogress = false
+				end()
 			}
 		}
 	}
@@ -93,24 +111,29 @@ func CleanupTempFiles(ctx context.Context) {
 
 func MoveColdDataToCloud(ctx context.Context) {
 	var iterInprogress = false
-	var coldStorageMinFileSize = config.Configuration.ColdStorageMinimumFileSize
-	var limit = config.Configuration.ColdStorageJobQueryLimit
-	ticker := time.NewTicker(time.Duration(config.Configuration.MinioWorkerFreq) * time.Second)
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-time.After(time.Duration(config.Get().MinioWorkerFreq) * time.Second):
 			if !iterInprogress {
+				conf := config.Get()
+				var coldStorageMinFileSize = conf.ColdStorageMinimumFileSize
+				var limit = conf.ColdStorageJobQueryLimit
+				end, err := common.StartOperation("worker", "move_cold_data")
+				if err != nil {
+					return
+				}
 				fs := filestore.GetFileStore()
 				totalDiskSizeUsed, err := fs.GetTotalDiskSizeUsed()
 				if err != nil {
 					Logger.Error("Unable to get total disk size used from the file store", zap.Error(err))
+					end()
 					return
 				}
 
 				// Check if capacity exceded the start capacity size
-				if totalDiskSizeUsed > config.Configuration.ColdStorageStartCapacitySize {
+				if totalDiskSizeUsed > conf.ColdStorageStartCapacitySize {
 					rctx := datastore.GetStore().CreateTransaction(ctx)
 					db := datastore.GetStore().GetTransaction(rctx)
 					// Get total number of fileRefs with size greater than limit and on_cloud = false
@@ -139,7 +162,7 @@ func MoveColdDataToCloud(ctx context.Context) {
 								continue
 							}
 
-							timeToAdd := time.Duration(config.Configuration.ColdStorageTimeLimitInHours) * time.Hour
+							timeToAdd := time.Duration(conf.ColdStorageTimeLimitInHours) * time.Hour
 							if fileStat.UpdatedAt.Before(time.Now().Add(-1 * timeToAdd)) {
 								Logger.Info("Moving file to cloud", zap.Any("path", fileRef.Path), zap.Any("allocation", fileRef.AllocationID))
 								moveFileToCloud(ctx, fileRef)
@@ -153,6 +176,7 @@ func MoveColdDataToCloud(ctx context.Context) {
 				iterInprogress = false
 				stats.LastMinioScan = time.Now()
 				Logger.Info("Move cold data to cloud worker running successfully")
+				end()
 			}
 		}
 	}
@@ -191,7 +215,7 @@ func moveFileToCloud(ctx context.Context, fileRef *reference.Ref) {
 	ctx.Done()
 	Logger.Info("Successfully uploaded file to cloud", zap.Any("file_name", fileRef.Name), zap.Any("allocation", fileRef.AllocationID))
 
-	if config.Configuration.ColdStorageDeleteLocalCopy {
+	if config.Get().ColdStorageDeleteLocalCopy {
 		err = os.Remove(fileObjectPath)
 		if err != nil {
 			Logger.Error("Error deleting file after upload to cold storage", zap.Error(err))
@@ -0,0 +1,203 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// WorkersLease is the name of the lease of the replica running the workers.
+const WorkersLease = "workers"
+
+// Status of the leader election of the replica.
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	ID      string `json:"id,omitempty"`
+	Leader  bool   `json:"leader"`
+	// LeaderSince is the time the replica leads since.
+	LeaderSince time.Time `json:"leader_since,omitempty"`
+	// RenewedAt is the last time the replica renewed its lease.
+	RenewedAt time.Time `json:"renewed_at,omitempty"`
+	// Lease is the lease in the DB, of this or another replica.
+	Lease *Lease `json:"lease,omitempty"`
+}
+
+// Elector elects the leader of the replicas of the blobber using the same DB
+// by a lease of the DB. The leader renews the lease every renew interval and
+// steps down if it can't renew it before it expires, another replica takes
+// the lead once the lease expires.
+type Elector struct {
+	db    *gorm.DB
+	name  string
+	id    string
+	lease time.Duration
+	renew time.Duration
+
+	mu          sync.Mutex
+	leading     bool
+	leaderSince time.Time
+	renewedAt   time.Time
+}
+
+// NewElector returns the elector of the replica of the ID for the lease of
+// the name.
+func NewElector(db *gorm.DB, name, id string, lease, renew time.Duration) *Elector {
+	return &Elector{db: db, name: name, id: id, lease: lease, renew: renew}
+}
+
+var (
+	electorMu sync.Mutex
+	elector   *Elector
+)
+
+// GetStatus returns the status of the leader election run, a replica not
+// electing leads.
+func GetStatus() *Status {
+	electorMu.Lock()
+	e := elector
+	electorMu.Unlock()
+	if e == nil {
+		return &Status{Leader: true}
+	}
+	return e.Status()
+}
+
+// Status returns the status of the replica.
+func (e *Elector) Status() *Status {
+	e.mu.Lock()
+	s := &Status{
+		Enabled:     true,
+		ID:          e.id,
+		Leader:      e.leading,
+		LeaderSince: e.leaderSince,
+		RenewedAt:   e.renewedAt,
+	}
+	e.mu.Unlock()
+
+	lease, err := GetLease(e.db, e.name)
+	if err == nil {
+		s.Lease = lease
+	}
+	return s
+}
+
+// IsLeader returns true while the replica leads.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run runs the election until the context is done, the lead function is run
+// while the replica leads with a context canceled once it steps down. The
+// replica waits for the lead function to return before it releases the lease
+// or tries to lead again, up to the lease expiration, so the workers of two
+// replicas don't overlap.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	electorMu.Lock()
+	elector = e
+	electorMu.Unlock()
+
+	var (
+		cancel  context.CancelFunc
+		led     chan struct{}
+		endLead func()
+	)
+
+	// an attempt ends in time to step down before the lease expires
+	timeout := (e.lease - e.renew) / 2
+	release := func() {
+		// let another replica take the lead right away
+		rctx, rcancel := context.WithTimeout(context.Background(), timeout)
+		err := releaseLease(e.db.WithContext(rctx), e.name, e.id)
+		rcancel()
+		if err != nil {
+			Logger.Error("Error releasing the leader lease", zap.Error(err))
+		}
+	}
+
+	stepDown := func(reason string, releasing bool) {
+		if cancel == nil {
+			return
+		}
+		Logger.Warn("Stepping down as the leader", zap.String("id", e.id), zap.String("reason", reason))
+		cancel()
+		cancel = nil
+		e.mu.Lock()
+		e.leading = false
+		expires := e.renewedAt.Add(e.lease)
+		e.mu.Unlock()
+
+		select {
+		case <-led:
+		case <-time.After(time.Until(expires)):
+			Logger.Error("The workers are still running once the leader lease expired", zap.String("id", e.id))
+		}
+		if releasing {
+			release()
+		}
+		endLead()
+	}
+
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		actx, acancel := context.WithTimeout(ctx, timeout)
+		acquired, err := acquireLease(e.db.WithContext(actx), e.name, e.id, e.lease)
+		acancel()
+		switch {
+		case err != nil:
+			Logger.Error("Error renewing the leader lease", zap.Error(err))
+			// the others take the lead once the lease expires, step down
+			// unless the next attempt ends while the last renewal holds
+			e.mu.Lock()
+			expiring := cancel != nil && time.Since(e.renewedAt)+e.renew+timeout >= e.lease
+			e.mu.Unlock()
+			if expiring {
+				stepDown("lease not renewed", false)
+			}
+		case !acquired:
+			stepDown("lease taken by another replica", false)
+		case cancel == nil:
+			// the shutdown waits for the lead to end and the lease release
+			end, err := common.StartOperation("leader", e.id)
+			if err != nil {
+				release()
+				break
+			}
+			e.mu.Lock()
+			e.renewedAt = now
+			e.leading = true
+			e.leaderSince = now
+			e.mu.Unlock()
+			Logger.Info("Leading the replicas", zap.String("id", e.id))
+			var lctx context.Context
+			lctx, cancel = context.WithCancel(ctx)
+			led, endLead = make(chan struct{}), end
+			go func(led chan struct{}) {
+				defer close(led)
+				lead(lctx)
+			}(led)
+		default:
+			e.mu.Lock()
+			e.renewedAt = now
+			e.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			if cancel != nil {
+				stepDown("shutting down", true)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package leader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) (*gorm.DB, func()) {
+	logging.Logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "leader")
+	require.NoError(t, err)
+
+	config.Configuration.DBDriver = datastore.SQLiteDriver
+	config.Configuration.DBPath = filepath.Join(dir, "blobber_meta.db")
+	db, err := datastore.OpenDB()
+	require.NoError(t, err)
+	require.NoError(t, datastore.Migrate(db, datastore.LatestVersion()))
+	return db, func() {
+		config.Configuration.DBDriver = ""
+		if sqldb, err := db.DB(); err == nil {
+			sqldb.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	start := time.Now().UnixNano() / int64(time.Millisecond)
+	ok, err := acquireLease(db, WorkersLease, "a", time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+	lease, err := GetLease(db, WorkersLease)
+	require.NoError(t, err)
+	require.InDelta(t, start, lease.AcquiredAt, 1000)
+	require.InDelta(t, start+time.Hour.Milliseconds(), lease.ExpiresAt, 1000)
+
+	// not expired
+	ok, err = acquireLease(db, WorkersLease, "b", time.Hour)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// renewed by the holder
+	ok, err = acquireLease(db, WorkersLease, "a", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	renewed, err := GetLease(db, WorkersLease)
+	require.NoError(t, err)
+	require.Equal(t, "a", renewed.Holder)
+	require.Equal(t, lease.AcquiredAt, renewed.AcquiredAt)
+
+	// expired
+	time.Sleep(10 * time.Millisecond)
+	ok, err = acquireLease(db, WorkersLease, "b", time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+	lease, err = GetLease(db, WorkersLease)
+	require.NoError(t, err)
+	require.Equal(t, "b", lease.Holder)
+	require.True(t, lease.AcquiredAt > renewed.AcquiredAt)
+}
+
+func TestElectorFailover(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	var leading [2]int32
+	run := func(ctx context.Context, id string, i int) (*Elector, chan struct{}) {
+		e := NewElector(db, WorkersLease, id, time.Second, 50*time.Millisecond)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			e.Run(ctx, func(lctx context.Context) {
+				atomic.StoreInt32(&leading[i], 1)
+				<-lctx.Done()
+				atomic.StoreInt32(&leading[i], 0)
+			})
+		}()
+		return e, done
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	a, doneA := run(ctxA, "a", 0)
+	require.Eventually(t, a.IsLeader, time.Second, 10*time.Millisecond)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	b, doneB := run(ctxB, "b", 1)
+	defer func() {
+		cancelB()
+		<-doneB
+	}()
+	time.Sleep(200 * time.Millisecond)
+	require.False(t, b.IsLeader())
+	require.EqualValues(t, 1, atomic.LoadInt32(&leading[0]))
+
+	// the leader shuts down and releases the lease
+	cancelA()
+	<-doneA
+	require.Eventually(t, b.IsLeader, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&leading[0]) == 0 && atomic.LoadInt32(&leading[1]) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, a.IsLeader())
+
+	status := b.Status()
+	require.True(t, status.Leader)
+	require.Equal(t, "b", status.Lease.Holder)
+}
+
+func TestElectorWaitsForLead(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	var finished int32
+	e := NewElector(db, WorkersLease, "a", time.Second, 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, func(lctx context.Context) {
+			<-lctx.Done()
+			// an iteration of a worker in flight
+			time.Sleep(100 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+		})
+	}()
+	require.Eventually(t, e.IsLeader, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	require.EqualValues(t, 1, atomic.LoadInt32(&finished))
+	lease, err := GetLease(db, WorkersLease)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, lease.ExpiresAt)
+}
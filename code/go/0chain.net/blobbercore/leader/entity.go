@@ -0,0 +1,62 @@
+package leader
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lease of the leadership of the replicas, held by the leader until it
+// expires. The times are of the DB, in unix milliseconds.
+type Lease struct {
+	Name       string `gorm:"column:name;primaryKey" json:"name"`
+	Holder     string `gorm:"column:holder" json:"holder"`
+	AcquiredAt int64  `gorm:"column:acquired_at" json:"acquired_at"`
+	ExpiresAt  int64  `gorm:"column:expires_at" json:"expires_at"`
+}
+
+func (Lease) TableName() string {
+	return "leader_leases"
+}
+
+// dbNow returns the SQL expression of the time of the DB in unix
+// milliseconds. The leases are compared by the time of the DB, so the clocks
+// of the replicas don't have to be in sync.
+func dbNow(db *gorm.DB) string {
+	if db.Dialector.Name() == "sqlite" {
+		return "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)"
+	}
+	return "CAST(EXTRACT(EPOCH FROM clock_timestamp()) * 1000 AS BIGINT)"
+}
+
+// acquireLease acquires or renews the lease for the holder for the duration,
+// unless another holder has a lease not expired.
+func acquireLease(db *gorm.DB, name, holder string, lease time.Duration) (bool, error) {
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Lease{Name: name}).Error
+	if err != nil {
+		return false, err
+	}
+	now := dbNow(db)
+	res := db.Model(&Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at < "+now+")", name, holder).
+		Updates(map[string]interface{}{
+			"acquired_at": gorm.Expr("CASE WHEN holder = ? THEN acquired_at ELSE "+now+" END", holder),
+			"holder":      holder,
+			"expires_at":  gorm.Expr(now+" + ?", lease.Milliseconds()),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// releaseLease expires the lease of the holder.
+func releaseLease(db *gorm.DB, name, holder string) error {
+	return db.Model(&Lease{}).Where("name = ? AND holder = ?", name, holder).
+		Update("expires_at", 0).Error
+}
+
+// GetLease returns the lease of the name.
+func GetLease(db *gorm.DB, name string) (*Lease, error) {
+	lease := new(Lease)
+	err := db.Where("name = ?", name).Take(lease).Error
+	return lease, err
+}
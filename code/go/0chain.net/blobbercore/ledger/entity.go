@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"context"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kind of the earning.
+type Kind string
+
+const (
+	ReadRedeem       Kind = "read_redeem"
+	WriteRedeem      Kind = "write_redeem"
+	ChallengeReward  Kind = "challenge_reward"
+	ChallengePenalty Kind = "challenge_penalty"
+	MinLockDemand    Kind = "min_lock_demand"
+)
+
+// Entry is a record of tokens earned (or lost) by the blobber.
+type Entry struct {
+	ID           int64  `gorm:"column:id;primary_key" json:"id"`
+	Kind         Kind   `gorm:"column:kind" json:"kind"`
+	AllocationID string `gorm:"column:allocation_id" json:"allocation_id"`
+	ClientID     string `gorm:"column:client_id" json:"client_id"`
+	PayerID      string `gorm:"column:payer_id" json:"payer_id"`
+	// RefID is the marker or the challenge of the entry
+	RefID     string `gorm:"column:ref_id" json:"ref_id"`
+	Tokens    int64  `gorm:"column:tokens" json:"tokens"`
+	NumBlocks int64  `gorm:"column:num_blocks" json:"num_blocks"`
+	Size      int64  `gorm:"column:size" json:"size"`
+	TxnHash   string `gorm:"column:txn_hash" json:"txn_hash"`
+	// CreatedAt is the time of the transaction confirmation
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (Entry) TableName() string {
+	return "earnings_ledger"
+}
+
+// Add saves the entry within the DB transaction of the context, usually the
+// one updating the redeemed marker or the committed challenge. An entry of
+// the same kind, reference and transaction is saved once.
+func Add(ctx context.Context, e *Entry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(e).Error
+}
+
+// Unrecorded returns the tokens of the kind the storage smart contract moved
+// for the allocation so far less the ones in the ledger already. The smart
+// contract keeps the totals of the blobber allocation only, so an entry gets
+// the tokens moved since the previous one.
+func Unrecorded(ctx context.Context, kind Kind, allocationID string, total int64) (int64, error) {
+	var recorded int64
+	err := (&Filter{Kind: kind, AllocationID: allocationID}).apply(ctx).
+		Select("COALESCE(SUM(tokens), 0)").Row().Scan(&recorded)
+	if err != nil {
+		return 0, err
+	}
+	if total < recorded {
+		return 0, nil
+	}
+	return total - recorded, nil
+}
+
+// Filter selects entries of the ledger, the empty fields are not applied.
+type Filter struct {
+	Kind         Kind
+	AllocationID string
+	ClientID     string
+	PayerID      string
+	From, To     time.Time
+}
+
+func (f *Filter) apply(ctx context.Context) *gorm.DB {
+	db := datastore.GetStore().GetTransaction(ctx).Model(&Entry{})
+	if f.Kind != "" {
+		db = db.Where("kind = ?", f.Kind)
+	}
+	if f.AllocationID != "" {
+		db = db.Where("allocation_id = ?", f.AllocationID)
+	}
+	if f.ClientID != "" {
+		db = db.Where("client_id = ?", f.ClientID)
+	}
+	if f.PayerID != "" {
+		db = db.Where("payer_id = ?", f.PayerID)
+	}
+	if !f.From.IsZero() {
+		db = db.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		db = db.Where("created_at < ?", f.To)
+	}
+	return db
+}
+
+// Find returns the entries in the order of creation.
+func Find(ctx context.Context, f *Filter, offset, limit int) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	db := f.apply(ctx).Order("created_at, id").Offset(offset)
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&entries).Error
+	return entries, err
+}
+
+// Each calls the function with the pages of the entries matching the filter,
+// ordered as by Find, until it returns an error. The next page is read after
+// the last entry of the previous one, so the entries added meanwhile don't
+// shift the pages.
+func Each(ctx context.Context, f *Filter, pageSize int, fn func([]*Entry) error) error {
+	var last *Entry
+	for {
+		db := f.apply(ctx)
+		if last != nil {
+			db = db.Where("created_at > ? OR (created_at = ? AND id > ?)",
+				last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		entries := make([]*Entry, 0, pageSize)
+		if err := db.Order("created_at, id").Limit(pageSize).Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := fn(entries); err != nil {
+			return err
+		}
+		if len(entries) < pageSize {
+			return nil
+		}
+		last = entries[len(entries)-1]
+	}
+}
+
+// Total of the entries of a group.
+type Total struct {
+	Group     string `gorm:"column:grp" json:"group"`
+	Kind      Kind   `gorm:"column:kind" json:"kind"`
+	Entries   int64  `gorm:"column:entries" json:"entries"`
+	Tokens    int64  `gorm:"column:tokens" json:"tokens"`
+	NumBlocks int64  `gorm:"column:num_blocks" json:"num_blocks"`
+	Size      int64  `gorm:"column:size" json:"size"`
+}
+
+// groupColumns are the columns entries can be summarized by
+var groupColumns = map[string]string{
+	"allocation": "allocation_id",
+	"client":     "client_id",
+	"payer":      "payer_id",
+}
+
+// IsGroup returns true if the entries can be summarized by the group.
+func IsGroup(group string) bool {
+	_, ok := groupColumns[group]
+	return ok
+}
+
+// Summarize returns totals of the entries per group ('allocation', 'client'
+// or 'payer') and kind.
+func Summarize(ctx context.Context, f *Filter, group string) ([]*Total, error) {
+	column, ok := groupColumns[group]
+	if !ok {
+		column = groupColumns["allocation"]
+	}
+	totals := make([]*Total, 0)
+	err := f.apply(ctx).
+		Select(column + " AS grp, kind, COUNT(*) AS entries, " +
+			"SUM(tokens) AS tokens, SUM(num_blocks) AS num_blocks, SUM(size) AS size").
+		Group(column + ", kind").
+		Order(column + ", kind").
+		Scan(&totals).Error
+	return totals, err
+}
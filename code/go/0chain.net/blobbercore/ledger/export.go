@@ -0,0 +1,123 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{
+	"id", "created_at", "kind", "allocation_id", "client_id", "payer_id",
+	"ref_id", "tokens", "num_blocks", "size", "txn_hash",
+}
+
+// Exporter writes the entries page by page, so an export of any size isn't
+// kept in memory. Close ends the file.
+type Exporter interface {
+	Write(entries []*Entry) error
+	Close() error
+}
+
+type csvExporter struct {
+	cw     *csv.Writer
+	header bool
+}
+
+// NewCSVExporter returns the exporter writing the entries as CSV with a
+// header row.
+func NewCSVExporter(w io.Writer) Exporter {
+	return &csvExporter{cw: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.cw.Write(csvHeader)
+}
+
+func (e *csvExporter) Write(entries []*Entry) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := e.cw.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			string(entry.Kind),
+			entry.AllocationID,
+			entry.ClientID,
+			entry.PayerID,
+			entry.RefID,
+			strconv.FormatInt(entry.Tokens, 10),
+			strconv.FormatInt(entry.NumBlocks, 10),
+			strconv.FormatInt(entry.Size, 10),
+			entry.TxnHash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+func (e *csvExporter) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+type jsonExporter struct {
+	w       io.Writer
+	written bool
+}
+
+// NewJSONExporter returns the exporter writing the entries as a JSON array.
+func NewJSONExporter(w io.Writer) Exporter {
+	return &jsonExporter{w: w}
+}
+
+func (e *jsonExporter) Write(entries []*Entry) error {
+	for _, entry := range entries {
+		sep := ","
+		if !e.written {
+			sep = "["
+			e.written = true
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(e.w, sep); err != nil {
+			return err
+		}
+		if _, err = e.w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonExporter) Close() error {
+	end := "]\n"
+	if !e.written {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// WriteCSV writes the entries as CSV with a header row.
+func WriteCSV(w io.Writer, entries []*Entry) error {
+	e := NewCSVExporter(w)
+	if err := e.Write(entries); err != nil {
+		return err
+	}
+	return e.Close()
+}
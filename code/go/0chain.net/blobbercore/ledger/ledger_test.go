@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWriteCSV(t *testing.T) {
+	entries := []*Entry{{
+		ID:           1,
+		Kind:         ReadRedeem,
+		AllocationID: "allocation_1",
+		ClientID:     "client_1",
+		PayerID:      "payer_1",
+		RefID:        "client_1:allocation_1:payer_1",
+		Tokens:       100,
+		NumBlocks:    2,
+		Size:         131072,
+		TxnHash:      "hash_1",
+		CreatedAt:    time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, entries))
+	assert.Equal(t,
+		"id,created_at,kind,allocation_id,client_id,payer_id,ref_id,tokens,num_blocks,size,txn_hash\n"+
+			"1,2021-06-01T12:00:00Z,read_redeem,allocation_1,client_1,payer_1,client_1:allocation_1:payer_1,100,2,131072,hash_1\n",
+		buf.String())
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewJSONExporter(&buf)
+	require.NoError(t, e.Close())
+	assert.Equal(t, "[]\n", buf.String())
+
+	buf.Reset()
+	e = NewJSONExporter(&buf)
+	require.NoError(t, e.Write([]*Entry{{ID: 1}}))
+	require.NoError(t, e.Write([]*Entry{{ID: 2}}))
+	require.NoError(t, e.Close())
+	var entries []*Entry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.EqualValues(t, 2, entries[1].ID)
+}
+
+func TestIsGroup(t *testing.T) {
+	assert.True(t, IsGroup("allocation"))
+	assert.True(t, IsGroup("payer"))
+	assert.False(t, IsGroup("kind; DROP TABLE"))
+}
+
+func TestUnrecorded(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config.Configuration.DBDriver = datastore.SQLiteDriver
+	config.Configuration.DBPath = filepath.Join(dir, "blobber_meta.db")
+	defer func() { config.Configuration.DBDriver = "" }()
+	require.NoError(t, datastore.GetStore().Open())
+	defer datastore.GetStore().Close()
+	require.NoError(t, datastore.Migrate(datastore.GetStore().GetDB(), datastore.LatestVersion()))
+
+	ctx := datastore.GetStore().CreateTransaction(context.Background())
+	defer datastore.GetStore().GetTransaction(ctx).Rollback()
+
+	tokens, err := Unrecorded(ctx, WriteRedeem, "allocation_1", 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, tokens)
+
+	require.NoError(t, Add(ctx, &Entry{Kind: WriteRedeem, AllocationID: "allocation_1", RefID: "r1", Tokens: 100}))
+	require.NoError(t, Add(ctx, &Entry{Kind: ChallengeReward, AllocationID: "allocation_1", RefID: "c1", Tokens: 7}))
+
+	// the tokens moved since the previous entry
+	tokens, err = Unrecorded(ctx, WriteRedeem, "allocation_1", 250)
+	require.NoError(t, err)
+	assert.EqualValues(t, 150, tokens)
+
+	tokens, err = Unrecorded(ctx, WriteRedeem, "allocation_1", 100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, tokens)
+}
+
+func TestEach(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config.Configuration.DBDriver = datastore.SQLiteDriver
+	config.Configuration.DBPath = filepath.Join(dir, "blobber_meta.db")
+	defer func() { config.Configuration.DBDriver = "" }()
+	require.NoError(t, datastore.GetStore().Open())
+	defer datastore.GetStore().Close()
+	require.NoError(t, datastore.Migrate(datastore.GetStore().GetDB(), datastore.LatestVersion()))
+
+	ctx := datastore.GetStore().CreateTransaction(context.Background())
+	defer datastore.GetStore().GetTransaction(ctx).Rollback()
+
+	// the entries of the same time are paged by the id
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, Add(ctx, &Entry{Kind: ChallengeReward, AllocationID: "allocation_1",
+			RefID: "c" + strconv.Itoa(i), Tokens: 1, CreatedAt: created.Add(time.Duration(i/2) * time.Second)}))
+	}
+	require.NoError(t, Add(ctx, &Entry{Kind: ChallengeReward, AllocationID: "allocation_2", RefID: "c", Tokens: 1}))
+
+	var pages, entries int
+	err = Each(ctx, &Filter{AllocationID: "allocation_1"}, 2, func(page []*Entry) error {
+		pages++
+		entries += len(page)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, 5, entries)
+}
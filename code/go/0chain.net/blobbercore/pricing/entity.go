@@ -0,0 +1,62 @@
+package pricing
+
+import (
+	"context"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+)
+
+// PriceHistory is a record of prices advertised on chain.
+type PriceHistory struct {
+	ID int64 `gorm:"column:id;primary_key" json:"-"`
+	// ReadPrice and WritePrice are the values sent with the blobber update
+	ReadPrice     int64     `gorm:"column:read_price" json:"read_price"`
+	WritePrice    int64     `gorm:"column:write_price" json:"write_price"`
+	Dynamic       bool      `gorm:"column:dynamic" json:"dynamic"`
+	Utilization   float64   `gorm:"column:utilization" json:"utilization"`
+	ReadBandwidth float64   `gorm:"column:read_bandwidth" json:"read_bandwidth"`
+	TxnHash       string    `gorm:"column:txn_hash" json:"txn_hash"`
+	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (PriceHistory) TableName() string {
+	return "price_history"
+}
+
+// RecordAdvertised saves the prices sent by the blobber update transaction.
+func RecordAdvertised(ctx context.Context, readPrice, writePrice int64, txnHash string) error {
+	ph := &PriceHistory{
+		ReadPrice:  readPrice,
+		WritePrice: writePrice,
+		TxnHash:    txnHash,
+		CreatedAt:  time.Now(),
+	}
+
+	mu.RLock()
+	if cfg.Enabled && current != nil {
+		ph.Dynamic = true
+		ph.Utilization = current.Utilization
+		ph.ReadBandwidth = current.ReadBandwidth
+	}
+	mu.RUnlock()
+
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(ctx)
+	if err := db.Create(ph).Error; err != nil {
+		db.Rollback()
+		return err
+	}
+	return db.Commit().Error
+}
+
+// GetHistory returns the latest advertised prices, the newest first.
+func GetHistory(ctx context.Context, since time.Time, limit int) ([]*PriceHistory, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	history := make([]*PriceHistory, 0)
+	err := db.Where("created_at >= ?", since).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&history).Error
+	return history, err
+}
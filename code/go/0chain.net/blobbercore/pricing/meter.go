@@ -0,0 +1,61 @@
+package pricing
+
+import (
+	"sync"
+	"time"
+)
+
+// meterBuckets is the number of buckets of the read meter window
+const meterBuckets = 60
+
+// readMeter counts bytes read within a sliding window.
+type readMeter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	step    time.Duration
+	buckets [meterBuckets]int64
+	last    int64 // index of the latest bucket since the epoch
+}
+
+func newReadMeter(window time.Duration) *readMeter {
+	step := window / meterBuckets
+	if step <= 0 {
+		step = time.Second
+	}
+	return &readMeter{window: step * meterBuckets, step: step}
+}
+
+// advance moves the window to the time, clearing the buckets passed by.
+func (m *readMeter) advance(now time.Time) int64 {
+	idx := now.UnixNano() / int64(m.step)
+	if idx-m.last >= meterBuckets {
+		m.buckets = [meterBuckets]int64{}
+	} else {
+		for i := m.last + 1; i <= idx; i++ {
+			m.buckets[i%meterBuckets] = 0
+		}
+	}
+	if idx > m.last {
+		m.last = idx
+	}
+	return idx
+}
+
+func (m *readMeter) add(now time.Time, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := m.advance(now)
+	m.buckets[idx%meterBuckets] += size
+}
+
+// bandwidth returns average bytes per second within the window.
+func (m *readMeter) bandwidth(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance(now)
+	var total int64
+	for _, b := range m.buckets {
+		total += b
+	}
+	return float64(total) / m.window.Seconds()
+}
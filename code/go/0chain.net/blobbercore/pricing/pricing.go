@@ -0,0 +1,207 @@
+package pricing
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
+	"github.com/spf13/viper"
+)
+
+// CurvePoint maps a load (utilization of the capacity or of the read bandwidth
+// target, usually in [0; 1]) to a multiplier of the configured price.
+type CurvePoint struct {
+	Load       float64 `mapstructure:"load"`
+	Multiplier float64 `mapstructure:"multiplier"`
+}
+
+// Curve is a piecewise linear function of the load. The multiplier is constant
+// before the first and after the last point. An empty curve keeps the price.
+type Curve []CurvePoint
+
+// Multiplier returns the multiplier of the price at the load.
+func (c Curve) Multiplier(load float64) float64 {
+	if len(c) == 0 {
+		return 1
+	}
+	if load <= c[0].Load {
+		return c[0].Multiplier
+	}
+	for i := 1; i < len(c); i++ {
+		if load <= c[i].Load {
+			lo, hi := c[i-1], c[i]
+			return lo.Multiplier + (load-lo.Load)/(hi.Load-lo.Load)*(hi.Multiplier-lo.Multiplier)
+		}
+	}
+	return c[len(c)-1].Multiplier
+}
+
+// PriceConfig is a curve with bounds of the resulting price, in the units of
+// the configured price (tokens or USD). A zero bound is not applied.
+type PriceConfig struct {
+	Curve   Curve   `mapstructure:"curve"`
+	Floor   float64 `mapstructure:"floor"`
+	Ceiling float64 `mapstructure:"ceiling"`
+}
+
+func (pc *PriceConfig) price(base, load float64) float64 {
+	price := base * pc.Curve.Multiplier(load)
+	if pc.Ceiling > 0 {
+		price = math.Min(price, pc.Ceiling)
+	}
+	return math.Max(price, pc.Floor)
+}
+
+// Config is the 'pricing' section of the configuration.
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// UpdateInterval is the time between recalculations of the prices
+	UpdateInterval time.Duration `mapstructure:"update_interval"`
+	// MinChange is the relative change of a price required to publish it,
+	// so the blobber is not updated on chain for every small change
+	MinChange float64 `mapstructure:"min_change"`
+	// ReadBandwidthTarget in bytes per second is the read bandwidth
+	// considered as the full load
+	ReadBandwidthTarget float64 `mapstructure:"read_bandwidth_target"`
+	// ReadWindow is the time the read bandwidth is measured over
+	ReadWindow time.Duration `mapstructure:"read_window"`
+
+	Read  PriceConfig `mapstructure:"read"`
+	Write PriceConfig `mapstructure:"write"`
+}
+
+// Prices computed for the load.
+type Prices struct {
+	ReadPrice     float64 `json:"read_price"`
+	WritePrice    float64 `json:"write_price"`
+	Utilization   float64 `json:"utilization"`
+	ReadBandwidth float64 `json:"read_bandwidth"`
+}
+
+// Compute returns prices for the capacity utilization and the read bandwidth.
+// The write price follows the utilization, the read price follows the read
+// bandwidth relative to the target.
+func (c *Config) Compute(readPrice, writePrice, utilization, readBandwidth float64) Prices {
+	readLoad := 0.0
+	if c.ReadBandwidthTarget > 0 {
+		readLoad = readBandwidth / c.ReadBandwidthTarget
+	}
+	return Prices{
+		ReadPrice:     c.Read.price(readPrice, readLoad),
+		WritePrice:    c.Write.price(writePrice, utilization),
+		Utilization:   utilization,
+		ReadBandwidth: readBandwidth,
+	}
+}
+
+func changed(prev, next, minChange float64) bool {
+	if prev == 0 {
+		return next != 0
+	}
+	return math.Abs(next-prev)/prev > minChange
+}
+
+var (
+	mu      sync.RWMutex
+	cfg     Config
+	current *Prices
+	meter   = newReadMeter(time.Hour)
+)
+
+// Setup reads the configuration, the configured prices are used until the
+// first recalculation.
+func Setup() {
+	var c Config
+	if err := viper.UnmarshalKey("pricing", &c); err != nil {
+		panic(err)
+	}
+	for _, pc := range []*PriceConfig{&c.Read, &c.Write} {
+		sort.Slice(pc.Curve, func(i, j int) bool {
+			return pc.Curve[i].Load < pc.Curve[j].Load
+		})
+	}
+	if c.ReadWindow <= 0 {
+		c.ReadWindow = time.Hour
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+	current = nil
+	meter = newReadMeter(c.ReadWindow)
+}
+
+// Enabled returns true if the prices are computed from the load.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return cfg.Enabled
+}
+
+// UpdateInterval returns the time between recalculations of the prices.
+func UpdateInterval() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	return cfg.UpdateInterval
+}
+
+// Current returns prices to advertise, in the units of the configured prices.
+func Current() (readPrice, writePrice float64) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !cfg.Enabled || current == nil {
+		conf := config.Get()
+		return conf.ReadPrice, conf.WritePrice
+	}
+	return current.ReadPrice, current.WritePrice
+}
+
+// RecordRead adds bytes sent to clients to the read bandwidth.
+func RecordRead(size int64) {
+	mu.RLock()
+	m := meter
+	mu.RUnlock()
+	m.add(time.Now(), size)
+}
+
+// Refresh recalculates the prices. It returns true if a price has changed
+// enough to be published.
+func Refresh() (bool, error) {
+	return refresh(false)
+}
+
+// Recalculate recalculates the prices from the configured ones once they
+// are reloaded. The prices are replaced even if changed less than the
+// min_change, since they are based on the new configured prices.
+func Recalculate() error {
+	_, err := refresh(true)
+	return err
+}
+
+func refresh(force bool) (bool, error) {
+	used, err := filestore.GetFileStore().GetTotalDiskSizeUsed()
+	if err != nil {
+		return false, err
+	}
+	conf := config.Get()
+	var utilization float64
+	if capacity := conf.Capacity; capacity > 0 {
+		utilization = float64(used) / float64(capacity)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	prices := cfg.Compute(conf.ReadPrice, conf.WritePrice,
+		utilization, meter.bandwidth(time.Now()))
+	if !force && current != nil &&
+		!changed(current.ReadPrice, prices.ReadPrice, cfg.MinChange) &&
+		!changed(current.WritePrice, prices.WritePrice, cfg.MinChange) {
+		return false, nil
+	}
+	current = &prices
+	return true, nil
+}
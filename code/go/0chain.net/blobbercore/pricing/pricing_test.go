@@ -0,0 +1,59 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurve_Multiplier(t *testing.T) {
+	c := Curve{{Load: 0, Multiplier: 0.5}, {Load: 0.5, Multiplier: 1}, {Load: 1, Multiplier: 3}}
+	assert.Equal(t, 0.5, c.Multiplier(-1))
+	assert.Equal(t, 0.75, c.Multiplier(0.25))
+	assert.Equal(t, 1.0, c.Multiplier(0.5))
+	assert.Equal(t, 2.0, c.Multiplier(0.75))
+	assert.Equal(t, 3.0, c.Multiplier(2))
+	assert.Equal(t, 1.0, Curve{}.Multiplier(0.9))
+}
+
+func TestConfig_Compute(t *testing.T) {
+	c := Config{
+		ReadBandwidthTarget: 100,
+		Read: PriceConfig{
+			Curve:   Curve{{Load: 0, Multiplier: 1}, {Load: 1, Multiplier: 2}},
+			Ceiling: 0.015,
+		},
+		Write: PriceConfig{
+			Curve: Curve{{Load: 0, Multiplier: 0.5}, {Load: 1, Multiplier: 2}},
+			Floor: 0.06,
+		},
+	}
+
+	p := c.Compute(0.01, 0.1, 0.2, 50)
+	assert.InDelta(t, 0.015, p.ReadPrice, 1e-9)
+	assert.InDelta(t, 0.08, p.WritePrice, 1e-9)
+
+	p = c.Compute(0.01, 0.1, 0, 500) // capped and floored
+	assert.InDelta(t, 0.015, p.ReadPrice, 1e-9)
+	assert.InDelta(t, 0.06, p.WritePrice, 1e-9)
+}
+
+func TestChanged(t *testing.T) {
+	assert.False(t, changed(1, 1.04, 0.05))
+	assert.True(t, changed(1, 1.06, 0.05))
+	assert.True(t, changed(0, 1, 0.05))
+	assert.False(t, changed(0, 0, 0.05))
+}
+
+func TestReadMeter(t *testing.T) {
+	m := newReadMeter(time.Minute)
+	now := time.Now()
+	m.add(now, 600)
+	m.add(now.Add(30*time.Second), 600)
+	assert.InDelta(t, 20, m.bandwidth(now.Add(30*time.Second)), 1e-9)
+
+	// the first read leaves the window
+	assert.InDelta(t, 10, m.bandwidth(now.Add(70*time.Second)), 1e-9)
+	assert.Equal(t, 0.0, m.bandwidth(now.Add(5*time.Minute)))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
@@ -67,13 +68,13 @@ type ReadMarker struct {
 	ClientID        string           `gorm:"column:client_id;primary_key" json:"client_id"`
 	ClientPublicKey string           `gorm:"column:client_public_key" json:"client_public_key"`
 	BlobberID       string           `gorm:"column:blobber_id" json:"blobber_id"`
-	AllocationID    string           `gorm:"column:allocation_id" json:"allocation_id"`
+	AllocationID    string           `gorm:"column:allocation_id;primary_key" json:"allocation_id"`
 	OwnerID         string           `gorm:"column:owner_id" json:"owner_id"`
 	Timestamp       common.Timestamp `gorm:"column:timestamp" json:"timestamp"`
 	ReadCounter     int64            `gorm:"column:counter" json:"counter"`
 	Signature       string           `gorm:"column:signature" json:"signature"`
 	Suspend         int64            `gorm:"column:suspend" json:"suspend"`
-	PayerID         string           `gorm:"column:payer_id" json:"payer_id"`
+	PayerID         string           `gorm:"column:payer_id;primary_key" json:"payer_id"`
 	AuthTicket      datatypes.JSON   `gorm:"column:auth_ticket" json:"auth_ticket"`
 }
 
@@ -97,10 +98,21 @@ func (ReadMarkerEntity) TableName() string {
 	return "read_markers"
 }
 
-func GetLatestReadMarkerEntity(ctx context.Context, clientID string) (*ReadMarkerEntity, error) {
+// key of the read marker, the read markers are kept per client, allocation
+// and payer
+func (rm *ReadMarker) key() string {
+	return rm.ClientID + ":" + rm.AllocationID + ":" + rm.PayerID
+}
+
+// GetLatestReadMarkerEntity returns the latest read marker of the client for
+// the allocation paid by the payer.
+func GetLatestReadMarkerEntity(ctx context.Context, clientID, allocationID,
+	payerID string) (*ReadMarkerEntity, error) {
+
 	db := datastore.GetStore().GetTransaction(ctx)
 	rm := &ReadMarkerEntity{}
-	err := db.First(rm, "client_id = ?", clientID).Error
+	err := db.First(rm, "client_id = ? AND allocation_id = ? AND payer_id = ?",
+		clientID, allocationID, payerID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -139,18 +151,15 @@ func (rm *ReadMarkerEntity) Sync(ctx context.Context) (err error) {
 	}
 	rmUpdates["latest_redeemed_rm"] = latestRMBytes
 
-	// update local read pools cache from sharders
-	var rps []*allocation.ReadPool
-	rps, err = allocation.RequestReadPools(rm.LatestRM.ClientID,
-		rm.LatestRM.AllocationID)
+	// the read marker is the row of (client, allocation, payer)
+	err = db.Model(rm).Updates(rmUpdates).Error
 	if err != nil {
-		return common.NewErrorf("rme_sync",
-			"can't get read pools from sharders: %v", err)
+		return common.NewErrorf("rme_sync", "saving synced RM: %v", err)
 	}
 
-	// save the fresh read pools information
-	err = allocation.SetReadPools(db, rm.LatestRM.ClientID,
-		rm.LatestRM.AllocationID, rm.LatestRM.BlobberID, rps)
+	// update local read pools cache from sharders
+	_, err = allocation.RefreshReadPools(db, rm.LatestRM.ClientID,
+		rm.LatestRM.AllocationID, rm.LatestRM.BlobberID)
 	if err != nil {
 		return common.NewErrorf("rme_sync",
 			"can't update read pools from sharders: %v", err)
@@ -160,9 +169,11 @@ func (rm *ReadMarkerEntity) Sync(ctx context.Context) (err error) {
 }
 
 // UpdateStatus updates read marker status and all related on successful
-// redeeming.
+// redeeming. The submission time of the redeem transaction is used to
+// reconcile the read pools cache.
 func (rm *ReadMarkerEntity) UpdateStatus(ctx context.Context,
-	rps []*allocation.ReadPool, txOutput, redeemTxn string) (err error) {
+	rps []*allocation.ReadPool, txOutput, redeemTxn string,
+	submittedAt time.Time) (err error) {
 
 	var redeems []allocation.ReadPoolRedeem
 	if err = json.Unmarshal([]byte(txOutput), &redeems); err != nil {
@@ -187,17 +198,29 @@ func (rm *ReadMarkerEntity) UpdateStatus(ctx context.Context,
 	rmUpdates["latest_redeemed_rm"] = latestRMBytes
 
 	// the saving looses the numBlocks information
-	err = db.Model(rm).
+	var result = db.Model(rm).
 		Where("counter = ?", rm.LatestRM.ReadCounter).
-		Updates(rmUpdates).Error
-	if err != nil {
-		return common.NewError("rme_update_status", err.Error())
+		Updates(rmUpdates)
+	if result.Error != nil {
+		return common.NewError("rme_update_status", result.Error.Error())
+	}
+
+	if result.RowsAffected == 0 {
+		// the client has read more since the redeeming has been submitted,
+		// keep the rest pending
+		delete(rmUpdates, "redeem_required")
+		err = db.Model(rm).
+			Where("counter > ?", rm.LatestRM.ReadCounter).
+			Updates(rmUpdates).Error
+		if err != nil {
+			return common.NewError("rme_update_status", err.Error())
+		}
 	}
 
 	// update cache using the transaction output
-	allocation.SubReadRedeemed(rps, redeems)
-	err = allocation.SetReadPools(db, rm.LatestRM.ClientID,
-		rm.LatestRM.AllocationID, rm.LatestRM.BlobberID, rps)
+	err = allocation.ReconcileReadRedeemed(db, rm.LatestRM.ClientID,
+		rm.LatestRM.AllocationID, rm.LatestRM.BlobberID, rps, redeems,
+		submittedAt)
 	if err != nil {
 		return common.NewErrorf("rme_update_status",
 			"can't update local read pools cache: %v", err)
@@ -3,13 +3,12 @@ package readmarker
 import (
 	"context"
 	"encoding/json"
-	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/constants"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
-	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/encryption"
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
@@ -158,18 +157,12 @@ func (rme *ReadMarkerEntity) preRedeem(ctx context.Context,
 	}
 
 	if have < want {
-		rps, err = allocation.RequestReadPools(clientID,
-			alloc.ID)
+		// request and cache in DB for next requests
+		rps, err = allocation.RefreshReadPools(db, clientID,
+			alloc.ID, blobberID)
 		if err != nil {
 			return nil, common.NewErrorf("rme_pre_redeem",
-				"can't request read pools from sharders: %v", err)
-		}
-		// cache in DB for next requests
-		err = allocation.SetReadPools(db, clientID,
-			alloc.ID, blobberID, rps)
-		if err != nil {
-			return nil, common.NewErrorf("rme_pre_redeem",
-				"can't save the requested read pools: %v", err)
+				"can't refresh read pools: %v", err)
 		}
 		// update the 'have' given from sharders
 		for _, rp := range rps {
@@ -197,9 +190,67 @@ func (rme *ReadMarkerEntity) preRedeem(ctx context.Context,
 	return
 }
 
-// RedeemReadMarker redeems the read marker.
-func (rme *ReadMarkerEntity) RedeemReadMarker(ctx context.Context) (
-	err error) {
+// lastRedeemedAt returns the time of the latest redeemed read marker, or the
+// time of the first read if none is redeemed yet.
+func (rme *ReadMarkerEntity) lastRedeemedAt() (common.Timestamp, error) {
+	if len(rme.LatestRedeemedRMBlob) == 0 {
+		return common.Timestamp(rme.CreatedAt.Unix()), nil
+	}
+
+	var prev = new(ReadMarker)
+	if err := json.Unmarshal(rme.LatestRedeemedRMBlob, prev); err != nil {
+		return 0, common.NewErrorf("rme_last_redeemed",
+			"decoding previous read marker: %v", err)
+	}
+	return prev.Timestamp, nil
+}
+
+// ShouldRedeem returns true if the pending value of the read marker is worth
+// redeeming by the policy. The value is checked against the cached read
+// pools, they are refreshed by the pre-redeeming if the marker is going to be
+// redeemed.
+func (rme *ReadMarkerEntity) ShouldRedeem(ctx context.Context,
+	policy *RedeemPolicy) (bool, error) {
+
+	alloc, err := allocation.GetAllocationByID(ctx, rme.LatestRM.AllocationID)
+	if err != nil {
+		return false, common.NewErrorf("redeem_read_marker",
+			"can't get allocation from DB: %v", err)
+	}
+	if err = alloc.LoadTerms(ctx); err != nil {
+		return false, common.NewErrorf("redeem_read_marker",
+			"can't load allocation terms from DB: %v", err)
+	}
+
+	numBlocks, err := rme.getNumBlocks()
+	if err != nil {
+		return false, common.NewErrorf("redeem_read_marker",
+			"can't get number of blocks read to redeem: %v", err)
+	}
+	lastRedeemed, err := rme.lastRedeemedAt()
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		db  = datastore.GetStore().GetTransaction(ctx)
+		now = common.Now()
+	)
+	cached, err := allocation.ReadPools(db, rme.LatestRM.ClientID, alloc.ID,
+		rme.LatestRM.BlobberID, now)
+	if err != nil {
+		return false, common.NewErrorf("redeem_read_marker",
+			"can't get read pools from DB: %v", err)
+	}
+
+	value := alloc.WantRead(rme.LatestRM.BlobberID, numBlocks)
+	return policy.ShouldRedeem(value, cached, lastRedeemed, now), nil
+}
+
+// RedeemReadMarker queues the transaction redeeming the read marker, see
+// ShouldRedeem for whether it's worth it. The transaction is submitted and
+// confirmed by the transaction manager, see onReadRedeemed.
+func (rme *ReadMarkerEntity) RedeemReadMarker(ctx context.Context) (err error) {
 
 	if rme.LatestRM.Suspend == rme.LatestRM.ReadCounter {
 		// suspended read marker, no tokens in related read pools
@@ -230,58 +281,24 @@ func (rme *ReadMarkerEntity) RedeemReadMarker(ctx context.Context) (
 			"can't get number of blocks read to redeem: %v", err)
 	}
 
-	var rps []*allocation.ReadPool
-	if rps, err = rme.preRedeem(ctx, alloc, numBlocks); err != nil {
+	if _, err = rme.preRedeem(ctx, alloc, numBlocks); err != nil {
 		return common.NewErrorf("redeem_read_marker",
 			"pre-redeeming error: %v", err)
 	}
 
-	// ok, now we can redeem the marker and then update pools in cache
-
-	var tx *transaction.Transaction
-	if tx, err = transaction.NewTransactionEntity(); err != nil {
-		return common.NewErrorf("redeem_read_marker",
-			"creating transaction: %v", err)
-	}
-
-	var (
-		rm = rme.LatestRM
-		sn = &ReadRedeem{}
-	)
-	sn.ReadMarker = rm
-
-	var snBytes []byte
-	if snBytes, err = json.Marshal(sn); err != nil {
-		Logger.Error("Error encoding SC input", zap.Error(err),
-			zap.Any("scdata", sn))
-		return common.NewErrorf("redeem_read_marker",
-			"encoding SC data: %v", err)
-	}
-
-	err = tx.ExecuteSmartContract(transaction.STORAGE_CONTRACT_ADDRESS,
-		transaction.READ_REDEEM, string(snBytes), 0)
-	if err != nil {
-		Logger.Info("Failed submitting read redeem", zap.Error(err))
-		return common.NewErrorf("redeem_read_marker",
-			"sending transaction: %v", err)
-	}
+	// ok, now we can redeem the marker, the pools in cache are updated on
+	// confirmation
 
-	time.Sleep(transaction.SLEEP_FOR_TXN_CONFIRMATION * time.Second)
-
-	var logHash = tx.Hash // keep transaction hash for error logs
-	tx, err = transaction.VerifyTransaction(tx.Hash, chain.GetServerChain())
-	if err != nil {
-		Logger.Error("Error verifying the read redeem transaction",
-			zap.Error(err), zap.String("txn", logHash))
-		return common.NewErrorf("redeem_read_marker",
-			"verifying transaction: %v", err)
-	}
-
-	err = rme.UpdateStatus(ctx, rps, tx.TransactionOutput, tx.Hash)
+	_, err = txnmanager.Enqueue(ctx, &txnmanager.Request{
+		Kind:  transaction.READ_REDEEM,
+		RefID: rme.LatestRM.key(),
+		Name:  transaction.READ_REDEEM,
+		Input: &ReadRedeem{ReadMarker: rme.LatestRM},
+	})
 	if err != nil {
 		return common.NewErrorf("redeem_read_marker",
-			"updating read marker status: %v", err)
+			"queueing transaction: %v", err)
 	}
 
-	return // nil, ok
+	return nil
 }
@@ -0,0 +1,147 @@
+package readmarker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/ledger"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
+	"gorm.io/gorm"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// RedeemPolicy decides whether a read marker is worth redeeming now. Every
+// redeem costs a transaction, so small values are accumulated until they
+// pass the threshold, unless a read pool is going to expire soon or the
+// marker is not redeemed for too long.
+type RedeemPolicy struct {
+	// Threshold is the minimal value of pending reads to redeem.
+	Threshold int64
+	// ExpiryMargin is the time before a read pool expiration when the
+	// marker is redeemed regardless of its value.
+	ExpiryMargin common.Timestamp
+	// MaxAge is the time since the last redeem when the marker is redeemed
+	// regardless of its value, even a zero one of a free read; 0 for none.
+	MaxAge common.Timestamp
+}
+
+// GetRedeemPolicy returns the policy from the configuration.
+func GetRedeemPolicy() *RedeemPolicy {
+	return &RedeemPolicy{
+		Threshold:    config.Get().RMRedeemThreshold,
+		ExpiryMargin: common.Timestamp(config.Get().RMRedeemExpiryMargin),
+		MaxAge:       common.Timestamp(config.Get().RMRedeemMaxAge),
+	}
+}
+
+// ShouldRedeem returns true if the value of pending reads passes the
+// threshold, one of the read pools expires within the margin or the last
+// redeem is older than the max age.
+func (p *RedeemPolicy) ShouldRedeem(value int64, rps []*allocation.ReadPool,
+	lastRedeemed, now common.Timestamp) bool {
+
+	if value >= p.Threshold {
+		return true
+	}
+	if p.MaxAge > 0 && now-lastRedeemed >= p.MaxAge {
+		return true
+	}
+	for _, rp := range rps {
+		if rp.Balance > 0 && rp.ExpireAt-now <= p.ExpiryMargin {
+			return true
+		}
+	}
+	return false
+}
+
+// onReadRedeemed updates the read marker and the read pools cache when the
+// redeem transaction is confirmed.
+func onReadRedeemed(ctx context.Context, txn *txnmanager.Txn,
+	t *transaction.Transaction, txnErr error) (err error) {
+
+	var sn ReadRedeem
+	if err = json.Unmarshal([]byte(txn.SCInput), &sn); err != nil || sn.ReadMarker == nil {
+		Logger.Error("invalid read redeem transaction input",
+			zap.Int64("seq", txn.Seq), zap.Error(err))
+		return nil // nothing to update
+	}
+	var rm = sn.ReadMarker
+
+	rme, err := GetLatestReadMarkerEntity(ctx, rm.ClientID, rm.AllocationID, rm.PayerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var db = datastore.GetStore().GetTransaction(ctx)
+	if txnErr != nil {
+		return db.Model(rme).Update("status_message", txnErr.Error()).Error
+	}
+
+	// the redeemed marker, the entity can have a newer one already
+	rme.LatestRM = rm
+
+	var numBlocks int64
+	if numBlocks, err = rme.getNumBlocks(); err != nil {
+		return common.NewErrorf("rme_redeemed",
+			"can't get number of blocks redeemed: %v", err)
+	}
+
+	var rps []*allocation.ReadPool
+	rps, err = allocation.ReadPools(db, rm.ClientID, rm.AllocationID,
+		rm.BlobberID, common.Now())
+	if err != nil {
+		return common.NewErrorf("rme_redeemed",
+			"can't get read pools from DB: %v", err)
+	}
+
+	Logger.Info("successfully redeemed read marker", zap.Any("rm", rm),
+		zap.String("txn", t.Hash))
+	var submittedAt time.Time
+	if txn.SubmittedAt != nil {
+		submittedAt = *txn.SubmittedAt
+	}
+	if err = rme.UpdateStatus(ctx, rps, t.TransactionOutput, t.Hash, submittedAt); err != nil {
+		return err
+	}
+	return addReadRedeemEntry(ctx, rm, numBlocks, t)
+}
+
+// addReadRedeemEntry adds the tokens moved from the read pools to the
+// earnings ledger.
+func addReadRedeemEntry(ctx context.Context, rm *ReadMarker, numBlocks int64,
+	t *transaction.Transaction) error {
+
+	var redeems []allocation.ReadPoolRedeem
+	if err := json.Unmarshal([]byte(t.TransactionOutput), &redeems); err != nil {
+		return common.NewErrorf("rme_redeemed",
+			"can't decode transaction output: %v", err)
+	}
+	var tokens int64
+	for _, rd := range redeems {
+		tokens += rd.Balance
+	}
+
+	return ledger.Add(ctx, &ledger.Entry{
+		Kind:         ledger.ReadRedeem,
+		AllocationID: rm.AllocationID,
+		ClientID:     rm.ClientID,
+		PayerID:      rm.PayerID,
+		RefID:        rm.key(),
+		Tokens:       tokens,
+		NumBlocks:    numBlocks,
+		Size:         numBlocks * allocation.CHUNK_SIZE,
+		TxnHash:      t.Hash,
+	})
+}
@@ -0,0 +1,46 @@
+package readmarker
+
+import (
+	"testing"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedeemPolicy_ShouldRedeem(t *testing.T) {
+	var (
+		now    = common.Timestamp(1000)
+		policy = &RedeemPolicy{Threshold: 100, ExpiryMargin: 60, MaxAge: 3600}
+	)
+
+	tests := []struct {
+		name         string
+		value        int64
+		rps          []*allocation.ReadPool
+		lastRedeemed common.Timestamp
+		want         bool
+	}{
+		{name: "above_threshold", value: 100, want: true},
+		{name: "below_threshold", value: 99,
+			rps: []*allocation.ReadPool{{Balance: 10, ExpireAt: now + 61}}},
+		{name: "pool_expires_soon", value: 1, want: true,
+			rps: []*allocation.ReadPool{{Balance: 10, ExpireAt: now + 3600}, {Balance: 10, ExpireAt: now + 60}}},
+		{name: "empty_pool_expires_soon", value: 1,
+			rps: []*allocation.ReadPool{{Balance: 0, ExpireAt: now + 10}}},
+		{name: "free_read_not_redeemed_for_long", value: 0, lastRedeemed: now - 3600, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastRedeemed := tt.lastRedeemed
+			if lastRedeemed == 0 {
+				lastRedeemed = now
+			}
+			assert.Equal(t, tt.want, policy.ShouldRedeem(tt.value, tt.rps, lastRedeemed, now))
+		})
+	}
+
+	// zero threshold redeems everything, as before
+	assert.True(t, (&RedeemPolicy{}).ShouldRedeem(0, nil, now, now))
+}
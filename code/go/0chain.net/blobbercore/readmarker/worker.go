@@ -7,7 +7,9 @@ import (
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 
@@ -16,20 +18,35 @@ import (
 )
 
 func SetupWorkers(ctx context.Context) {
+	txnmanager.RegisterCallback(transaction.READ_REDEEM, onReadRedeemed)
 	go RedeemMarkers(ctx)
 }
 
-func RedeemReadMarker(ctx context.Context, rmEntity *ReadMarkerEntity) (
-	err error) {
+// RedeemReadMarker syncs the read marker with 0chain and queues its
+// redeeming, if the pending value is worth it. The value is checked first,
+// so the markers not worth it yet aren't requested from 0chain.
+func RedeemReadMarker(ctx context.Context, rmEntity *ReadMarkerEntity,
+	policy *RedeemPolicy) (err error) {
+
+	var worth bool
+	if worth, err = rmEntity.ShouldRedeem(ctx, policy); err != nil || !worth {
+		return // not worth it yet
+	}
 
 	Logger.Info("Redeeming the read marker", zap.Any("rm", rmEntity.LatestRM))
 
 	var params = make(map[string]string)
 	params["blobber"] = rmEntity.LatestRM.BlobberID
 	params["client"] = rmEntity.LatestRM.ClientID
+	params["allocation"] = rmEntity.LatestRM.AllocationID
 
 	var (
-		latestRM      = ReadMarker{BlobberID: rmEntity.LatestRM.BlobberID, ClientID: rmEntity.LatestRM.ClientID}
+		latestRM = ReadMarker{
+			BlobberID:    rmEntity.LatestRM.BlobberID,
+			ClientID:     rmEntity.LatestRM.ClientID,
+			AllocationID: rmEntity.LatestRM.AllocationID,
+			PayerID:      rmEntity.LatestRM.PayerID,
+		}
 		latestRMBytes []byte
 	)
 
@@ -45,7 +62,15 @@ func RedeemReadMarker(ctx context.Context, rmEntity *ReadMarkerEntity) (
 		Logger.Error("Error from unmarshal of rm bytes", zap.Error(err))
 		return // error
 
-	} else if latestRM.ReadCounter > 0 && latestRM.ReadCounter >= rmEntity.LatestRM.ReadCounter {
+	} else if latestRM.AllocationID != rmEntity.LatestRM.AllocationID {
+		// the marker of another allocation of the client, nothing to sync
+		latestRM.ReadCounter = 0
+	}
+
+	if latestRM.ReadCounter > 0 && latestRM.ReadCounter >= rmEntity.LatestRM.ReadCounter {
+
+		// the payer is not a part of the signed marker, keep the local one
+		latestRM.PayerID = rmEntity.LatestRM.PayerID
 
 		Logger.Info("updating the local state to match the block chain")
 		if err = SaveLatestReadMarker(ctx, &latestRM, false); err != nil {
@@ -72,21 +97,23 @@ func RedeemReadMarker(ctx context.Context, rmEntity *ReadMarkerEntity) (
 		return
 	}
 
-	Logger.Info("successfully redeemed read marker",
-		zap.Any("rm", rmEntity.LatestRM))
+	Logger.Info("queued read marker redeem", zap.Any("rm", rmEntity.LatestRM))
 	return
 }
 
 var iterInprogress = false
 
 func RedeemMarkers(ctx context.Context) {
-	ticker := time.NewTicker(time.Duration(config.Configuration.RMRedeemFreq) * time.Second)
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-time.After(time.Duration(config.Get().RMRedeemFreq) * time.Second):
 			if !iterInprogress {
+				end, err := common.StartOperation("worker", "redeem_read_markers")
+				if err != nil {
+					return
+				}
 				iterInprogress = true
 				rctx := datastore.GetStore().CreateTransaction(ctx)
 				db := datastore.GetStore().GetTransaction(rctx)
@@ -95,14 +122,32 @@ func RedeemMarkers(ctx context.Context) {
 				db.Where(rm). // redeem_required = true
 						Where("counter <> suspend"). // and not suspended
 						Order("created_at ASC").Find(&readMarkers)
-				if len(readMarkers) > 0 {
-					swg := sizedwaitgroup.New(config.Configuration.RMRedeemNumWorkers)
-					for _, rmEntity := range readMarkers {
+
+				// skip markers with redeems waiting for confirmation
+				pending, err := txnmanager.GetPendingRefIDs(rctx, transaction.READ_REDEEM)
+				if err != nil {
+					Logger.Error("Error getting pending read redeems", zap.Error(err))
+					readMarkers = nil
+				}
+				batch := make([]*ReadMarkerEntity, 0, len(readMarkers))
+				for _, rmEntity := range readMarkers {
+					if size := config.Get().RMRedeemBatchSize; size > 0 && len(batch) == size {
+						break
+					}
+					if _, ok := pending[rmEntity.LatestRM.key()]; !ok {
+						batch = append(batch, rmEntity)
+					}
+				}
+
+				if len(batch) > 0 {
+					policy := GetRedeemPolicy()
+					swg := sizedwaitgroup.New(config.Get().RMRedeemNumWorkers)
+					for _, rmEntity := range batch {
 						swg.Add()
 						go func(redeemCtx context.Context, rmEntity *ReadMarkerEntity) {
 							redeemCtx = datastore.GetStore().CreateTransaction(redeemCtx)
 							defer redeemCtx.Done()
-							err := RedeemReadMarker(redeemCtx, rmEntity)
+							err := RedeemReadMarker(redeemCtx, rmEntity, policy)
 							if err != nil {
 								Logger.Error("Error redeeming the read marker.", zap.Error(err))
 							}
@@ -119,6 +164,7 @@ func RedeemMarkers(ctx context.Context) {
 				db.Rollback()
 				rctx.Done()
 				iterInprogress = false
+				end()
 			}
 		}
 	}
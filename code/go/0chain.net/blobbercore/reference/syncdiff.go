@@ -0,0 +1,102 @@
+package reference
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+)
+
+// SyncDiff is the difference between the client's manifest and the blobber's
+// object tree.
+type SyncDiff struct {
+	// Changed are refs which are new or have another hash than in manifest.
+	// Directories are included, so client can update their hashes as well.
+	Changed []*Ref
+	// Deleted are paths from manifest which don't exist on the blobber.
+	// Descendants of a deleted directory are not listed.
+	Deleted []string
+}
+
+type refWithChildrenLoader func(path string) (*Ref, error)
+
+// GetSyncDiff compares the manifest (path -> hash) of the client with the
+// object tree under the path. Directory hashes are kept up to date on every
+// commit, so a directory which hash matches the manifest is not descended
+// into, and the number of queries depends on the number of changes only.
+func GetSyncDiff(ctx context.Context, allocationID, path string,
+	manifest map[string]string) (*SyncDiff, error) {
+
+	return getSyncDiff(filepath.Clean(path), manifest, func(path string) (*Ref, error) {
+		return GetRefWithSortedChildren(ctx, allocationID, path)
+	})
+}
+
+func getSyncDiff(path string, manifest map[string]string, load refWithChildrenLoader) (*SyncDiff, error) {
+	// paths of manifest by parent directory to find deleted refs
+	byParent := make(map[string][]string)
+	for p := range manifest {
+		p = filepath.Clean(p)
+		if p == "/" {
+			continue
+		}
+		parent := filepath.Dir(p)
+		byParent[parent] = append(byParent[parent], p)
+	}
+
+	diff := &SyncDiff{Changed: make([]*Ref, 0), Deleted: make([]string, 0)}
+
+	ref, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ref.Hash) == 0 && path != "/" {
+		// the directory doesn't exist (anymore)
+		if _, ok := manifest[path]; ok {
+			diff.Deleted = append(diff.Deleted, path)
+		}
+		return diff, nil
+	}
+
+	if hash, ok := manifest[path]; ok && hash == ref.Hash {
+		return diff, nil
+	}
+	diff.Changed = append(diff.Changed, ref)
+
+	dirs := []*Ref{ref}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+
+		present := make(map[string]struct{}, len(dir.Children))
+		for _, child := range dir.Children {
+			present[child.Path] = struct{}{}
+
+			hash, known := manifest[child.Path]
+			if known && hash == child.Hash {
+				continue
+			}
+
+			diff.Changed = append(diff.Changed, child)
+			if child.Type != DIRECTORY {
+				continue
+			}
+
+			loaded, err := load(child.Path)
+			if err != nil {
+				return nil, err
+			}
+			child.Children = loaded.Children
+			dirs = append(dirs, child)
+		}
+
+		for _, p := range byParent[dir.Path] {
+			if _, ok := present[p]; !ok {
+				diff.Deleted = append(diff.Deleted, p)
+			}
+		}
+	}
+
+	sort.Strings(diff.Deleted)
+	return diff, nil
+}
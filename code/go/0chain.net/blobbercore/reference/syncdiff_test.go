@@ -0,0 +1,92 @@
+package reference
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSyncDiff(t *testing.T) {
+	// /
+	// ├── a.txt
+	// ├── docs
+	// │   ├── b.txt
+	// │   └── c.txt
+	// └── photos
+	//     └── d.jpg
+	tree := map[string]*Ref{
+		"/": {Type: DIRECTORY, Path: "/", Hash: "root_v2", Children: []*Ref{
+			{Type: FILE, Path: "/a.txt", Hash: "a_v1"},
+			{Type: DIRECTORY, Path: "/docs", Hash: "docs_v2"},
+			{Type: DIRECTORY, Path: "/photos", Hash: "photos_v1"},
+		}},
+		"/docs": {Type: DIRECTORY, Path: "/docs", Hash: "docs_v2", Children: []*Ref{
+			{Type: FILE, Path: "/docs/b.txt", Hash: "b_v2"},
+			{Type: FILE, Path: "/docs/c.txt", Hash: "c_v1"},
+		}},
+		"/photos": {Type: DIRECTORY, Path: "/photos", Hash: "photos_v1", Children: []*Ref{
+			{Type: FILE, Path: "/photos/d.jpg", Hash: "d_v1"},
+		}},
+	}
+
+	var loaded []string
+	load := func(path string) (*Ref, error) {
+		loaded = append(loaded, path)
+		if ref, ok := tree[path]; ok {
+			return ref, nil
+		}
+		return &Ref{Type: DIRECTORY, Path: path}, nil
+	}
+
+	changedPaths := func(diff *SyncDiff) []string {
+		paths := make([]string, 0, len(diff.Changed))
+		for _, ref := range diff.Changed {
+			paths = append(paths, ref.Path)
+		}
+		return paths
+	}
+
+	t.Run("in_sync", func(t *testing.T) {
+		loaded = nil
+		diff, err := getSyncDiff("/", map[string]string{"/": "root_v2"}, load)
+		require.NoError(t, err)
+		assert.Empty(t, diff.Changed)
+		assert.Empty(t, diff.Deleted)
+		assert.Equal(t, []string{"/"}, loaded)
+	})
+
+	t.Run("changed_subtree_only", func(t *testing.T) {
+		loaded = nil
+		manifest := map[string]string{
+			"/":             "root_v1",
+			"/a.txt":        "a_v1",
+			"/docs":         "docs_v1",
+			"/docs/b.txt":   "b_v1",
+			"/docs/c.txt":   "c_v1",
+			"/docs/old.txt": "old_v1",
+			"/photos":       "photos_v1",
+			"/photos/d.jpg": "d_v1",
+			"/removed":      "removed_v1",
+		}
+		diff, err := getSyncDiff("/", manifest, load)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/", "/docs", "/docs/b.txt"}, changedPaths(diff))
+		assert.Equal(t, []string{"/docs/old.txt", "/removed"}, diff.Deleted)
+		// unchanged /photos is not loaded
+		assert.Equal(t, []string{"/", "/docs"}, loaded)
+	})
+
+	t.Run("unknown_directory", func(t *testing.T) {
+		diff, err := getSyncDiff("/photos", map[string]string{}, load)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/photos", "/photos/d.jpg"}, changedPaths(diff))
+	})
+
+	t.Run("deleted_directory", func(t *testing.T) {
+		diff, err := getSyncDiff("/removed", map[string]string{"/removed": "removed_v1"}, load)
+		require.NoError(t, err)
+		assert.Empty(t, diff.Changed)
+		assert.Equal(t, []string{"/removed"}, diff.Deleted)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/filestore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/pricing"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
@@ -90,6 +91,9 @@ type BlobberStats struct {
 
 	AllocationStats []*AllocationStats `json:"-"`
 
+	// not committed challenges, the earliest deadline first
+	ChallengeDeadlines []*ChallengeDeadline `json:"challenge_deadlines"`
+
 	// total for all allocations
 	ReadMarkers  ReadMarkersStat  `json:"read_markers"`
 	WriteMarkers WriteMarkersStat `json:"write_markers"`
@@ -111,14 +115,14 @@ func (bs *BlobberStats) loadBasicStats(ctx context.Context) {
 	bs.ClientID = node.Self.ID
 	bs.PublicKey = node.Self.PublicKey
 	// configurations
-	bs.Capacity = config.Configuration.Capacity
-	bs.ReadPrice = config.Configuration.ReadPrice
-	bs.WritePrice = config.Configuration.WritePrice
-	bs.MinLockDemand = config.Configuration.MinLockDemand
-	bs.MaxOfferDuration = config.Configuration.MaxOfferDuration
-	bs.ChallengeCompletionTime = config.Configuration.ChallengeCompletionTime
-	bs.ReadLockTimeout = Duration(config.Configuration.ReadLockTimeout)
-	bs.WriteLockTimeout = Duration(config.Configuration.WriteLockTimeout)
+	conf := config.Get()
+	bs.Capacity = conf.Capacity
+	bs.ReadPrice, bs.WritePrice = pricing.Current()
+	bs.MinLockDemand = conf.MinLockDemand
+	bs.MaxOfferDuration = conf.MaxOfferDuration
+	bs.ChallengeCompletionTime = conf.ChallengeCompletionTime
+	bs.ReadLockTimeout = Duration(conf.ReadLockTimeout)
+	bs.WriteLockTimeout = Duration(conf.WriteLockTimeout)
 	//
 	du, err := filestore.GetFileStore().GetTotalDiskSizeUsed()
 	if err != nil {
@@ -133,6 +137,7 @@ func (bs *BlobberStats) loadDetailedStats(ctx context.Context) {
 	bs.loadAllocationStats(ctx)
 	bs.loadChallengeStats(ctx)
 	bs.loadAllocationChallengeStats(ctx)
+	bs.loadChallengeDeadlines(ctx)
 
 	// load read/write markers stat
 	var (
@@ -351,6 +356,43 @@ func (bs *BlobberStats) loadChallengeStats(ctx context.Context) {
 
 }
 
+// ChallengeDeadline is the time left to commit a challenge response,
+// negative if the deadline has passed.
+type ChallengeDeadline struct {
+	ChallengeID    string           `gorm:"column:challenge_id" json:"challenge_id"`
+	AllocationID   string           `gorm:"column:allocation_id" json:"allocation_id"`
+	Status         int              `gorm:"column:status" json:"status"`
+	Attempts       int              `gorm:"column:attempts" json:"attempts"`
+	Created        common.Timestamp `gorm:"column:created" json:"created"`
+	Deadline       common.Timestamp `gorm:"-" json:"deadline"`
+	TimeToDeadline Duration         `gorm:"-" json:"time_to_deadline"`
+}
+
+// ChallengeDeadlinesLoader loads the deadlines of the challenges not
+// committed yet, it's set by the challenge package.
+type ChallengeDeadlinesLoader func(ctx context.Context) ([]*ChallengeDeadline, error)
+
+var challengeDeadlines ChallengeDeadlinesLoader
+
+// SetChallengeDeadlinesLoader sets the loader of the challenge deadlines.
+func SetChallengeDeadlinesLoader(loader ChallengeDeadlinesLoader) {
+	challengeDeadlines = loader
+}
+
+func (bs *BlobberStats) loadChallengeDeadlines(ctx context.Context) {
+	bs.ChallengeDeadlines = make([]*ChallengeDeadline, 0)
+	if challengeDeadlines == nil {
+		return
+	}
+	cds, err := challengeDeadlines(ctx)
+	if err != nil {
+		Logger.Error("Error in getting the challenge deadlines",
+			zap.Error(err))
+		return
+	}
+	bs.ChallengeDeadlines = cds
+}
+
 func (bs *BlobberStats) loadAllocationChallengeStats(ctx context.Context) {
 	var (
 		db   = datastore.GetStore().GetTransaction(ctx)
@@ -469,43 +511,52 @@ type ReadMarkerEntity struct {
 	RedeemRequired       bool           `gorm:"column:redeem_required"`
 }
 
+// loadAllocReadMarkersStat sums the read markers of all clients and payers
+// of the allocation.
 func loadAllocReadMarkersStat(ctx context.Context, allocationID string) (
 	rms *ReadMarkersStat, err error) {
 
 	var (
-		db  = datastore.GetStore().GetTransaction(ctx)
-		rme ReadMarkerEntity
+		db   = datastore.GetStore().GetTransaction(ctx)
+		rows *sql.Rows
 	)
 
-	err = db.Table("read_markers").
+	rows, err = db.Table("read_markers").
 		Select("counter, latest_redeemed_rm, redeem_required").
 		Where("allocation_id = ?", allocationID).
-		Limit(1).
-		Row().
-		Scan(&rme.ReadCounter, &rme.LatestRedeemedRMBlob, &rme.RedeemRequired)
-
-	if err != nil && err != sql.ErrNoRows {
+		Rows()
+	if err != nil {
 		return
 	}
+	defer rows.Close()
 
-	if err == sql.ErrNoRows {
-		return &ReadMarkersStat{}, nil // empty
-	}
-
-	var prev, current = new(ReadMarkerEntity), &rme
-	if len(rme.LatestRedeemedRMBlob) > 0 {
-		err = json.Unmarshal([]byte(rme.LatestRedeemedRMBlob), prev)
+	rms = new(ReadMarkersStat)
+	for rows.Next() {
+		var rme ReadMarkerEntity
+		err = rows.Scan(&rme.ReadCounter, &rme.LatestRedeemedRMBlob,
+			&rme.RedeemRequired)
 		if err != nil {
-			return
+			return nil, err
+		}
+
+		var prev, current = new(ReadMarkerEntity), &rme
+		if len(rme.LatestRedeemedRMBlob) > 0 {
+			err = json.Unmarshal([]byte(rme.LatestRedeemedRMBlob), prev)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if current.RedeemRequired {
+			rms.Pending += current.ReadCounter - prev.ReadCounter // pending
+			rms.Redeemed += prev.ReadCounter                      // already redeemed
+		} else {
+			rms.Redeemed += current.ReadCounter // already redeemed
 		}
 	}
 
-	rms = new(ReadMarkersStat)
-	if current.RedeemRequired {
-		rms.Pending = current.ReadCounter - prev.ReadCounter // pending
-		rms.Redeemed = prev.ReadCounter                      // already redeemed
-	} else {
-		rms.Redeemed = current.ReadCounter // already redeemed
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return
@@ -173,6 +173,28 @@ const tpl = `<!DOCTYPE html>
       </tr>
     </table>
 
+    <h1>
+      Challenge Deadlines
+    </h1>
+    <table border="1">
+      <tr>
+        <td>ID</td>
+        <td>Allocation</td>
+        <td>Status</td>
+        <td>Attempts</td>
+        <td>Time to deadline</td>
+      </tr>
+      {{range .ChallengeDeadlines}}
+      <tr>
+        <td>{{ .ChallengeID }}</td>
+        <td>{{ .AllocationID }}</td>
+        <td>{{ .Status }}</td>
+        <td>{{ .Attempts }}</td>
+        <td>{{ .TimeToDeadline }}</td>
+      </tr>
+      {{end}}
+    </table>
+
     <h1>
       Allocation Stats
 	</h1>
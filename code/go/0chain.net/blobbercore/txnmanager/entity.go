@@ -0,0 +1,178 @@
+package txnmanager
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
+	"gorm.io/gorm"
+)
+
+type TxnStatus int
+
+const (
+	Queued    TxnStatus = 0 // waiting for submission or resubmission
+	Submitted TxnStatus = 1 // waiting for confirmation
+	Confirmed TxnStatus = 2
+	Failed    TxnStatus = 3 // out of attempts to submit it or to call back
+)
+
+// Txn is a smart contract transaction queued for submission.
+type Txn struct {
+	// Seq orders transactions of a lane, it is assigned by the DB. It's not
+	// the chain nonce, the order is kept by the lanes
+	Seq int64 `gorm:"column:seq;primary_key"`
+	// Lane groups transactions which must be submitted in order, a
+	// transaction is submitted after all previous ones of its lane are
+	// confirmed or failed
+	Lane string `gorm:"column:lane"`
+	// Kind selects the callback of the transaction
+	Kind string `gorm:"column:kind"`
+	// RefID identifies the marker or challenge of the transaction
+	RefID string `gorm:"column:ref_id"`
+
+	SCAddress string `gorm:"column:sc_address"`
+	SCName    string `gorm:"column:sc_name"`
+	SCInput   string `gorm:"column:sc_input"`
+	Value     int64  `gorm:"column:value"`
+
+	Status        TxnStatus  `gorm:"column:status"`
+	Hash          string     `gorm:"column:txn_hash"`
+	PrevHashes    string     `gorm:"column:prev_txn_hashes"`
+	Output        string     `gorm:"column:txn_output"`
+	Attempts      int        `gorm:"column:attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at"`
+	SubmittedAt   *time.Time `gorm:"column:submitted_at"`
+	LastError     string     `gorm:"column:last_error"`
+
+	// CallbackAttempts counts the failed calls of the callback
+	CallbackAttempts int `gorm:"column:callback_attempts"`
+	datastore.ModelWithTS
+}
+
+func (Txn) TableName() string {
+	return "outgoing_transactions"
+}
+
+// hashes of all submissions of the transaction, the latest first; a
+// resubmitted transaction can still be confirmed by an earlier submission
+func (t *Txn) hashes() []string {
+	var hashes []string
+	if t.Hash != "" {
+		hashes = append(hashes, t.Hash)
+	}
+	for _, h := range strings.Split(t.PrevHashes, ",") {
+		if h != "" {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// Request of a storage smart contract transaction.
+type Request struct {
+	Kind  string
+	RefID string
+	// Lane defaults to Kind:RefID, so transactions of the same object are
+	// submitted in order
+	Lane  string
+	Name  string
+	Input interface{}
+	Value int64
+}
+
+// Enqueue saves the transaction within the DB transaction of the context, so
+// it is queued only if the caller's changes are committed.
+func Enqueue(ctx context.Context, req *Request) (*Txn, error) {
+	input, err := json.Marshal(req.Input)
+	if err != nil {
+		return nil, common.NewErrorf("txn_enqueue",
+			"encoding sc input: %v", err)
+	}
+
+	lane := req.Lane
+	if lane == "" {
+		lane = req.Kind + ":" + req.RefID
+	}
+
+	txn := &Txn{
+		Lane:          lane,
+		Kind:          req.Kind,
+		RefID:         req.RefID,
+		SCAddress:     transaction.STORAGE_CONTRACT_ADDRESS,
+		SCName:        req.Name,
+		SCInput:       string(input),
+		Value:         req.Value,
+		Status:        Queued,
+		NextAttemptAt: time.Now(),
+	}
+
+	db := datastore.GetStore().GetTransaction(ctx)
+	if err = db.Create(txn).Error; err != nil {
+		return nil, common.NewErrorf("txn_enqueue",
+			"saving transaction: %v", err)
+	}
+	return txn, nil
+}
+
+// GetPendingRefIDs returns references of transactions of the kind not
+// confirmed or failed yet.
+func GetPendingRefIDs(ctx context.Context, kind string) (
+	map[string]struct{}, error) {
+
+	var refIDs []string
+	db := datastore.GetStore().GetTransaction(ctx)
+	err := db.Model(&Txn{}).
+		Where("kind = ? AND status IN ?", kind, []TxnStatus{Queued, Submitted}).
+		Pluck("ref_id", &refIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[string]struct{}, len(refIDs))
+	for _, refID := range refIDs {
+		pending[refID] = struct{}{}
+	}
+	return pending, nil
+}
+
+// IsPending returns true if a transaction of the object is not confirmed or
+// failed yet.
+func IsPending(ctx context.Context, kind, refID string) (bool, error) {
+	var count int64
+	db := datastore.GetStore().GetTransaction(ctx)
+	err := db.Model(&Txn{}).
+		Where("kind = ? AND ref_id = ? AND status IN ?", kind, refID,
+			[]TxnStatus{Queued, Submitted}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// getDueTxns returns queued transactions ready for submission, at most one
+// per lane and only if no previous transaction of the lane is pending.
+func getDueTxns(db *gorm.DB, now time.Time, limit int) ([]*Txn, error) {
+	var txns []*Txn
+	err := db.Where("status = ? AND next_attempt_at <= ?", Queued, now).
+		Where(`NOT EXISTS (SELECT 1 FROM outgoing_transactions p
+			WHERE p.lane = outgoing_transactions.lane
+			AND p.seq < outgoing_transactions.seq
+			AND p.status IN ?)`, []TxnStatus{Queued, Submitted}).
+		Order("seq").
+		Limit(limit).
+		Find(&txns).Error
+	return txns, err
+}
+
+// getSubmittedTxns returns transactions submitted before the time.
+func getSubmittedTxns(db *gorm.DB, before time.Time, limit int) ([]*Txn, error) {
+	var txns []*Txn
+	err := db.Where("status = ? AND submitted_at <= ?", Submitted, before).
+		Order("seq").
+		Limit(limit).
+		Find(&txns).Error
+	return txns, err
+}
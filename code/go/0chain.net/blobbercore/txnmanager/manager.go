@@ -0,0 +1,345 @@
+package txnmanager
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
+	"github.com/0chain/gosdk/zcncore"
+	"github.com/remeh/sizedwaitgroup"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// Callback is called when the transaction is confirmed (err is nil) or out
+// of attempts. It is called within the DB transaction marking the queued
+// transaction as done, so an error of the callback rolls both back and the
+// callback is called again later, up to the max attempts. The transaction
+// fails then.
+type Callback func(ctx context.Context, txn *Txn, confirmed *transaction.Transaction, err error) error
+
+var (
+	callbacksMu sync.RWMutex
+	callbacks   = make(map[string]Callback)
+)
+
+// RegisterCallback sets callback of transactions of the kind.
+func RegisterCallback(kind string, cb Callback) {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	callbacks[kind] = cb
+}
+
+func getCallback(kind string) Callback {
+	callbacksMu.RLock()
+	defer callbacksMu.RUnlock()
+	return callbacks[kind]
+}
+
+// txnExpiration is the time a transaction can be included in a block for
+// since its creation, as the chain only accepts the recent transactions.
+const txnExpiration = 60 * time.Second
+
+// chainClient submits and verifies transactions
+type chainClient interface {
+	Submit(txn *Txn) (hash string, err error)
+	Verify(hash string) (*transaction.Transaction, error)
+	// LatestFinalized returns the creation time of the latest finalized block
+	LatestFinalized() (time.Time, error)
+}
+
+type zcnClient struct{}
+
+func (zcnClient) Submit(txn *Txn) (string, error) {
+	tx, err := transaction.NewTransactionEntity()
+	if err != nil {
+		return "", err
+	}
+	err = tx.ExecuteSmartContract(txn.SCAddress, txn.SCName, txn.SCInput, txn.Value)
+	return tx.Hash, err
+}
+
+func (zcnClient) Verify(hash string) (*transaction.Transaction, error) {
+	return transaction.VerifyTransaction(hash, chain.GetServerChain())
+}
+
+func (zcnClient) LatestFinalized() (time.Time, error) {
+	b, err := zcncore.GetLatestFinalized(context.Background(), 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(b.CreationDate, 0), nil
+}
+
+// Manager submits queued transactions and tracks their confirmation. The
+// chain has no account nonces, a transaction is kept from being replayed by
+// its creation time instead. So an unconfirmed transaction is resubmitted only
+// once the finalized blocks are past its expiration, when the earlier
+// submissions can't be included anymore.
+type Manager struct {
+	client chainClient
+
+	numWorkers          int
+	batchSize           int
+	maxAttempts         int
+	backoffBase         time.Duration
+	backoffMax          time.Duration
+	confirmationDelay   time.Duration
+	confirmationTimeout time.Duration
+}
+
+// newManager returns the manager of the current configuration.
+func newManager() *Manager {
+	conf := config.Get()
+	return &Manager{
+		client:              zcnClient{},
+		numWorkers:          conf.TxnManagerNumWorkers,
+		batchSize:           conf.TxnManagerBatchSize,
+		maxAttempts:         conf.TxnManagerMaxAttempts,
+		backoffBase:         time.Duration(conf.TxnManagerBackoffBase) * time.Second,
+		backoffMax:          time.Duration(conf.TxnManagerBackoffMax) * time.Second,
+		confirmationDelay:   transaction.SLEEP_FOR_TXN_CONFIRMATION * time.Second,
+		confirmationTimeout: time.Duration(conf.TxnManagerConfirmationTimeout) * time.Second,
+	}
+}
+
+func SetupWorkers(ctx context.Context) {
+	go run(ctx)
+}
+
+// run confirms and submits the transactions, the manager is renewed on
+// every run to apply the reloaded configuration.
+func run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-time.After(time.Duration(config.Get().TxnManagerFreq) * time.Second):
+			end, err := common.StartOperation("worker", "txn_manager")
+			if err != nil {
+				return
+			}
+			m := newManager()
+			m.confirmSubmitted(ctx, now)
+			m.submitDue(ctx, now)
+			end()
+		}
+	}
+}
+
+// backoff returns delay before the next attempt, doubled on every attempt.
+func (m *Manager) backoff(attempts int) time.Duration {
+	delay := m.backoffBase
+	for i := 1; i < attempts && delay < m.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > m.backoffMax {
+		delay = m.backoffMax
+	}
+	return delay
+}
+
+// afterSubmit returns updates of the transaction after its submission.
+func (m *Manager) afterSubmit(txn *Txn, hash string, err error, now time.Time) map[string]interface{} {
+	updates := map[string]interface{}{"attempts": txn.Attempts + 1}
+	if err != nil {
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(m.backoff(txn.Attempts + 1))
+		return updates
+	}
+
+	prev := txn.PrevHashes
+	if txn.Hash != "" {
+		prev = strings.Trim(txn.Hash+","+prev, ",")
+	}
+	updates["status"] = Submitted
+	updates["txn_hash"] = hash
+	updates["prev_txn_hashes"] = prev
+	updates["submitted_at"] = now
+	return updates
+}
+
+// afterUnconfirmed returns updates of the transaction not confirmed within
+// the timeout, nil if there is still time or its submission hasn't expired
+// by the latest finalized block yet.
+func (m *Manager) afterUnconfirmed(txn *Txn, now, finalized time.Time) map[string]interface{} {
+	if txn.SubmittedAt == nil || now.Sub(*txn.SubmittedAt) < m.confirmationTimeout {
+		return nil
+	}
+	if !finalized.After(txn.SubmittedAt.Add(txnExpiration)) {
+		return nil
+	}
+	return map[string]interface{}{
+		"status":          Queued,
+		"last_error":      "transaction not confirmed in time",
+		"next_attempt_at": now.Add(m.backoff(txn.Attempts)),
+	}
+}
+
+func (m *Manager) outOfAttempts(attempts int) bool {
+	return m.maxAttempts > 0 && attempts >= m.maxAttempts
+}
+
+func (m *Manager) submitDue(ctx context.Context, now time.Time) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	txns, err := getDueTxns(db, now, m.batchSize)
+	db.Rollback()
+	if err != nil {
+		Logger.Error("Error getting queued transactions", zap.Error(err))
+		return
+	}
+
+	swg := sizedwaitgroup.New(m.numWorkers)
+	for _, txn := range txns {
+		swg.Add()
+		go func(txn *Txn) {
+			defer swg.Done()
+			hash, err := m.client.Submit(txn)
+			if err != nil {
+				Logger.Error("Error submitting transaction", zap.Int64("seq", txn.Seq),
+					zap.String("kind", txn.Kind), zap.String("ref_id", txn.RefID), zap.Error(err))
+				if m.outOfAttempts(txn.Attempts + 1) {
+					m.complete(ctx, txn, nil, err, map[string]interface{}{"attempts": txn.Attempts + 1})
+					return
+				}
+			}
+			m.update(ctx, txn, m.afterSubmit(txn, hash, err, now))
+		}(txn)
+	}
+	swg.Wait()
+}
+
+func (m *Manager) confirmSubmitted(ctx context.Context, now time.Time) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	txns, err := getSubmittedTxns(db, now.Add(-m.confirmationDelay), m.batchSize)
+	db.Rollback()
+	if err != nil {
+		Logger.Error("Error getting submitted transactions", zap.Error(err))
+		return
+	}
+
+	if len(txns) == 0 {
+		return
+	}
+
+	// the latest finalized block is requested before the verification, so a
+	// submission included up to the block is verified
+	finalized, err := m.client.LatestFinalized()
+	if err != nil {
+		Logger.Error("Error getting the latest finalized block, not resubmitting transactions", zap.Error(err))
+	}
+
+	swg := sizedwaitgroup.New(m.numWorkers)
+	for _, txn := range txns {
+		swg.Add()
+		go func(txn *Txn) {
+			defer swg.Done()
+			for _, hash := range txn.hashes() {
+				if t, err := m.client.Verify(hash); err == nil {
+					m.complete(ctx, txn, t, nil, nil)
+					return
+				}
+			}
+
+			updates := m.afterUnconfirmed(txn, now, finalized)
+			if updates == nil {
+				return // still waiting
+			}
+			if m.outOfAttempts(txn.Attempts) {
+				m.complete(ctx, txn, nil, common.NewError("txn_not_confirmed",
+					"transaction not confirmed, out of attempts"), nil)
+				return
+			}
+			m.update(ctx, txn, updates)
+		}(txn)
+	}
+	swg.Wait()
+}
+
+func (m *Manager) update(ctx context.Context, txn *Txn, updates map[string]interface{}) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	if err := db.Model(txn).Updates(updates).Error; err != nil {
+		db.Rollback()
+		Logger.Error("Error updating queued transaction", zap.Int64("seq", txn.Seq), zap.Error(err))
+		return
+	}
+	if err := db.Commit().Error; err != nil {
+		Logger.Error("Error committing queued transaction", zap.Int64("seq", txn.Seq), zap.Error(err))
+	}
+}
+
+// complete calls the callback and marks the transaction confirmed or failed
+// within one DB transaction.
+func (m *Manager) complete(ctx context.Context, txn *Txn, t *transaction.Transaction,
+	txnErr error, updates map[string]interface{}) {
+
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	if txnErr != nil {
+		updates["status"] = Failed
+		updates["last_error"] = txnErr.Error()
+	} else {
+		updates["status"] = Confirmed
+		updates["txn_hash"] = t.Hash
+		updates["txn_output"] = t.TransactionOutput
+	}
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+
+	if cb := getCallback(txn.Kind); cb != nil {
+		if err := cb(rctx, txn, t, txnErr); err != nil {
+			db.Rollback()
+			m.callbackFailed(ctx, txn, updates, err)
+			return
+		}
+	}
+
+	if err := db.Model(txn).Updates(updates).Error; err != nil {
+		db.Rollback()
+		Logger.Error("Error updating queued transaction", zap.Int64("seq", txn.Seq), zap.Error(err))
+		return
+	}
+	if err := db.Commit().Error; err != nil {
+		Logger.Error("Error committing queued transaction", zap.Int64("seq", txn.Seq), zap.Error(err))
+		return
+	}
+
+	if txnErr != nil {
+		Logger.Error("Transaction failed", zap.Int64("seq", txn.Seq),
+			zap.String("kind", txn.Kind), zap.String("ref_id", txn.RefID), zap.Error(txnErr))
+	} else {
+		Logger.Info("Transaction confirmed", zap.Int64("seq", txn.Seq),
+			zap.String("kind", txn.Kind), zap.String("ref_id", txn.RefID), zap.String("txn", t.Hash))
+	}
+}
+
+// callbackFailed counts the failed call of the callback, the transaction
+// fails once the callback is out of attempts, keeping its confirmation.
+func (m *Manager) callbackFailed(ctx context.Context, txn *Txn, updates map[string]interface{}, err error) {
+	attempts := txn.CallbackAttempts + 1
+	if !m.outOfAttempts(attempts) {
+		Logger.Error("Error in transaction callback, will retry", zap.Int64("seq", txn.Seq),
+			zap.String("kind", txn.Kind), zap.String("ref_id", txn.RefID), zap.Error(err))
+		m.update(ctx, txn, map[string]interface{}{"callback_attempts": attempts})
+		return
+	}
+
+	Logger.Error("Error in transaction callback, out of attempts", zap.Int64("seq", txn.Seq),
+		zap.String("kind", txn.Kind), zap.String("ref_id", txn.RefID), zap.Error(err))
+	updates["callback_attempts"] = attempts
+	updates["status"] = Failed
+	updates["last_error"] = "callback failed: " + err.Error()
+	m.update(ctx, txn, updates)
+}
@@ -0,0 +1,75 @@
+package txnmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testManager() *Manager {
+	return &Manager{
+		maxAttempts:         3,
+		backoffBase:         5 * time.Second,
+		backoffMax:          time.Minute,
+		confirmationTimeout: time.Minute,
+	}
+}
+
+func TestManager_backoff(t *testing.T) {
+	m := testManager()
+	assert.Equal(t, 5*time.Second, m.backoff(0))
+	assert.Equal(t, 5*time.Second, m.backoff(1))
+	assert.Equal(t, 10*time.Second, m.backoff(2))
+	assert.Equal(t, 40*time.Second, m.backoff(4))
+	assert.Equal(t, time.Minute, m.backoff(5))
+	assert.Equal(t, time.Minute, m.backoff(100))
+}
+
+func TestManager_afterSubmit(t *testing.T) {
+	m := testManager()
+	now := time.Now()
+
+	t.Run("failed", func(t *testing.T) {
+		txn := &Txn{Attempts: 1}
+		updates := m.afterSubmit(txn, "", errors.New("no miners"), now)
+		assert.Equal(t, 2, updates["attempts"])
+		assert.Equal(t, "no miners", updates["last_error"])
+		assert.Equal(t, now.Add(10*time.Second), updates["next_attempt_at"])
+		assert.NotContains(t, updates, "status")
+	})
+
+	t.Run("resubmitted", func(t *testing.T) {
+		txn := &Txn{Attempts: 1, Hash: "hash_2", PrevHashes: "hash_1"}
+		updates := m.afterSubmit(txn, "hash_3", nil, now)
+		assert.Equal(t, Submitted, updates["status"])
+		assert.Equal(t, "hash_3", updates["txn_hash"])
+		assert.Equal(t, "hash_2,hash_1", updates["prev_txn_hashes"])
+
+		txn.Hash, txn.PrevHashes = "hash_3", "hash_2,hash_1"
+		assert.Equal(t, []string{"hash_3", "hash_2", "hash_1"}, txn.hashes())
+	})
+}
+
+func TestManager_afterUnconfirmed(t *testing.T) {
+	m := testManager()
+	now := time.Now()
+
+	submitted := now.Add(-30 * time.Second)
+	require.Nil(t, m.afterUnconfirmed(&Txn{SubmittedAt: &submitted}, now, now))
+
+	// the submission can still be included in a block
+	submitted = now.Add(-2 * time.Minute)
+	require.Nil(t, m.afterUnconfirmed(&Txn{Attempts: 2, SubmittedAt: &submitted}, now, submitted.Add(txnExpiration)))
+	require.Nil(t, m.afterUnconfirmed(&Txn{Attempts: 2, SubmittedAt: &submitted}, now, time.Time{}))
+
+	updates := m.afterUnconfirmed(&Txn{Attempts: 2, SubmittedAt: &submitted}, now, now)
+	require.NotNil(t, updates)
+	assert.Equal(t, Queued, updates["status"])
+	assert.Equal(t, now.Add(10*time.Second), updates["next_attempt_at"])
+
+	assert.False(t, m.outOfAttempts(2))
+	assert.True(t, m.outOfAttempts(3))
+}
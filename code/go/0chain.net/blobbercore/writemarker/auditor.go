@@ -0,0 +1,347 @@
+package writemarker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/core/node"
+	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
+)
+
+// kinds of write marker chain issues
+const (
+	IssueGap              = "gap"               // no marker continues the chain
+	IssueFork             = "fork"              // markers with the same previous root
+	IssueOrphan           = "orphan"            // marker not reachable from the chain start
+	IssueHeadMismatch     = "head_mismatch"     // chain does not end at the allocation root
+	IssueInvalidSignature = "invalid_signature" // marker signature is not valid
+	IssueTimestamp        = "timestamp"         // marker is older than the previous one
+	IssueSizeMismatch     = "size_mismatch"     // sizes do not sum to blobber_size_used
+	IssueFailed           = "failed"            // redeem of the marker failed
+	IssueStuck            = "stuck"             // no marker can be redeemed next
+)
+
+// ChainIssue is a problem found in the write marker chain.
+type ChainIssue struct {
+	Kind           string `json:"kind"`
+	AllocationRoot string `json:"allocation_root,omitempty"`
+	Message        string `json:"message"`
+}
+
+// ChainReport is the result of the write marker chain audit of an allocation.
+type ChainReport struct {
+	AllocationID     string       `json:"allocation_id"`
+	AllocationRoot   string       `json:"allocation_root"`
+	LatestRedeemedWM string       `json:"latest_redeemed_write_marker"`
+	Markers          int          `json:"markers"`
+	Committed        int          `json:"committed"`
+	Pending          int          `json:"pending"`
+	ChainSize        int64        `json:"chain_size"`
+	BlobberSizeUsed  int64        `json:"blobber_size_used"`
+	Stuck            bool         `json:"stuck"`
+	Issues           []ChainIssue `json:"issues"`
+
+	// chain of markers from the first one to the head
+	chain []*WriteMarkerEntity
+}
+
+// Healthy returns true if no issue was found.
+func (r *ChainReport) Healthy() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *ChainReport) addIssue(kind, root, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ChainIssue{
+		Kind:           kind,
+		AllocationRoot: root,
+		Message:        fmt.Sprintf(format, args...),
+	})
+}
+
+func verifyMarkerSignature(wm *WriteMarkerEntity) error {
+	return wm.WM.VerifySignature(wm.ClientPublicKey)
+}
+
+// auditChain checks the markers of the allocation, ordered by sequence, form
+// a single chain from the empty root to the allocation root.
+func auditChain(a *allocation.Allocation, markers []*WriteMarkerEntity,
+	pending map[string]struct{}, verify func(*WriteMarkerEntity) error) *ChainReport {
+
+	r := &ChainReport{
+		AllocationID:     a.ID,
+		AllocationRoot:   a.AllocationRoot,
+		LatestRedeemedWM: a.LatestRedeemedWM,
+		Markers:          len(markers),
+		BlobberSizeUsed:  a.BlobberSizeUsed,
+		Issues:           make([]ChainIssue, 0),
+	}
+
+	byPrev := make(map[string][]*WriteMarkerEntity, len(markers))
+	for _, wm := range markers {
+		byPrev[wm.WM.PreviousAllocationRoot] = append(byPrev[wm.WM.PreviousAllocationRoot], wm)
+		if wm.Status == Committed {
+			r.Committed++
+		}
+		if _, ok := pending[wm.WM.AllocationRoot]; ok {
+			r.Pending++
+		}
+	}
+
+	var (
+		visited = make(map[string]bool, len(markers))
+		root    = ""
+		prev    *WriteMarkerEntity
+	)
+	for {
+		next := byPrev[root]
+		if len(next) == 0 {
+			break
+		}
+		if len(next) > 1 {
+			r.addIssue(IssueFork, root, "%d markers follow the root", len(next))
+		}
+		wm := next[0]
+		if visited[wm.WM.AllocationRoot] {
+			r.addIssue(IssueFork, wm.WM.AllocationRoot, "the chain has a loop")
+			break
+		}
+		visited[wm.WM.AllocationRoot] = true
+		r.chain = append(r.chain, wm)
+		r.ChainSize += wm.WM.Size
+
+		if err := verify(wm); err != nil {
+			r.addIssue(IssueInvalidSignature, wm.WM.AllocationRoot, "%v", err)
+		}
+		if prev != nil && wm.WM.Timestamp < prev.WM.Timestamp {
+			r.addIssue(IssueTimestamp, wm.WM.AllocationRoot,
+				"timestamp %d is before the previous marker timestamp %d",
+				wm.WM.Timestamp, prev.WM.Timestamp)
+		}
+		if wm.Status == Failed {
+			r.addIssue(IssueFailed, wm.WM.AllocationRoot, "%s", wm.StatusMessage)
+		}
+		prev, root = wm, wm.WM.AllocationRoot
+	}
+
+	if root != a.AllocationRoot {
+		if len(markers) > len(r.chain) {
+			r.addIssue(IssueGap, root, "no marker follows the root, the chain ends before the allocation root %q", a.AllocationRoot)
+		} else {
+			r.addIssue(IssueHeadMismatch, root, "the chain ends at %q, but the allocation root is %q", root, a.AllocationRoot)
+		}
+	}
+	for _, wm := range markers {
+		if !visited[wm.WM.AllocationRoot] {
+			r.addIssue(IssueOrphan, wm.WM.AllocationRoot,
+				"the previous root %q is not in the chain", wm.WM.PreviousAllocationRoot)
+		}
+	}
+	if r.ChainSize != a.BlobberSizeUsed {
+		r.addIssue(IssueSizeMismatch, "", "sizes of the chain sum to %d, but blobber_size_used is %d",
+			r.ChainSize, a.BlobberSizeUsed)
+	}
+
+	// the redeem worker continues from the latest redeemed marker, so it
+	// stalls if no marker not redeemed yet follows it
+	if r.Committed < len(markers) && len(a.LatestRedeemedWM) > 0 {
+		redeemable := false
+		for _, wm := range byPrev[a.LatestRedeemedWM] {
+			if wm.Status != Committed {
+				redeemable = true
+			}
+		}
+		if !redeemable && r.Pending == 0 {
+			r.Stuck = true
+			r.addIssue(IssueStuck, a.LatestRedeemedWM,
+				"%d markers are not redeemed, but none follows the latest redeemed marker",
+				len(markers)-r.Committed)
+		}
+	}
+	return r
+}
+
+func getAllocationMarkers(ctx context.Context, allocationID string) ([]*WriteMarkerEntity, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	markers := make([]*WriteMarkerEntity, 0)
+	err := db.Where(WriteMarker{AllocationID: allocationID}).
+		Order("sequence").
+		Find(&markers).Error
+	return markers, err
+}
+
+// AuditAllocation checks the write marker chain of the allocation.
+func AuditAllocation(ctx context.Context, a *allocation.Allocation) (*ChainReport, error) {
+	markers, err := getAllocationMarkers(ctx, a.ID)
+	if err != nil {
+		return nil, common.NewErrorf("write_marker_audit",
+			"can't get write markers of allocation %s: %v", a.ID, err)
+	}
+	pending, err := txnmanager.GetPendingRefIDs(ctx, transaction.CLOSE_CONNECTION_SC_NAME)
+	if err != nil {
+		return nil, common.NewErrorf("write_marker_audit",
+			"can't get pending transactions: %v", err)
+	}
+	return auditChain(a, markers, pending, verifyMarkerSignature), nil
+}
+
+// AuditAllocations checks the write marker chains of all allocations not
+// cleaned up yet, or of the given allocation only.
+func AuditAllocations(ctx context.Context, allocationID string) ([]*ChainReport, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	allocations := make([]*allocation.Allocation, 0)
+	query := db.Where("cleaned_up = ?", false)
+	if allocationID != "" {
+		query = db.Where("id = ?", allocationID)
+	}
+	if err := query.Order("id").Find(&allocations).Error; err != nil {
+		return nil, common.NewErrorf("write_marker_audit",
+			"can't get allocations: %v", err)
+	}
+
+	reports := make([]*ChainReport, 0, len(allocations))
+	for _, a := range allocations {
+		r, err := AuditAllocation(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// ResyncAction is a step of the re-sync of a write marker chain.
+type ResyncAction struct {
+	Action         string `json:"action"`
+	AllocationRoot string `json:"allocation_root,omitempty"`
+	Message        string `json:"message"`
+}
+
+// ResyncPlan brings the local redeem state of the allocation in line with
+// the allocation root committed on chain.
+type ResyncPlan struct {
+	AllocationID string          `json:"allocation_id"`
+	ChainRoot    string          `json:"chain_allocation_root"`
+	Applied      bool            `json:"applied"`
+	Actions      []*ResyncAction `json:"actions"`
+	Report       *ChainReport    `json:"report"`
+}
+
+func (p *ResyncPlan) add(action, root, format string, args ...interface{}) {
+	p.Actions = append(p.Actions, &ResyncAction{
+		Action:         action,
+		AllocationRoot: root,
+		Message:        fmt.Sprintf(format, args...),
+	})
+}
+
+// planResync returns the actions making the markers up to the chain root
+// committed and the following ones redeemable again.
+func planResync(r *ChainReport, chainRoot string) (*ResyncPlan, error) {
+	p := &ResyncPlan{
+		AllocationID: r.AllocationID,
+		ChainRoot:    chainRoot,
+		Actions:      make([]*ResyncAction, 0),
+		Report:       r,
+	}
+
+	onChain := chainRoot == ""
+	for _, wm := range r.chain {
+		if !onChain {
+			if wm.Status != Committed {
+				p.add("commit", wm.WM.AllocationRoot, "the marker is committed on chain")
+			}
+		} else if wm.Status == Failed {
+			p.add("retry", wm.WM.AllocationRoot, "the marker is redeemed again")
+		}
+		if wm.WM.AllocationRoot == chainRoot {
+			onChain = true
+		}
+	}
+	if !onChain {
+		return nil, common.NewErrorf("write_marker_resync",
+			"the allocation root %q committed on chain is not in the local chain", chainRoot)
+	}
+
+	if r.LatestRedeemedWM != chainRoot {
+		p.add("set_latest_redeemed", chainRoot, "the latest redeemed marker was %q", r.LatestRedeemedWM)
+	}
+	p.add("set_redeem_required", "", "%t", chainRoot != r.AllocationRoot)
+	return p, nil
+}
+
+// ResyncAllocation plans the re-sync of the write marker chain of the
+// allocation against the chain state and applies it if asked.
+func ResyncAllocation(ctx context.Context, a *allocation.Allocation, apply bool) (*ResyncPlan, error) {
+	r, err := AuditAllocation(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	if r.Pending > 0 {
+		return nil, common.NewErrorf("write_marker_resync",
+			"%d redeem transactions of the allocation are pending", r.Pending)
+	}
+
+	sa, err := allocation.RequestAllocation(a.ID)
+	if err != nil {
+		return nil, common.NewErrorf("write_marker_resync",
+			"can't get allocation from chain: %v", err)
+	}
+	var details *transaction.BlobberAllocation
+	for _, d := range sa.BlobberDetails {
+		if d.BlobberID == node.Self.ID {
+			details = d
+		}
+	}
+	// an empty root resets the redeem state to the start of the chain, it
+	// is taken only from the blobber details with nothing redeemed
+	if details == nil {
+		return nil, common.NewErrorf("write_marker_resync",
+			"the blobber is not in the allocation %s on chain", a.ID)
+	}
+	if details.AllocationRoot == "" && details.Spent > 0 {
+		return nil, common.NewErrorf("write_marker_resync",
+			"no allocation root on chain for the allocation %s with redeemed writes", a.ID)
+	}
+	chainRoot := details.AllocationRoot
+
+	p, err := planResync(r, chainRoot)
+	if err != nil || !apply {
+		return p, err
+	}
+
+	db := datastore.GetStore().GetTransaction(ctx)
+	for _, wm := range r.chain {
+		for _, action := range p.Actions {
+			if action.AllocationRoot != wm.WM.AllocationRoot {
+				continue
+			}
+			switch action.Action {
+			case "commit":
+				err = wm.UpdateStatus(ctx, Committed, "re-synced with the chain state", wm.CloseTxnID)
+			case "retry":
+				err = db.Model(wm).Updates(map[string]interface{}{
+					"status":         Accepted,
+					"status_message": "",
+				}).Error
+			}
+			if err != nil {
+				return nil, common.NewErrorf("write_marker_resync",
+					"can't update marker %s: %v", wm.WM.AllocationRoot, err)
+			}
+		}
+	}
+	err = db.Model(a).Updates(map[string]interface{}{
+		"latest_redeemed_write_marker": chainRoot,
+		"is_redeem_required":           chainRoot != a.AllocationRoot,
+	}).Error
+	if err != nil {
+		return nil, common.NewErrorf("write_marker_resync",
+			"can't update allocation: %v", err)
+	}
+	p.Applied = true
+	return p, nil
+}
@@ -0,0 +1,115 @@
+package writemarker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMarker(prev, root string, size int64, ts common.Timestamp, status WriteMarkerStatus) *WriteMarkerEntity {
+	return &WriteMarkerEntity{
+		WM: WriteMarker{
+			AllocationRoot:         root,
+			PreviousAllocationRoot: prev,
+			AllocationID:           "allocation_1",
+			Size:                   size,
+			Timestamp:              ts,
+		},
+		Status: status,
+	}
+}
+
+func validSignature(*WriteMarkerEntity) error { return nil }
+
+func issueKinds(r *ChainReport) []string {
+	kinds := make([]string, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func TestAuditChain(t *testing.T) {
+	alloc := func(root, redeemed string, used int64) *allocation.Allocation {
+		return &allocation.Allocation{
+			ID:               "allocation_1",
+			AllocationRoot:   root,
+			LatestRedeemedWM: redeemed,
+			BlobberSizeUsed:  used,
+		}
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		markers := []*WriteMarkerEntity{
+			testMarker("", "r1", 10, 1, Committed),
+			testMarker("r1", "r2", 20, 2, Accepted),
+		}
+		r := auditChain(alloc("r2", "r1", 30), markers, nil, validSignature)
+		assert.True(t, r.Healthy(), "%v", r.Issues)
+		assert.Equal(t, 1, r.Committed)
+		assert.Equal(t, int64(30), r.ChainSize)
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		markers := []*WriteMarkerEntity{
+			testMarker("", "r1", 10, 1, Committed),
+			testMarker("r2", "r3", 20, 3, Accepted),
+		}
+		r := auditChain(alloc("r3", "r1", 30), markers, nil, validSignature)
+		assert.Equal(t, []string{IssueGap, IssueOrphan, IssueSizeMismatch, IssueStuck}, issueKinds(r))
+		assert.True(t, r.Stuck)
+	})
+
+	t.Run("pending_is_not_stuck", func(t *testing.T) {
+		markers := []*WriteMarkerEntity{
+			testMarker("", "r1", 10, 1, Accepted),
+			testMarker("r1", "r2", 20, 2, Accepted),
+		}
+		pending := map[string]struct{}{"r1": {}}
+		r := auditChain(alloc("r2", "r0", 30), markers, pending, validSignature)
+		assert.False(t, r.Stuck)
+		assert.Equal(t, 1, r.Pending)
+	})
+
+	t.Run("marker_checks", func(t *testing.T) {
+		markers := []*WriteMarkerEntity{
+			testMarker("", "r1", 10, 5, Committed),
+			testMarker("r1", "r2", 20, 4, Failed),
+		}
+		invalid := func(wm *WriteMarkerEntity) error {
+			if wm.WM.AllocationRoot == "r1" {
+				return errors.New("bad signature")
+			}
+			return nil
+		}
+		r := auditChain(alloc("r2", "r1", 30), markers, nil, invalid)
+		assert.Equal(t, []string{IssueInvalidSignature, IssueTimestamp, IssueFailed}, issueKinds(r))
+		assert.False(t, r.Stuck)
+	})
+}
+
+func TestPlanResync(t *testing.T) {
+	markers := []*WriteMarkerEntity{
+		testMarker("", "r1", 10, 1, Committed),
+		testMarker("r1", "r2", 20, 2, Failed),
+		testMarker("r2", "r3", 30, 3, Failed),
+	}
+	a := &allocation.Allocation{ID: "allocation_1", AllocationRoot: "r3", LatestRedeemedWM: "r1", BlobberSizeUsed: 60}
+	r := auditChain(a, markers, nil, validSignature)
+
+	p, err := planResync(r, "r2")
+	require.NoError(t, err)
+
+	actions := make([]string, 0, len(p.Actions))
+	for _, action := range p.Actions {
+		actions = append(actions, action.Action+":"+action.AllocationRoot)
+	}
+	assert.Equal(t, []string{"commit:r2", "retry:r3", "set_latest_redeemed:r2", "set_redeem_required:"}, actions)
+
+	_, err = planResync(r, "unknown")
+	assert.Error(t, err)
+}
@@ -3,10 +3,14 @@ package writemarker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/constants"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/ledger"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
 	"github.com/0chain/blobber/code/go/0chain.net/core/chain"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	"github.com/0chain/blobber/code/go/0chain.net/core/encryption"
@@ -15,6 +19,7 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type CommitConnection struct {
@@ -58,9 +63,14 @@ func (wm *WriteMarkerEntity) VerifyMarker(ctx context.Context, sa *allocation.Al
 		return common.NewError("write_marker_validation_failed", "Write Marker is not by the same client who uploaded")
 	}
 
-	hashData := wm.WM.GetHashData()
+	return wm.WM.VerifySignature(clientPublicKey)
+}
+
+// VerifySignature checks the write marker is signed by the client.
+func (wm *WriteMarker) VerifySignature(clientPublicKey string) error {
+	hashData := wm.GetHashData()
 	signatureHash := encryption.Hash(hashData)
-	sigOK, err := encryption.Verify(clientPublicKey, wm.WM.Signature, signatureHash)
+	sigOK, err := encryption.Verify(clientPublicKey, wm.Signature, signatureHash)
 	if err != nil {
 		return common.NewError("write_marker_validation_failed", "Error during verifying signature. "+err.Error())
 	}
@@ -71,6 +81,10 @@ func (wm *WriteMarkerEntity) VerifyMarker(ctx context.Context, sa *allocation.Al
 	return nil
 }
 
+// RedeemMarker queues the transaction committing the write marker to 0chain.
+// The marker status is updated on confirmation, see onWriteMarkerRedeemed.
+// If a previous transaction of the marker is confirmed already, the marker
+// becomes committed right away.
 func (wm *WriteMarkerEntity) RedeemMarker(ctx context.Context) error {
 
 	if len(wm.CloseTxnID) > 0 {
@@ -79,19 +93,12 @@ func (wm *WriteMarkerEntity) RedeemMarker(ctx context.Context) error {
 			wm.Status = Committed
 			wm.StatusMessage = t.TransactionOutput
 			wm.CloseTxnID = t.Hash
-			err = wm.UpdateStatus(ctx, Committed, t.TransactionOutput, t.Hash)
-			return err
-		}
-	}
-
-	txn, err := transaction.NewTransactionEntity()
-	if err != nil {
-		wm.StatusMessage = "Error creating transaction entity. " + err.Error()
-		wm.ReedeemRetries++
-		if err := wm.UpdateStatus(ctx, Failed, "Error creating transaction entity. "+err.Error(), ""); err != nil {
-			Logger.Error("WriteMarkerEntity_UpdateStatus", zap.Error(err))
+			if err = wm.UpdateStatus(ctx, Committed, t.TransactionOutput, t.Hash); err != nil {
+				return err
+			}
+			// the submission time is unknown
+			return onWriteRedeemed(ctx, wm, t, time.Time{})
 		}
-		return err
 	}
 
 	sn := &CommitConnection{}
@@ -99,46 +106,126 @@ func (wm *WriteMarkerEntity) RedeemMarker(ctx context.Context) error {
 	sn.PrevAllocationRoot = wm.WM.PreviousAllocationRoot
 	sn.WriteMarker = &wm.WM
 
-	snBytes, err := json.Marshal(sn)
+	_, err := txnmanager.Enqueue(ctx, &txnmanager.Request{
+		Kind:  transaction.CLOSE_CONNECTION_SC_NAME,
+		RefID: wm.WM.AllocationRoot,
+		// markers of an allocation are committed in order
+		Lane:  transaction.CLOSE_CONNECTION_SC_NAME + ":" + wm.WM.AllocationID,
+		Name:  transaction.CLOSE_CONNECTION_SC_NAME,
+		Input: sn,
+	})
 	if err != nil {
-		Logger.Error("Error encoding sc input", zap.String("err:", err.Error()), zap.Any("scdata", sn))
+		Logger.Error("Failed queueing close connection transaction", zap.Error(err))
 		wm.Status = Failed
-		wm.StatusMessage = "Error encoding sc input. " + err.Error()
-		wm.ReedeemRetries++
-		if err := wm.UpdateStatus(ctx, Failed, "Error encoding sc input. "+err.Error(), ""); err != nil {
+		wm.StatusMessage = "Failed queueing close connection transaction. " + err.Error()
+		if err := wm.UpdateStatus(ctx, Failed, "Failed queueing close connection transaction. "+err.Error(), ""); err != nil {
 			Logger.Error("WriteMarkerEntity_UpdateStatus", zap.Error(err))
 		}
 		return err
 	}
+	return nil
+}
+
+// onWriteMarkerRedeemed updates the write marker and its allocation when the
+// close connection transaction is confirmed or failed.
+func onWriteMarkerRedeemed(ctx context.Context, txn *txnmanager.Txn,
+	t *transaction.Transaction, txnErr error) error {
 
-	err = txn.ExecuteSmartContract(transaction.STORAGE_CONTRACT_ADDRESS, transaction.CLOSE_CONNECTION_SC_NAME, string(snBytes), 0)
+	wm, err := GetWriteMarkerEntity(ctx, txn.RefID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
 	if err != nil {
-		Logger.Error("Failed during sending close connection to the miner. ", zap.String("err:", err.Error()))
-		wm.Status = Failed
-		wm.StatusMessage = "Failed during sending close connection to the miner. " + err.Error()
-		wm.ReedeemRetries++
-		if err := wm.UpdateStatus(ctx, Failed, "Failed during sending close connection to the miner. "+err.Error(), ""); err != nil {
-			Logger.Error("WriteMarkerEntity_UpdateStatus", zap.Error(err))
-		}
 		return err
 	}
 
-	time.Sleep(transaction.SLEEP_FOR_TXN_CONFIRMATION * time.Second)
-	t, err := transaction.VerifyTransaction(txn.Hash, chain.GetServerChain())
+	if txnErr != nil {
+		Logger.Error("Error committing the write marker", zap.String("wm", wm.WM.AllocationRoot),
+			zap.String("txn", txn.Hash), zap.Error(txnErr))
+		return wm.UpdateStatus(ctx, Failed, "Error committing the write marker. "+txnErr.Error(), txn.Hash)
+	}
+
+	if err = wm.UpdateStatus(ctx, Committed, t.TransactionOutput, t.Hash); err != nil {
+		return err
+	}
+	var submittedAt time.Time
+	if txn.SubmittedAt != nil {
+		submittedAt = *txn.SubmittedAt
+	}
+	if err = onWriteRedeemed(ctx, wm, t, submittedAt); err != nil {
+		return err
+	}
+
+	db := datastore.GetStore().GetTransaction(ctx)
+	err = db.Model(&allocation.Allocation{}).
+		Where("id = ?", wm.WM.AllocationID).
+		Update("latest_redeemed_write_marker", wm.WM.AllocationRoot).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(&allocation.Allocation{}).
+		Where("id = ? AND allocation_root = ?", wm.WM.AllocationID, wm.WM.AllocationRoot).
+		Update("is_redeem_required", false).Error
 	if err != nil {
-		Logger.Error("Error verifying the close connection transaction", zap.String("err:", err.Error()), zap.String("txn", txn.Hash))
-		wm.Status = Failed
-		wm.StatusMessage = "Error verifying the close connection transaction." + err.Error()
-		wm.ReedeemRetries++
-		wm.CloseTxnID = txn.Hash
-		if err := wm.UpdateStatus(ctx, Failed, "Error verifying the close connection transaction."+err.Error(), txn.Hash); err != nil {
-			Logger.Error("WriteMarkerEntity_UpdateStatus", zap.Error(err))
-		}
 		return err
 	}
-	wm.Status = Committed
-	wm.StatusMessage = t.TransactionOutput
-	wm.CloseTxnID = t.Hash
-	err = wm.UpdateStatus(ctx, Committed, t.TransactionOutput, t.Hash)
-	return err
+
+	Logger.Info("Success Redeeming the write marker", zap.Any("wm", wm.WM.AllocationRoot), zap.Any("txn", t.Hash))
+	return nil
+}
+
+// onWriteRedeemed adds the tokens moved from the write pools by the
+// committed write marker to the earnings ledger and subtracts them from the
+// write pools cache. The output of the transaction is the blobber allocation
+// of the storage smart contract, with the tokens spent on the writes so far.
+func onWriteRedeemed(ctx context.Context, wm *WriteMarkerEntity,
+	t *transaction.Transaction, submittedAt time.Time) error {
+
+	alloc, err := allocation.GetAllocationByID(ctx, wm.WM.AllocationID)
+	if err != nil {
+		return common.NewErrorf("write_redeem_ledger",
+			"can't get allocation from DB: %v", err)
+	}
+
+	var details transaction.BlobberAllocation
+	if err = json.Unmarshal([]byte(t.TransactionOutput), &details); err != nil {
+		return common.NewErrorf("write_redeem_ledger",
+			"can't decode transaction output: %v", err)
+	}
+	value, err := ledger.Unrecorded(ctx, ledger.WriteRedeem, wm.WM.AllocationID, details.Spent)
+	if err != nil {
+		return common.NewErrorf("write_redeem_ledger",
+			"can't get the redeemed tokens from DB: %v", err)
+	}
+
+	payerID := alloc.PayerID
+	if payerID == "" {
+		payerID = wm.WM.ClientID
+	}
+	var numBlocks int64
+	if wm.WM.Size > 0 {
+		numBlocks = (wm.WM.Size + allocation.CHUNK_SIZE - 1) / allocation.CHUNK_SIZE
+	}
+
+	if value > 0 {
+		db := datastore.GetStore().GetTransaction(ctx)
+		err = allocation.ReconcileWriteRedeemed(db, payerID, wm.WM.AllocationID,
+			wm.WM.BlobberID, value, submittedAt)
+		if err != nil {
+			return common.NewErrorf("write_redeem_pools",
+				"can't update local write pools cache: %v", err)
+		}
+	}
+
+	return ledger.Add(ctx, &ledger.Entry{
+		Kind:         ledger.WriteRedeem,
+		AllocationID: wm.WM.AllocationID,
+		ClientID:     wm.WM.ClientID,
+		PayerID:      payerID,
+		RefID:        wm.WM.AllocationRoot,
+		Tokens:       value,
+		NumBlocks:    numBlocks,
+		Size:         wm.WM.Size,
+		TxnHash:      t.Hash,
+	})
 }
@@ -7,13 +7,17 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/allocation"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/config"
 	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/datastore"
+	"github.com/0chain/blobber/code/go/0chain.net/blobbercore/txnmanager"
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 	"github.com/remeh/sizedwaitgroup"
 
 	"go.uber.org/zap"
 )
 
 func SetupWorkers(ctx context.Context) {
+	txnmanager.RegisterCallback(transaction.CLOSE_CONNECTION_SC_NAME, onWriteMarkerRedeemed)
 	go RedeemWriteMarkers(ctx)
 }
 
@@ -37,17 +41,30 @@ func RedeemMarkersForAllocation(ctx context.Context, allocationObj *allocation.A
 	if err != nil {
 		return err
 	}
+	// markers with a queued transaction are redeemed already
+	pending, err := txnmanager.GetPendingRefIDs(rctx, transaction.CLOSE_CONNECTION_SC_NAME)
+	if err != nil {
+		return err
+	}
+
 	startredeem := false
 	for _, wm := range writemarkers {
 		if wm.WM.PreviousAllocationRoot == allocationObj.LatestRedeemedWM && !startredeem {
 			startredeem = true
 		}
+		if _, ok := pending[wm.WM.AllocationRoot]; ok {
+			continue
+		}
 		if startredeem || len(allocationObj.LatestRedeemedWM) == 0 {
 			err := wm.RedeemMarker(rctx)
 			if err != nil {
 				Logger.Error("Error redeeming the write marker.", zap.Any("wm", wm.WM.AllocationID), zap.Any("error", err))
 				continue
 			}
+			if wm.Status != Committed {
+				Logger.Info("Queued the write marker redeem", zap.Any("wm", wm.WM.AllocationRoot))
+				continue // committed by the transaction callback
+			}
 			err = db.Model(allocationObj).Updates(allocation.Allocation{LatestRedeemedWM: wm.WM.AllocationRoot}).Error
 			if err != nil {
 				Logger.Error("Error redeeming the write marker. Allocation latest wm redeemed update failed", zap.Any("wm", wm.WM.AllocationRoot), zap.Any("error", err))
@@ -67,14 +84,15 @@ func RedeemMarkersForAllocation(ctx context.Context, allocationObj *allocation.A
 }
 
 func RedeemWriteMarkers(ctx context.Context) {
-	var ticker = time.NewTicker(
-		time.Duration(config.Configuration.WMRedeemFreq) * time.Second,
-	)
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-time.After(time.Duration(config.Get().WMRedeemFreq) * time.Second):
+			end, err := common.StartOperation("worker", "redeem_write_markers")
+			if err != nil {
+				return
+			}
 			// Logger.Info("Trying to redeem writemarkers.",
 			//	zap.Any("numOfWorkers", numOfWorkers))
 			rctx := datastore.GetStore().CreateTransaction(ctx)
@@ -83,7 +101,7 @@ func RedeemWriteMarkers(ctx context.Context) {
 			alloc := &allocation.Allocation{IsRedeemRequired: true}
 			db.Where(alloc).Find(&allocations)
 			if len(allocations) > 0 {
-				swg := sizedwaitgroup.New(config.Configuration.WMRedeemNumWorkers)
+				swg := sizedwaitgroup.New(config.Get().WMRedeemNumWorkers)
 				for _, allocationObj := range allocations {
 					swg.Add()
 					go func(redeemCtx context.Context, allocationObj *allocation.Allocation) {
@@ -98,6 +116,7 @@ func RedeemWriteMarkers(ctx context.Context) {
 			}
 			db.Rollback()
 			rctx.Done()
+			end()
 		}
 	}
 
@@ -6,7 +6,6 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
 
@@ -43,34 +42,17 @@ func GetRootContext() context.Context {
 func Done() {
 	//Logger.Info("Initiating shutdown...")
 	rootCancel()
-	//TODO: How do we ensure every worker is completed any shutdown sequence before we finally shut down
-	//the server using server.Shutdown(ctx)
+	// the workers register their iterations with StartOperation, Shutdown
+	// waits for them
 }
 
-/*HandleShutdown - handles various shutdown signals */
+/*HandleShutdown - handles various shutdown signals with a graceful Shutdown */
 func HandleShutdown(server *http.Server) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGQUIT)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 	go func() {
-		for sig := range c {
-			switch sig {
-			case syscall.SIGINT:
-				Done()
-				ctx, cancelf := context.WithTimeout(context.Background(), 5*time.Second)
-				if err := server.Shutdown(ctx); err != nil {
-					logging.Logger.Error("server failed to gracefully shuts down", zap.Error(err))
-				}
-				cancelf()
-			case syscall.SIGQUIT:
-				Done()
-				ctx, cancelf := context.WithTimeout(context.Background(), 5*time.Second)
-				if err := server.Shutdown(ctx); err != nil {
-					logging.Logger.Error("server failed to gracefully shuts down", zap.Error(err))
-				}
-				cancelf()
-			default:
-				//Logger.Debug("unhandled signal", zap.Any("signal", sig))
-			}
-		}
+		sig := <-c
+		logging.Logger.Info("Received the shutdown signal", zap.String("signal", sig.String()))
+		Shutdown(server)
 	}()
 }
@@ -20,6 +20,9 @@ const (
 
 	// ClientSignatureHeader represents http request header contains signature.
 	ClientSignatureHeader = "X-App-Client-Signature"
+
+	// UploadChecksumHeader represents http request header contains checksum of the uploaded chunk.
+	UploadChecksumHeader = "Upload-Checksum"
 )
 
 /*ReqRespHandlerf - a type for the default hanlder signature */
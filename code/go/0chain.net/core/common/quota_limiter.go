@@ -0,0 +1,383 @@
+package common
+
+import (
+	"context"
+	"math"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RateLimitExceededCode is the error code of a request rejected because the
+// budget of its client or allocation is exhausted.
+const RateLimitExceededCode = "rate_limit_exceeded"
+
+// quotaTTL is the time the budgets of an idle client or allocation are kept
+const quotaTTL = time.Hour
+
+// RateLimitTier is a set of budgets applied to every client or allocation of
+// the tier. A zero budget means unlimited.
+type RateLimitTier struct {
+	RequestsPerSecond      float64 `mapstructure:"requests_per_second"`
+	UploadBytesPerSecond   float64 `mapstructure:"upload_bytes_per_second"`
+	DownloadBytesPerSecond float64 `mapstructure:"download_bytes_per_second"`
+}
+
+func (t RateLimitTier) isUnlimited() bool {
+	return t.RequestsPerSecond <= 0 && t.UploadBytesPerSecond <= 0 && t.DownloadBytesPerSecond <= 0
+}
+
+// QuotaConfig is the 'rate_limiters' section of the configuration.
+type QuotaConfig struct {
+	Tiers map[string]RateLimitTier `mapstructure:"tiers"`
+	// ClientTier and AllocationTier are the default tiers
+	ClientTier     string `mapstructure:"client_tier"`
+	AllocationTier string `mapstructure:"allocation_tier"`
+	// Clients and Allocations override the default tier for given IDs
+	Clients     map[string]string `mapstructure:"clients"`
+	Allocations map[string]string `mapstructure:"allocations"`
+}
+
+// bucket is a token bucket which can go into debt. A request is let through
+// while the bucket is not empty and its whole size is charged, so a big
+// upload or download is not rejected, but it delays the following requests.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	if rate <= 0 {
+		return nil // unlimited
+	}
+	burst := math.Max(rate, 1)
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// delay returns time to wait until the bucket has n tokens. The n is capped
+// by the burst, otherwise a request bigger than burst would never pass.
+func (b *bucket) delay(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	n = math.Min(math.Max(n, 1), b.burst)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// allow takes n tokens if the bucket has them, otherwise it returns time to
+// wait and takes nothing.
+func (b *bucket) allow(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	need := math.Min(math.Max(n, 1), b.burst)
+	if b.tokens < need {
+		return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return 0
+}
+
+func (b *bucket) take(now time.Time, n float64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens -= n
+}
+
+func (b *bucket) idleSince(now time.Time) time.Duration {
+	if b == nil {
+		return math.MaxInt64
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Sub(b.last)
+}
+
+type quota struct {
+	requests *bucket
+	upload   *bucket
+	download *bucket
+}
+
+func (q *quota) idleSince(now time.Time) time.Duration {
+	idle := q.requests.idleSince(now)
+	if d := q.upload.idleSince(now); d < idle {
+		idle = d
+	}
+	if d := q.download.idleSince(now); d < idle {
+		idle = d
+	}
+	return idle
+}
+
+// QuotaLimiter keeps request-rate and byte-rate budgets per client and per
+// allocation. It is shared by the HTTP and the gRPC handlers, so they behave
+// the same.
+type QuotaLimiter struct {
+	config QuotaConfig
+
+	// allowMu makes the check and the charge of the budgets by Allow a single
+	// operation, so the concurrent requests can't pass on the same tokens
+	allowMu sync.Mutex
+
+	mu        sync.Mutex
+	quotas    map[string]*quota
+	lastSweep time.Time
+}
+
+// NewQuotaLimiter creates a limiter with given configuration.
+func NewQuotaLimiter(config QuotaConfig) *QuotaLimiter {
+	return &QuotaLimiter{
+		config:    config,
+		quotas:    make(map[string]*quota),
+		lastSweep: time.Now(),
+	}
+}
+
+var quotaLimiter atomic.Value // *QuotaLimiter
+
+func init() {
+	quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{}))
+}
+
+// GetQuotaLimiter returns the limiter configured by ConfigRateLimits.
+func GetQuotaLimiter() *QuotaLimiter {
+	ql, _ := quotaLimiter.Load().(*QuotaLimiter)
+	return ql
+}
+
+func configQuotaLimiter() {
+	if _, err := ReloadQuotaLimiter(); err != nil {
+		panic(err)
+	}
+}
+
+// ReloadQuotaLimiter reads the 'rate_limiters' section again and swaps the
+// limiter if it has changed. The budgets of the clients and the allocations
+// are dropped with the old limiter. An invalid section is rejected and the
+// current limiter is kept.
+func ReloadQuotaLimiter() (bool, error) {
+	var config QuotaConfig
+	if err := viper.UnmarshalKey("rate_limiters", &config); err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(GetQuotaLimiter().config, config) {
+		return false, nil
+	}
+	quotaLimiter.Store(NewQuotaLimiter(config))
+	return true, nil
+}
+
+func (ql *QuotaLimiter) tier(id string, tiers map[string]string, defaultTier string) RateLimitTier {
+	name, ok := tiers[id]
+	if !ok {
+		name = defaultTier
+	}
+	return ql.config.Tiers[name]
+}
+
+func (ql *QuotaLimiter) get(now time.Time, kind, id string) *quota {
+	if id == "" {
+		return nil
+	}
+
+	var tier RateLimitTier
+	if kind == "client" {
+		tier = ql.tier(id, ql.config.Clients, ql.config.ClientTier)
+	} else {
+		tier = ql.tier(id, ql.config.Allocations, ql.config.AllocationTier)
+	}
+	if tier.isUnlimited() {
+		return nil
+	}
+
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	if now.Sub(ql.lastSweep) > quotaTTL {
+		for key, q := range ql.quotas {
+			if q.idleSince(now) > quotaTTL {
+				delete(ql.quotas, key)
+			}
+		}
+		ql.lastSweep = now
+	}
+
+	key := kind + ":" + id
+	q, ok := ql.quotas[key]
+	if !ok {
+		q = &quota{
+			requests: newBucket(tier.RequestsPerSecond),
+			upload:   newBucket(tier.UploadBytesPerSecond),
+			download: newBucket(tier.DownloadBytesPerSecond),
+		}
+		ql.quotas[key] = q
+	}
+	return q
+}
+
+func (ql *QuotaLimiter) quotasOf(now time.Time, clientID, allocationID string) []*quota {
+	quotas := make([]*quota, 0, 2)
+	if q := ql.get(now, "client", clientID); q != nil {
+		quotas = append(quotas, q)
+	}
+	if q := ql.get(now, "allocation", allocationID); q != nil {
+		quotas = append(quotas, q)
+	}
+	return quotas
+}
+
+// Allow checks the budgets of the client and the allocation. If the request
+// is allowed, the request and its upload bytes are charged. Otherwise nothing
+// is charged and the time to wait before a retry is returned.
+func (ql *QuotaLimiter) Allow(clientID, allocationID string, uploadBytes int64) (time.Duration, bool) {
+	if ql == nil {
+		return 0, true
+	}
+
+	now := time.Now()
+	quotas := ql.quotasOf(now, clientID, allocationID)
+
+	ql.allowMu.Lock()
+	defer ql.allowMu.Unlock()
+
+	var retryAfter time.Duration
+	for _, q := range quotas {
+		for _, d := range []time.Duration{
+			q.requests.delay(now, 1),
+			q.upload.delay(now, float64(uploadBytes)),
+			q.download.delay(now, 1), // download debt of previous requests
+		} {
+			if d > retryAfter {
+				retryAfter = d
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, false
+	}
+
+	for _, q := range quotas {
+		q.requests.take(now, 1)
+		q.upload.take(now, float64(uploadBytes))
+	}
+	return 0, true
+}
+
+// ChargeUpload charges bytes received from client after the request is
+// allowed, as of a request body of unknown size.
+func (ql *QuotaLimiter) ChargeUpload(clientID, allocationID string, uploadBytes int64) {
+	if ql == nil || uploadBytes <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, q := range ql.quotasOf(now, clientID, allocationID) {
+		q.upload.take(now, float64(uploadBytes))
+	}
+}
+
+// ChargeDownload charges bytes sent to client to the budgets of the client and
+// the allocation. The size of a response is known only after it is sent, so the
+// following requests wait until the debt is repaid.
+func (ql *QuotaLimiter) ChargeDownload(clientID, allocationID string, downloadBytes int64) {
+	if ql == nil || downloadBytes <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, q := range ql.quotasOf(now, clientID, allocationID) {
+		q.download.take(now, float64(downloadBytes))
+	}
+}
+
+// ClientVerifier verifies the client by its public key and its signature of
+// the allocation.
+type ClientVerifier func(clientID, clientKey, signature, allocationID string) bool
+
+var clientVerifier ClientVerifier
+
+// SetClientVerifier sets the verifier of the clients the budgets are charged
+// to, the handlers set it since the signatures can't be verified here.
+func SetClientVerifier(verifier ClientVerifier) {
+	clientVerifier = verifier
+}
+
+type verifiedClientKey struct{}
+
+// verifiedClient is the signature verified by QuotaClient, kept in the
+// context of the request, so the handlers don't verify it again.
+type verifiedClient struct {
+	clientKey    string
+	signature    string
+	allocationID string
+}
+
+// QuotaClient returns the key of the client budget of a request. The client
+// ID is trusted only if signed, otherwise the budget is of the caller
+// address, so a caller can't use the budget of another client. The verified
+// signature is kept in the returned context for IsVerifiedClient.
+func QuotaClient(ctx context.Context, clientID, clientKey, signature, allocationID,
+	remoteAddr string) (context.Context, string) {
+
+	if clientID != "" && clientVerifier != nil &&
+		clientVerifier(clientID, clientKey, signature, allocationID) {
+		return context.WithValue(ctx, verifiedClientKey{}, verifiedClient{
+			clientKey:    clientKey,
+			signature:    signature,
+			allocationID: allocationID,
+		}), clientID
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	return ctx, "addr:" + remoteAddr
+}
+
+// IsVerifiedClient returns true if the signature of the allocation by the
+// client key was verified by QuotaClient for the request already.
+func IsVerifiedClient(ctx context.Context, clientKey, signature, allocationID string) bool {
+	vc, ok := ctx.Value(verifiedClientKey{}).(verifiedClient)
+	return ok && signature != "" && vc == verifiedClient{
+		clientKey:    clientKey,
+		signature:    signature,
+		allocationID: allocationID,
+	}
+}
+
+// RetryAfterSeconds rounds the retry hint up to whole seconds, as used in the
+// Retry-After header.
+func RetryAfterSeconds(retryAfter time.Duration) int64 {
+	secs := int64(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
@@ -0,0 +1,262 @@
+package common
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaLimiter_Allow(t *testing.T) {
+	ql := NewQuotaLimiter(QuotaConfig{
+		Tiers: map[string]RateLimitTier{
+			"basic":   {RequestsPerSecond: 2, UploadBytesPerSecond: 100},
+			"premium": {RequestsPerSecond: 1000},
+		},
+		ClientTier:  "basic",
+		Clients:     map[string]string{"vip": "premium"},
+		Allocations: map[string]string{"slow": "basic"},
+	})
+
+	t.Run("requests", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, ok := ql.Allow("client_1", "", 0)
+			require.True(t, ok)
+		}
+		retryAfter, ok := ql.Allow("client_1", "", 0)
+		require.False(t, ok)
+		assert.True(t, retryAfter > 0)
+
+		// other clients have own budgets
+		_, ok = ql.Allow("client_2", "", 0)
+		assert.True(t, ok)
+	})
+
+	t.Run("tier_override", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			_, ok := ql.Allow("vip", "", 0)
+			require.True(t, ok)
+		}
+	})
+
+	t.Run("allocation", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, ok := ql.Allow("vip", "slow", 0)
+			require.True(t, ok)
+		}
+		_, ok := ql.Allow("vip", "slow", 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("upload_bytes", func(t *testing.T) {
+		// a big upload passes, but the following one waits for the debt
+		_, ok := ql.Allow("client_3", "", 1000)
+		require.True(t, ok)
+		retryAfter, ok := ql.Allow("client_3", "", 10)
+		require.False(t, ok)
+		assert.True(t, retryAfter.Seconds() > 8)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		ql := NewQuotaLimiter(QuotaConfig{})
+		for i := 0; i < 100; i++ {
+			_, ok := ql.Allow("client_1", "allocation_1", 1<<30)
+			require.True(t, ok)
+		}
+	})
+}
+
+func TestQuotaLimiter_ChargeDownload(t *testing.T) {
+	ql := NewQuotaLimiter(QuotaConfig{
+		Tiers:          map[string]RateLimitTier{"basic": {DownloadBytesPerSecond: 100}},
+		AllocationTier: "basic",
+	})
+
+	_, ok := ql.Allow("client_1", "allocation_1", 0)
+	require.True(t, ok)
+	ql.ChargeDownload("client_1", "allocation_1", 500)
+
+	retryAfter, ok := ql.Allow("client_2", "allocation_1", 0)
+	require.False(t, ok)
+	assert.Equal(t, int64(5), RetryAfterSeconds(retryAfter))
+}
+
+func TestQuotaLimiter_AllowConcurrent(t *testing.T) {
+	ql := NewQuotaLimiter(QuotaConfig{
+		Tiers:      map[string]RateLimitTier{"basic": {RequestsPerSecond: 10}},
+		ClientTier: "basic",
+	})
+
+	var (
+		wg      sync.WaitGroup
+		allowed int32
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := ql.Allow("client_1", "", 0); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	// no request passes on the tokens taken by another one
+	assert.True(t, allowed <= 11, "allowed %d", allowed)
+}
+
+func TestQuotaLimit_ChunkedUpload(t *testing.T) {
+	quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{
+		Tiers:      map[string]RateLimitTier{"basic": {UploadBytesPerSecond: 100}},
+		ClientTier: "basic",
+	}))
+	defer quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{}))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/file/upload/{allocation}", quotaLimit(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body) //nolint:errcheck
+	}))
+
+	request := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/file/upload/allocation_1",
+			strings.NewReader(strings.Repeat("x", 1000)))
+		r.ContentLength = -1 // chunked
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// the body is charged once read, though its size was not known
+	assert.Equal(t, http.StatusOK, request())
+	assert.Equal(t, http.StatusTooManyRequests, request())
+}
+
+func TestQuotaLimit_HTTP(t *testing.T) {
+	quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{
+		Tiers:      map[string]RateLimitTier{"basic": {RequestsPerSecond: 1}},
+		ClientTier: "basic",
+	}))
+	defer quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{}))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/file/meta/{allocation}", quotaLimit(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}")) //nolint:errcheck
+	}))
+
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/file/meta/allocation_1", nil)
+		r.Header.Set(ClientHeader, "client_1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request().Code)
+
+	w := request()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.True(t, strings.Contains(w.Body.String(), RateLimitExceededCode))
+}
+
+func TestSetRateLimit(t *testing.T) {
+	defer userRateLimit.Store(newUserRateLimit(0))
+	SetRateLimit(1)
+
+	handler := UserRateLimit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func() int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/v1/file/list/a1", nil))
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, serve())
+	require.Equal(t, http.StatusTooManyRequests, serve())
+
+	// applies to the clients seen already
+	SetRateLimit(1000)
+	require.Equal(t, http.StatusOK, serve())
+}
+
+func TestReloadQuotaLimiter(t *testing.T) {
+	defer quotaLimiter.Store(NewQuotaLimiter(QuotaConfig{}))
+	defer viper.Set("rate_limiters", nil)
+
+	viper.Set("rate_limiters", map[string]interface{}{
+		"tiers":       map[string]interface{}{"basic": map[string]interface{}{"requests_per_second": 1}},
+		"client_tier": "basic",
+	})
+	reloaded, err := ReloadQuotaLimiter()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	ql := GetQuotaLimiter()
+	_, ok := ql.Allow("client_1", "", 0)
+	require.True(t, ok)
+	_, ok = ql.Allow("client_1", "", 0)
+	require.False(t, ok)
+
+	// the budgets are kept while the section is the same
+	reloaded, err = ReloadQuotaLimiter()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+	require.Equal(t, ql, GetQuotaLimiter())
+
+	viper.Set("rate_limiters", map[string]interface{}{
+		"tiers":       map[string]interface{}{"basic": map[string]interface{}{"requests_per_second": 1000}},
+		"client_tier": "basic",
+	})
+	reloaded, err = ReloadQuotaLimiter()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	_, ok = GetQuotaLimiter().Allow("client_1", "", 0)
+	require.True(t, ok)
+
+	viper.Set("rate_limiters", "invalid")
+	_, err = ReloadQuotaLimiter()
+	require.Error(t, err)
+}
+
+func TestQuotaClient(t *testing.T) {
+	defer SetClientVerifier(nil)
+	SetClientVerifier(func(clientID, clientKey, signature, allocationID string) bool {
+		return clientKey == "key_"+clientID && signature == "sig_"+allocationID
+	})
+
+	ctx, clientID := QuotaClient(context.Background(), "client_1", "key_client_1", "sig_a1", "a1", "10.0.0.1:5051")
+	assert.Equal(t, "client_1", clientID)
+	assert.True(t, IsVerifiedClient(ctx, "key_client_1", "sig_a1", "a1"))
+	assert.False(t, IsVerifiedClient(ctx, "key_client_1", "sig_a2", "a2"))
+	assert.False(t, IsVerifiedClient(ctx, "key_client_2", "sig_a1", "a1"))
+
+	// the client of another caller is not trusted without its signature
+	ctx, clientID = QuotaClient(context.Background(), "client_1", "key_client_1", "", "a1", "10.0.0.2:5051")
+	assert.Equal(t, "addr:10.0.0.2", clientID)
+	assert.False(t, IsVerifiedClient(ctx, "key_client_1", "", "a1"))
+	_, clientID = QuotaClient(context.Background(), "", "", "", "", "10.0.0.2")
+	assert.Equal(t, "addr:10.0.0.2", clientID)
+}
+
+func TestGRPCRateLimiter(t *testing.T) {
+	r := new(GRPCRateLimiter)
+	r.SetRate(1)
+
+	_, ok := r.Allow()
+	require.True(t, ok)
+	retryAfter, ok := r.Allow()
+	require.False(t, ok)
+	assert.True(t, retryAfter > 0)
+
+	r.SetRate(1000)
+	_, ok = r.Allow()
+	assert.True(t, ok)
+}
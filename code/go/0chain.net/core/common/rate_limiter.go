@@ -1,13 +1,17 @@
 package common
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/didip/tollbooth"
 	"github.com/didip/tollbooth/limiter"
+	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
-	rl "go.uber.org/ratelimit"
 )
 
 type ratelimit struct {
@@ -16,7 +20,19 @@ type ratelimit struct {
 	RequestsPerSecond float64
 }
 
-var userRateLimit *ratelimit
+// userRateLimit is the *ratelimit of the handlers, replaced as a whole on
+// the rate limit change since the limiter keeps the rate of the buckets of
+// the clients seen already.
+var userRateLimit atomic.Value
+
+func newUserRateLimit(requestsPerSecond float64) *ratelimit {
+	if requestsPerSecond == 0 {
+		requestsPerSecond = DefaultRequestPerSecond
+	}
+	url := &ratelimit{RequestsPerSecond: requestsPerSecond}
+	url.init()
+	return url
+}
 
 func (rl *ratelimit) init() {
 	if rl.RequestsPerSecond == 0 {
@@ -33,41 +49,135 @@ const DefaultRequestPerSecond = 100000
 
 //ConfigRateLimits - configure the rate limits
 func ConfigRateLimits() {
-	userRl := viper.GetFloat64("handlers.rate_limit")
+	userRateLimit.Store(newUserRateLimit(viper.GetFloat64("handlers.rate_limit")))
 
-	if userRl == 0 {
-		userRl = DefaultRequestPerSecond
-	}
+	configQuotaLimiter()
+}
 
-	userRateLimit = &ratelimit{RequestsPerSecond: userRl}
-	userRateLimit.init()
+// GRPCRateLimiter limits the gRPC requests by the handlers.rate_limit. The
+// requests over the limit are rejected as the HTTP ones, not delayed.
+type GRPCRateLimiter struct {
+	requests atomic.Value // *bucket
 }
 
+var grpcRateLimit atomic.Value // *GRPCRateLimiter
+
 func NewGRPCRateLimiter() *GRPCRateLimiter {
-	userRl := viper.GetFloat64("handlers.rate_limit")
+	r := new(GRPCRateLimiter)
+	r.SetRate(viper.GetFloat64("handlers.rate_limit"))
+	grpcRateLimit.Store(r)
+	return r
+}
 
-	if userRl == 0 {
-		userRl = DefaultRequestPerSecond
+// SetRate changes the requests per second.
+func (r *GRPCRateLimiter) SetRate(requestsPerSecond float64) {
+	if requestsPerSecond == 0 {
+		requestsPerSecond = DefaultRequestPerSecond
 	}
-
-	return &GRPCRateLimiter{rl.New(int(userRl))}
+	r.requests.Store(newBucket(requestsPerSecond))
 }
 
-type GRPCRateLimiter struct {
-	rl.Limiter
+// Allow charges the request if it's within the limit. Otherwise it returns
+// the time to wait before a retry.
+func (r *GRPCRateLimiter) Allow() (time.Duration, bool) {
+	b, _ := r.requests.Load().(*bucket)
+	if d := b.allow(time.Now(), 1); d > 0 {
+		return d, false
+	}
+	return 0, true
 }
 
-func (r *GRPCRateLimiter) Limit() bool {
-	r.Take()
-	return false
+// SetRateLimit changes the requests per second of the handlers.
+func SetRateLimit(requestsPerSecond float64) {
+	// the buckets of the clients are dropped with the limiter
+	userRateLimit.Store(newUserRateLimit(requestsPerSecond))
+	if r, ok := grpcRateLimit.Load().(*GRPCRateLimiter); ok {
+		r.SetRate(requestsPerSecond)
+	}
 }
 
 //UserRateLimit - rate limiting for end user handlers
 func UserRateLimit(handler ReqRespHandlerf) ReqRespHandlerf {
-	if !userRateLimit.RateLimit {
-		return handler
-	}
+	handler = quotaLimit(handler)
 	return func(writer http.ResponseWriter, request *http.Request) {
-		tollbooth.LimitFuncHandler(userRateLimit.Limiter, handler).ServeHTTP(writer, request)
+		url, _ := userRateLimit.Load().(*ratelimit)
+		if url == nil || !url.RateLimit {
+			handler(writer, request)
+			return
+		}
+		tollbooth.LimitFuncHandler(url.Limiter, handler).ServeHTTP(writer, request)
 	}
 }
+
+// countingReader counts bytes read of the request body
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// countingResponseWriter counts bytes of the response body
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+//quotaLimit - per client and per allocation limits of requests and bandwidth
+func quotaLimit(handler ReqRespHandlerf) ReqRespHandlerf {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ql := GetQuotaLimiter()
+		allocationID := mux.Vars(r)["allocation"]
+		ctx, clientID := QuotaClient(r.Context(), r.Header.Get(ClientHeader),
+			r.Header.Get(ClientKeyHeader), r.Header.Get(ClientSignatureHeader),
+			allocationID, r.RemoteAddr)
+
+		// the size of a chunked body is not known, it's charged once read
+		var uploadBytes int64
+		if r.ContentLength > 0 {
+			uploadBytes = r.ContentLength
+		}
+
+		if retryAfter, ok := ql.Allow(clientID, allocationID, uploadBytes); !ok {
+			RespondRateLimited(w, retryAfter)
+			return
+		}
+
+		r = r.WithContext(ctx)
+		var body *countingReader
+		if r.Body != nil {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		cw := &countingResponseWriter{ResponseWriter: w}
+		handler(cw, r)
+		if body != nil {
+			ql.ChargeUpload(clientID, allocationID, body.read-uploadBytes)
+		}
+		ql.ChargeDownload(clientID, allocationID, cw.written)
+	}
+}
+
+//RespondRateLimited - respond with 429 and the time to wait before a retry
+func RespondRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := RetryAfterSeconds(retryAfter)
+	w.Header().Set("Access-Control-Allow-Origin", "*") // CORS for all.
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck // nothing to do if client is gone
+		"error":       "rate limit exceeded, retry after " + strconv.FormatInt(secs, 10) + "s",
+		"code":        RateLimitExceededCode,
+		"retry_after": secs,
+	})
+}
@@ -0,0 +1,259 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+)
+
+// ErrShuttingDown is returned for the operations started once the shutdown
+// started.
+var ErrShuttingDown = NewError("shutting_down", "The server is shutting down")
+
+// ShutdownTimeout is the time the shutdown waits for the in-flight requests
+// and operations before aborting them.
+var ShutdownTimeout = 30 * time.Second
+
+// Operation is an in-flight operation the shutdown waits for, as a commit,
+// an upload or an iteration of a worker.
+type Operation struct {
+	Kind    string    `json:"kind"`
+	ID      string    `json:"id"`
+	Started time.Time `json:"started"`
+	aborted int32
+}
+
+type operationKey struct{}
+
+var operations = struct {
+	sync.Mutex
+	shuttingDown bool
+	next         int
+	m            map[int]*Operation
+	drained      chan struct{}
+	hooks        []func()
+	stops        []func(ctx context.Context)
+	done         chan struct{}
+	once         sync.Once
+}{
+	m:    make(map[int]*Operation),
+	done: make(chan struct{}),
+}
+
+// StartOperation registers the in-flight operation of the kind, the
+// returned function ends it. It fails once the shutdown started.
+func StartOperation(kind, id string) (end func(), err error) {
+	_, end, err = startOperation(kind, id)
+	return
+}
+
+// StartAbortableOperation registers the in-flight operation as the
+// StartOperation, in the returned context. Once the shutdown aborts the
+// operation, Aborted of the context returns true: the operation checks it
+// before the changes it can't undo, and gives up.
+func StartAbortableOperation(ctx context.Context, kind, id string) (
+	context.Context, func(), error) {
+
+	op, end, err := startOperation(kind, id)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, operationKey{}, op), end, nil
+}
+
+// Aborted returns true if the operation of the context was aborted by the
+// shutdown.
+func Aborted(ctx context.Context) bool {
+	op, ok := ctx.Value(operationKey{}).(*Operation)
+	return ok && atomic.LoadInt32(&op.aborted) == 1
+}
+
+func startOperation(kind, id string) (*Operation, func(), error) {
+	operations.Lock()
+	defer operations.Unlock()
+	if operations.shuttingDown {
+		return nil, nil, ErrShuttingDown
+	}
+	key := operations.next
+	operations.next++
+	op := &Operation{Kind: kind, ID: id, Started: time.Now()}
+	operations.m[key] = op
+
+	var once sync.Once
+	return op, func() {
+		once.Do(func() {
+			operations.Lock()
+			defer operations.Unlock()
+			delete(operations.m, key)
+			if len(operations.m) == 0 && operations.drained != nil {
+				close(operations.drained)
+				operations.drained = nil
+			}
+		})
+	}, nil
+}
+
+// WaitOperations waits for the in-flight operations of the kind until the
+// context is done. It returns false if some are still running.
+func WaitOperations(ctx context.Context, kind string) bool {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if countOperations(kind) == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+func countOperations(kind string) int {
+	operations.Lock()
+	defer operations.Unlock()
+	n := 0
+	for _, op := range operations.m {
+		if op.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// IsShuttingDown returns true once the shutdown started.
+func IsShuttingDown() bool {
+	operations.Lock()
+	defer operations.Unlock()
+	return operations.shuttingDown
+}
+
+// OnShutdown registers the function run once the in-flight requests and
+// operations are finished or aborted, as closing the DB. The functions run
+// in the order registered.
+func OnShutdown(f func()) {
+	operations.Lock()
+	operations.hooks = append(operations.hooks, f)
+	operations.Unlock()
+}
+
+// OnStop registers the function stopping another server along with the HTTP
+// one, as the gRPC server. It stops accepting new connections and waits for
+// the in-flight requests until the context is done.
+func OnStop(f func(ctx context.Context)) {
+	operations.Lock()
+	operations.stops = append(operations.stops, f)
+	operations.Unlock()
+}
+
+// Shutdown stops the servers accepting new connections and rejects new
+// operations, waits for the in-flight requests, cancels the workers and
+// waits for their operations, up to the ShutdownTimeout. It returns the
+// operations aborted as not finished in time. The shutdown runs once, later
+// calls wait for it and return nil.
+func Shutdown(server *http.Server) (aborted []*Operation) {
+	first := false
+	operations.once.Do(func() {
+		first = true
+		aborted = shutdown(server)
+	})
+	if !first {
+		WaitShutdown()
+	}
+	return aborted
+}
+
+func shutdown(server *http.Server) []*Operation {
+	defer close(operations.done)
+	logging.Logger.Info("Shutting down", zap.Duration("timeout", ShutdownTimeout))
+
+	operations.Lock()
+	operations.shuttingDown = true
+	operations.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	operations.Lock()
+	stops := operations.stops
+	operations.Unlock()
+	var wg sync.WaitGroup
+	for _, f := range stops {
+		wg.Add(1)
+		go func(f func(ctx context.Context)) {
+			defer wg.Done()
+			f(ctx)
+		}(f)
+	}
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			logging.Logger.Error("server failed to gracefully shuts down", zap.Error(err))
+		}
+	}
+	wg.Wait()
+	// stop the workers
+	if rootCancel != nil {
+		Done()
+	}
+
+	aborted := waitOperations(ctx)
+	for _, op := range aborted {
+		logging.Logger.Warn("Aborted the operation on shutdown",
+			zap.String("kind", op.Kind), zap.String("id", op.ID),
+			zap.Duration("running", time.Since(op.Started)))
+		atomic.StoreInt32(&op.aborted, 1)
+	}
+
+	operations.Lock()
+	hooks := operations.hooks
+	operations.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+	logging.Logger.Info("Shut down", zap.Int("aborted", len(aborted)))
+	return aborted
+}
+
+// waitOperations waits for the in-flight operations until the context is
+// done and returns the ones not finished, by the start time.
+func waitOperations(ctx context.Context) []*Operation {
+	operations.Lock()
+	var drained chan struct{}
+	if len(operations.m) > 0 {
+		drained = make(chan struct{})
+		operations.drained = drained
+	}
+	operations.Unlock()
+
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+		}
+	}
+
+	operations.Lock()
+	defer operations.Unlock()
+	operations.drained = nil
+	aborted := make([]*Operation, 0, len(operations.m))
+	for _, op := range operations.m {
+		aborted = append(aborted, op)
+	}
+	sort.Slice(aborted, func(i, j int) bool {
+		return aborted[i].Started.Before(aborted[j].Started)
+	})
+	return aborted
+}
+
+// WaitShutdown waits for the shutdown to finish.
+func WaitShutdown() {
+	<-operations.done
+}
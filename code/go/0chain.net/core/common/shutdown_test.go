@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func resetShutdown(timeout time.Duration) (restore func()) {
+	logging.Logger = zap.NewNop()
+	operations.Lock()
+	operations.shuttingDown = false
+	operations.m = make(map[int]*Operation)
+	operations.hooks = nil
+	operations.stops = nil
+	operations.done = make(chan struct{})
+	operations.once = sync.Once{}
+	operations.Unlock()
+	SetupRootContext(context.Background())
+
+	prev := ShutdownTimeout
+	ShutdownTimeout = timeout
+	return func() { ShutdownTimeout = prev }
+}
+
+func TestShutdown(t *testing.T) {
+	defer resetShutdown(200 * time.Millisecond)()
+
+	endCommit, err := StartOperation("commit", "c1")
+	require.NoError(t, err)
+	uploadCtx, _, err := StartAbortableOperation(context.Background(), "upload", "u1")
+	require.NoError(t, err)
+	require.False(t, Aborted(uploadCtx))
+
+	var closed, stopped bool
+	OnShutdown(func() {
+		require.True(t, Aborted(uploadCtx))
+		closed = true
+	})
+	OnStop(func(ctx context.Context) { stopped = true })
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		endCommit()
+	}()
+
+	aborted := Shutdown(nil)
+	require.Len(t, aborted, 1)
+	require.Equal(t, "upload", aborted[0].Kind)
+	require.Equal(t, "u1", aborted[0].ID)
+	require.True(t, stopped)
+	require.True(t, closed)
+	require.Error(t, GetRootContext().Err())
+
+	require.True(t, IsShuttingDown())
+	_, err = StartOperation("commit", "c2")
+	require.Equal(t, ErrShuttingDown, err)
+
+	// shuts down once
+	require.Nil(t, Shutdown(nil))
+}
+
+func TestShutdownDrained(t *testing.T) {
+	defer resetShutdown(10 * time.Second)()
+
+	end, err := StartOperation("worker", "redeem_write_markers")
+	require.NoError(t, err)
+	go func() {
+		<-GetRootContext().Done()
+		end()
+	}()
+
+	start := time.Now()
+	require.Empty(t, Shutdown(nil))
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestWaitOperations(t *testing.T) {
+	defer resetShutdown(time.Second)()
+
+	end, err := StartOperation("worker", "w1")
+	require.NoError(t, err)
+	endCommit, err := StartOperation("commit", "c1")
+	require.NoError(t, err)
+	defer endCommit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.False(t, WaitOperations(ctx, "worker"))
+
+	go end()
+	require.True(t, WaitOperations(context.Background(), "worker"))
+}
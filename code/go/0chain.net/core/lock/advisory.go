@@ -0,0 +1,92 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"time"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+)
+
+// AdvisoryProvider provides the locks of the keys as Postgres advisory locks,
+// shared by the processes using the same DB. A lock holds a DB connection
+// while locked, the DB releases it if the process dies.
+type AdvisoryProvider struct {
+	db *sql.DB
+	// conns limits the connections held by the locks, so the locks leave
+	// the connections of the pool to the transactions of their holders
+	conns chan struct{}
+}
+
+// NewAdvisoryProvider returns the provider of the advisory locks of the DB,
+// holding up to the maxConns connections.
+func NewAdvisoryProvider(db *sql.DB, maxConns int) *AdvisoryProvider {
+	return &AdvisoryProvider{db: db, conns: make(chan struct{}, maxConns)}
+}
+
+func (p *AdvisoryProvider) NewLocker(key string) Locker {
+	return &advisoryLock{db: p.db, conns: p.conns, key: advisoryKey(key)}
+}
+
+// advisoryKey returns the advisory lock key of the lock key.
+func advisoryKey(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+type advisoryLock struct {
+	db    *sql.DB
+	conns chan struct{}
+	key   int64
+	conn  *sql.Conn
+}
+
+// Lock waits for the lock, retrying while the DB fails.
+func (l *advisoryLock) Lock() {
+	for {
+		err := l.TryLock(context.Background())
+		if err == nil {
+			return
+		}
+		Logger.Error("Error acquiring the advisory lock, retrying", zap.Int64("key", l.key), zap.Error(err))
+		time.Sleep(time.Second)
+	}
+}
+
+func (l *advisoryLock) TryLock(ctx context.Context) error {
+	select {
+	case l.conns <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		<-l.conns
+		return err
+	}
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.key); err != nil {
+		// the lock may be acquired as the wait is canceled
+		if _, uerr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock_all()"); uerr != nil {
+			Logger.Error("Error releasing the advisory locks", zap.Error(uerr))
+		}
+		conn.Close()
+		<-l.conns
+		return err
+	}
+	l.conn = conn
+	return nil
+}
+
+func (l *advisoryLock) Unlock() {
+	conn := l.conn
+	l.conn = nil
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		Logger.Error("Error releasing the advisory lock", zap.Int64("key", l.key), zap.Error(err))
+	}
+	conn.Close()
+	<-l.conns
+}
@@ -0,0 +1,153 @@
+package lock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+)
+
+// Stats of the locks of a table.
+type Stats struct {
+	Table string `json:"table"`
+	// Acquired locks, Failed attempts to lock and Expired locks, held
+	// longer than the LeaseTimeout.
+	Acquired int64 `json:"acquired"`
+	Failed   int64 `json:"failed"`
+	Expired  int64 `json:"expired"`
+	// Waiting for and Held locks at the moment.
+	Waiting int64 `json:"waiting"`
+	Held    int64 `json:"held"`
+	// AvgWait and MaxWait are the times waited for the locks.
+	AvgWait   time.Duration `json:"avg_wait"`
+	MaxWait   time.Duration `json:"max_wait"`
+	totalWait time.Duration
+}
+
+var lockStats = struct {
+	sync.Mutex
+	m map[string]*Stats
+}{m: make(map[string]*Stats)}
+
+func updateStats(table string, f func(s *Stats)) {
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	s, ok := lockStats.m[table]
+	if !ok {
+		s = &Stats{Table: table}
+		lockStats.m[table] = s
+	}
+	f(s)
+}
+
+// GetStats returns the stats of the locks by table.
+func GetStats() []*Stats {
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	stats := make([]*Stats, 0, len(lockStats.m))
+	for _, s := range lockStats.m {
+		cp := *s
+		stats = append(stats, &cp)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Table < stats[j].Table
+	})
+	return stats
+}
+
+// heldLock is a lock recording the stats of the locks of its table.
+type heldLock struct {
+	Locker
+	key   string
+	table string
+
+	mu    sync.Mutex
+	timer *time.Timer
+	// held while the lock is acquired and its lease hasn't expired
+	held bool
+}
+
+func (l *heldLock) Lock() {
+	start := l.wait()
+	l.Locker.Lock()
+	l.acquired(start)
+}
+
+func (l *heldLock) TryLock(ctx context.Context) error {
+	start := l.wait()
+	if err := l.Locker.TryLock(ctx); err != nil {
+		updateStats(l.table, func(s *Stats) {
+			s.Waiting--
+			s.Failed++
+		})
+		return err
+	}
+	l.acquired(start)
+	return nil
+}
+
+func (l *heldLock) wait() time.Time {
+	updateStats(l.table, func(s *Stats) { s.Waiting++ })
+	return time.Now()
+}
+
+func (l *heldLock) acquired(start time.Time) {
+	wait := time.Since(start)
+	updateStats(l.table, func(s *Stats) {
+		s.Waiting--
+		s.Held++
+		s.Acquired++
+		s.totalWait += wait
+		s.AvgWait = s.totalWait / time.Duration(s.Acquired)
+		if wait > s.MaxWait {
+			s.MaxWait = wait
+		}
+	})
+
+	l.mu.Lock()
+	l.held = true
+	if LeaseTimeout > 0 {
+		l.timer = time.AfterFunc(LeaseTimeout, l.expire)
+	}
+	l.mu.Unlock()
+}
+
+// expire releases the lock held longer than the LeaseTimeout, so a holder
+// stuck in the critical section doesn't block the other holders forever.
+func (l *heldLock) expire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held {
+		return // unlocked meanwhile
+	}
+
+	Logger.Warn("Lock lease expired, releasing the lock", zap.String("key", l.key),
+		zap.Duration("lease", LeaseTimeout))
+	updateStats(l.table, func(s *Stats) { s.Expired++ })
+	l.release()
+}
+
+func (l *heldLock) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if !l.held {
+		return // released by the lease expiration already
+	}
+	l.release()
+}
+
+func (l *heldLock) release() {
+	l.held = false
+	updateStats(l.table, func(s *Stats) { s.Held-- })
+	l.Locker.Unlock()
+}
@@ -1,6 +1,7 @@
 package lock
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -8,53 +9,117 @@ import (
 var (
 	// MutexCleanInterval start to clean unsed mutex at specified interval
 	MutexCleanInterval = 10 * time.Minute
+	// LeaseTimeout is the time a lock is held at most. A lock held longer
+	// expires, it's released for the other holders and its Unlock does
+	// nothing; 0 for no lease.
+	LeaseTimeout time.Duration
 )
 
+// Locker is a mutual exclusion lock of a key. A Locker is used by one holder
+// at a time, the holders of a key get a Locker each.
+type Locker interface {
+	// Lock waits for the lock.
+	Lock()
+	// TryLock waits for the lock until the context is done.
+	TryLock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock()
+}
+
+// Provider provides the lockers of the keys.
+type Provider interface {
+	NewLocker(key string) Locker
+}
+
+var provider Provider = localProvider{}
+
+// SetProvider sets the provider of the lockers, the in-process one by
+// default.
+func SetProvider(p Provider) {
+	provider = p
+}
+
+// GetLocker returns a locker of the key of the table.
+func GetLocker(tablename string, key string) Locker {
+	lockKey := tablename + ":" + key
+	return &heldLock{Locker: provider.NewLocker(lockKey), key: lockKey, table: tablename}
+}
+
 var (
 	lockPool  = make(map[string]*Mutex)
 	lockMutex sync.Mutex
 )
 
-// Mutex a mutual exclusion lock.
+// Mutex an in-process mutual exclusion lock of a key.
 type Mutex struct {
 	// key lock key in pool
 	key string
 	// usedby how objects it is used by
 	usedby int
-
-	sync.Mutex
+	// locked holds a value while the mutex is locked
+	locked chan struct{}
 }
 
-// Lock implements Locker.Lock
-func (m *Mutex) Lock() {
-	m.Mutex.Lock()
+// getMutex gets the mutex of the key, used by the caller until it's released.
+func getMutex(key string) *Mutex {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+
+	if eLock, ok := lockPool[key]; ok {
+		eLock.usedby++
+		return eLock
+	}
+
+	m := &Mutex{key: key, usedby: 1, locked: make(chan struct{}, 1)}
+
+	lockPool[key] = m
+
+	return m
 }
 
-// Unlock implements Locker.Unlock, and mark mutex as unlock object
-func (m *Mutex) Unlock() {
+// release marks the mutex as unused by the caller.
+func (m *Mutex) release() {
 	lockMutex.Lock()
 	defer lockMutex.Unlock()
 
 	m.usedby--
-	m.Mutex.Unlock()
 }
 
-// GetMutex get mutex by table and key
-func GetMutex(tablename string, key string) *Mutex {
-	lockKey := tablename + ":" + key
-	lockMutex.Lock()
+type localProvider struct{}
 
-	defer lockMutex.Unlock()
-	if eLock, ok := lockPool[lockKey]; ok {
-		eLock.usedby++
-		return eLock
-	}
+func (localProvider) NewLocker(key string) Locker {
+	return &localLocker{key: key}
+}
+
+// localLocker locks the in-process mutex of the key.
+type localLocker struct {
+	key string
+	m   *Mutex
+}
 
-	m := &Mutex{key: lockKey, usedby: 1}
+func (l *localLocker) Lock() {
+	m := getMutex(l.key)
+	m.locked <- struct{}{}
+	l.m = m
+}
 
-	lockPool[lockKey] = m
+func (l *localLocker) TryLock(ctx context.Context) error {
+	m := getMutex(l.key)
+	select {
+	case m.locked <- struct{}{}:
+		l.m = m
+		return nil
+	case <-ctx.Done():
+		m.release()
+		return ctx.Err()
+	}
+}
 
-	return m
+func (l *localLocker) Unlock() {
+	m := l.m
+	l.m = nil
+	<-m.locked
+	m.release()
 }
 
 func init() {
@@ -1,10 +1,16 @@
 package lock
 
 import (
+	"context"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestLock(t *testing.T) {
@@ -13,24 +19,24 @@ func TestLock(t *testing.T) {
 
 	for i := 0; i < max; i++ {
 
-		lock1 := GetMutex("testlock", strconv.Itoa(i))
+		lock1 := GetLocker("testlock", strconv.Itoa(i))
 
 		lock1.Lock()
 
-		require.Equal(t, 1, lock1.usedby)
+		require.Equal(t, 1, lockPool["testlock:"+strconv.Itoa(i)].usedby)
 
 		lock1.Unlock()
 
-		require.Equal(t, 0, lock1.usedby)
+		require.Equal(t, 0, lockPool["testlock:"+strconv.Itoa(i)].usedby)
 
-		lock2 := GetMutex("testlock", strconv.Itoa(i))
+		lock2 := GetLocker("testlock", strconv.Itoa(i))
 		lock2.Lock()
 
-		require.Equal(t, 1, lock2.usedby)
+		require.Equal(t, 1, lockPool["testlock:"+strconv.Itoa(i)].usedby)
 
 		lock2.Unlock()
 
-		require.Equal(t, 0, lock2.usedby)
+		require.Equal(t, 0, lockPool["testlock:"+strconv.Itoa(i)].usedby)
 	}
 
 	cleanUnusedMutexs()
@@ -41,3 +47,100 @@ func TestLock(t *testing.T) {
 	}
 
 }
+
+func TestTryLock(t *testing.T) {
+	lockStats.Lock()
+	delete(lockStats.m, "trylock")
+	lockStats.Unlock()
+
+	lock1 := GetLocker("trylock", "1")
+	lock1.Lock()
+
+	lock2 := GetLocker("trylock", "1")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, lock2.TryLock(ctx))
+	require.Equal(t, 1, lockPool["trylock:1"].usedby)
+
+	lock1.Unlock()
+	require.NoError(t, lock2.TryLock(context.Background()))
+	lock2.Unlock()
+
+	stats := GetStats()
+	var s *Stats
+	for _, st := range stats {
+		if st.Table == "trylock" {
+			s = st
+		}
+	}
+	require.NotNil(t, s)
+	require.EqualValues(t, 2, s.Acquired)
+	require.EqualValues(t, 1, s.Failed)
+	require.EqualValues(t, 0, s.Held)
+	require.EqualValues(t, 0, s.Waiting)
+}
+
+func TestLeaseTimeout(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	LeaseTimeout = 50 * time.Millisecond
+	defer func() { LeaseTimeout = 0 }()
+
+	var expiredBefore int64
+	for _, s := range GetStats() {
+		if s.Table == "expiredlock" {
+			expiredBefore = s.Expired
+		}
+	}
+
+	lock1 := GetLocker("expiredlock", "1")
+	lock1.Lock()
+
+	// the expired lock is released for the others
+	lock2 := GetLocker("expiredlock", "1")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, lock2.TryLock(ctx))
+
+	// unlock of the expired lock doesn't release the lock of the others
+	lock1.Unlock()
+	lock3 := GetLocker("expiredlock", "1")
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, lock3.TryLock(ctx))
+
+	lock2.Unlock()
+
+	var expired int64
+	for _, s := range GetStats() {
+		if s.Table == "expiredlock" {
+			expired = s.Expired
+			require.EqualValues(t, 0, s.Held)
+		}
+	}
+	require.EqualValues(t, 1, expired-expiredBefore)
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	SetProvider(NewAdvisoryProvider(db, 1))
+	defer SetProvider(localProvider{})
+
+	key := advisoryKey("allocations:a1")
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(key).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(key).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	l := GetLocker("allocations", "a1")
+	require.NoError(t, l.TryLock(context.Background()))
+
+	// waits for the connection held by the first lock
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, GetLocker("allocations", "a2").TryLock(ctx))
+	l.Unlock()
+	require.NoError(t, mock.ExpectationsWereMet())
+}
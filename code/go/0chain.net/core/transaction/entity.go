@@ -86,6 +86,16 @@ type StorageNode struct {
 type BlobberAllocation struct {
 	BlobberID string `json:"blobber_id"`
 	Terms     Terms  `json:"terms"`
+	// AllocationRoot of the latest write marker committed on chain
+	AllocationRoot string `json:"allocation_root"`
+	// MinLockDemand is paid to the blobber on finalization, minus the
+	// tokens Spent on writes
+	MinLockDemand int64 `json:"min_lock_demand"`
+	Spent         int64 `json:"spent"`
+	// ChallengeReward and Penalty are the tokens the blobber got for the
+	// passed challenges and lost for the failed ones
+	ChallengeReward int64 `json:"challenge_reward"`
+	Penalty         int64 `json:"penalty"`
 }
 
 type StorageAllocation struct {
@@ -86,3 +86,57 @@ func SendPostRequest(url string, data []byte, wg *sync.WaitGroup) (
 	body, err = ioutil.ReadAll(resp.Body)
 	return body, err
 }
+
+// SendPostRequestWithContext is SendPostRequest giving up when the context is
+// done, the context limits all the retries.
+func SendPostRequestWithContext(ctx context.Context, url string, data []byte) (
+	body []byte, err error) {
+
+	for i := 0; i < MAX_RETRIES; i++ {
+		if body, err = sendPostRequest(ctx, url, data); err == nil {
+			return body, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(SLEEP_BETWEEN_RETRIES * time.Second):
+		}
+	}
+	Logger.Error("Failed after multiple retries", zap.Any("url", url), zap.Int("retried", MAX_RETRIES), zap.Error(err))
+	return nil, err
+}
+
+func sendPostRequest(ctx context.Context, url string, data []byte) (
+	body []byte, err error) {
+
+	req, rctx, cncl, err := NewHTTPRequest(http.MethodPost, url, data)
+	if err != nil {
+		return nil, err
+	}
+	defer cncl()
+
+	// the request timeout or the given context, whichever is done first
+	rctx, cancel := context.WithCancel(rctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-rctx.Done():
+		}
+	}()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(rctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, common.NewError("http_error", "Error from HTTP call. "+string(body))
+	}
+	return body, nil
+}
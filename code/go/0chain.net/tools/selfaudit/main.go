@@ -0,0 +1,120 @@
+// Command selfaudit dry-runs a challenge of an allocation on a blobber and
+// reports whether the blobber would pass it. It exits with 1 on failure.
+//
+//	selfaudit -blobber http://localhost:5051 -allocation <id> [-block N] [-seed S]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+type check struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped"`
+	Reason  string `json:"reason"`
+}
+
+type report struct {
+	AllocationID    string  `json:"allocation_id"`
+	ChallengedRoot  string  `json:"challenged_root"`
+	LatestRoot      string  `json:"latest_root"`
+	Seed            int64   `json:"seed"`
+	BlockNum        int64   `json:"block_num"`
+	BlockOffset     int     `json:"block_offset"`
+	Path            string  `json:"path"`
+	NumWriteMarkers int     `json:"num_write_markers"`
+	Passed          bool    `json:"passed"`
+	Checks          []check `json:"checks"`
+}
+
+func main() {
+	blobber := flag.String("blobber", "http://localhost:5051", "blobber URL")
+	allocationID := flag.String("allocation", "", "allocation ID")
+	block := flag.Int64("block", 0, "block number to challenge, derived from the seed if not set")
+	seed := flag.Int64("seed", 0, "challenge seed, random if not set")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *allocationID == "" {
+		fmt.Fprintln(os.Stderr, "missing -allocation")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	q := url.Values{}
+	if *block > 0 {
+		q.Set("block", strconv.FormatInt(*block, 10))
+	}
+	if *seed != 0 {
+		q.Set("seed", strconv.FormatInt(*seed, 10))
+	}
+	u := *blobber + "/_challenge/selfaudit/" + url.PathEscape(*allocationID)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Get(u)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "request failed:", err)
+		os.Exit(2)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading response:", err)
+		os.Exit(2)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "blobber responded %s: %s\n", resp.Status, body)
+		os.Exit(2)
+	}
+
+	var r report
+	if err = json.Unmarshal(body, &r); err != nil {
+		fmt.Fprintln(os.Stderr, "decoding response:", err)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		os.Stdout.Write(body) //nolint:errcheck
+		fmt.Println()
+	} else {
+		fmt.Printf("allocation:      %s\n", r.AllocationID)
+		fmt.Printf("challenged root: %s\n", r.ChallengedRoot)
+		fmt.Printf("latest root:     %s (%d write markers)\n", r.LatestRoot, r.NumWriteMarkers)
+		fmt.Printf("seed:            %d\n", r.Seed)
+		fmt.Printf("block:           %d (offset %d) %s\n", r.BlockNum, r.BlockOffset, r.Path)
+		for _, c := range r.Checks {
+			status := "PASS"
+			switch {
+			case c.Skipped:
+				status = "SKIP"
+			case !c.Passed:
+				status = "FAIL"
+			}
+			if c.Reason != "" {
+				fmt.Printf("  %s %-18s %s\n", status, c.Name, c.Reason)
+			} else {
+				fmt.Printf("  %s %s\n", status, c.Name)
+			}
+		}
+		if r.Passed {
+			fmt.Println("result: PASS")
+		} else {
+			fmt.Println("result: FAIL")
+		}
+	}
+	if !r.Passed {
+		os.Exit(1)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/0chain/blobber/code/go/0chain.net/core/transaction"
 	"github.com/0chain/blobber/code/go/0chain.net/core/util"
 	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/config"
+	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/stats"
 	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/storage"
 
 	"github.com/0chain/gosdk/zcncore"
@@ -36,6 +37,7 @@ var serverChain *chain.Chain
 func initHandlers(r *mux.Router) {
 	r.HandleFunc("/", HomePageHandler)
 	storage.SetupHandlers(r)
+	stats.SetupHandlers(r)
 }
 
 func main() {
@@ -72,6 +74,12 @@ func main() {
 	config.Configuration.NumDelegates = viper.GetInt("num_delegates")
 	config.Configuration.ServiceCharge = viper.GetFloat64("service_charge")
 
+	config.Configuration.TicketStorePath = viper.GetString("ticket_store.path")
+	config.Configuration.TicketStoreTTL = viper.GetDuration("ticket_store.ttl")
+	config.Configuration.TicketStoreExpireInterval = viper.GetDuration("ticket_store.expire_interval")
+	config.Configuration.StatsPath = viper.GetString("stats.path")
+	config.Configuration.StatsSaveInterval = viper.GetDuration("stats.save_interval")
+
 	if *hostname == "" {
 		panic("Please specify --hostname which is the public hostname")
 	}
@@ -101,6 +109,8 @@ func main() {
 	config.SetServerChainID(config.Configuration.ChainID)
 
 	common.SetupRootContext(node.GetNodeContext())
+	setupTicketStore()
+	setupStats()
 	//ctx := common.GetRootContext()
 	serverChain = chain.NewChainFromConfig()
 
@@ -157,7 +167,39 @@ func main() {
 
 	Logger.Info("Ready to listen to the requests")
 	startTime = time.Now().UTC()
-	log.Fatal(server.ListenAndServe())
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	common.WaitShutdown()
+}
+
+func setupTicketStore() {
+	ttl := config.Configuration.TicketStoreTTL
+	if config.Configuration.TicketStorePath == "" {
+		storage.SetTicketStore(storage.NewMemoryTicketStore(ttl))
+		return
+	}
+	tickets, err := storage.OpenTicketStore(config.Configuration.TicketStorePath, ttl)
+	if err != nil {
+		Logger.Panic("Error opening the validation ticket store", zap.Error(err))
+	}
+	Logger.Info("Validation ticket store opened", zap.String("path", config.Configuration.TicketStorePath), zap.Int("tickets", tickets.Len()))
+	storage.SetTicketStore(tickets)
+	if interval := config.Configuration.TicketStoreExpireInterval; interval > 0 {
+		go tickets.ExpireWorker(common.GetRootContext(), interval)
+	}
+}
+
+func setupStats() {
+	if config.Configuration.StatsPath == "" {
+		return
+	}
+	if err := stats.Load(config.Configuration.StatsPath); err != nil {
+		Logger.Error("Error loading the validator stats", zap.Error(err))
+	}
+	if interval := config.Configuration.StatsSaveInterval; interval > 0 {
+		go stats.SaveWorker(common.GetRootContext(), interval)
+	}
 }
 
 func RegisterValidator() {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/0chain/blobber/code/go/0chain.net/core/config"
 	"github.com/spf13/viper"
@@ -14,6 +15,11 @@ func SetupDefaultConfig() {
 	viper.SetDefault("min_stake", 1.0)
 	viper.SetDefault("max_stake", 100.0)
 	viper.SetDefault("num_delegates", 100)
+	viper.SetDefault("ticket_store.path", "data/validator_tickets.log")
+	viper.SetDefault("ticket_store.ttl", "24h")
+	viper.SetDefault("ticket_store.expire_interval", "10m")
+	viper.SetDefault("stats.path", "data/validator_stats.json")
+	viper.SetDefault("stats.save_interval", "1m")
 }
 
 /*SetupConfig - setup the configuration system */
@@ -45,6 +51,18 @@ type Config struct {
 	NumDelegates int `json:"num_delegates"`
 	// ServiceCharge of related blobber.
 	ServiceCharge float64 `json:"service_charge"`
+	// TicketStorePath is the file of the issued validation tickets, empty
+	// to keep them in memory only.
+	TicketStorePath string `json:"ticket_store_path"`
+	// TicketStoreTTL is how long the issued tickets are kept.
+	TicketStoreTTL time.Duration `json:"ticket_store_ttl"`
+	// TicketStoreExpireInterval is how often the expired tickets are dropped.
+	TicketStoreExpireInterval time.Duration `json:"ticket_store_expire_interval"`
+	// StatsPath is the file the stats counters are saved to, empty to not
+	// keep them across restarts.
+	StatsPath string `json:"stats_path"`
+	// StatsSaveInterval is how often the stats counters are saved.
+	StatsSaveInterval time.Duration `json:"stats_save_interval"`
 }
 
 /*Configuration of the system */
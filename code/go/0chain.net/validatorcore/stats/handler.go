@@ -0,0 +1,188 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/0chain/blobber/code/go/0chain.net/core/node"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+var startTime = time.Now()
+
+// ValidatorStats are the stats of the validator.
+type ValidatorStats struct {
+	ClientID  string        `json:"id"`
+	PublicKey string        `json:"public_key"`
+	StartedAt time.Time     `json:"started_at"`
+	Uptime    time.Duration `json:"uptime"`
+	*Counters
+}
+
+// LoadValidatorStats returns the current stats of the validator.
+func LoadValidatorStats() *ValidatorStats {
+	return &ValidatorStats{
+		ClientID:  node.Self.ID,
+		PublicKey: node.Self.PublicKey,
+		StartedAt: startTime,
+		Uptime:    time.Since(startTime).Truncate(time.Second),
+		Counters:  GetCounters(),
+	}
+}
+
+/*SetupHandlers sets up the stats API end points */
+func SetupHandlers(r *mux.Router) {
+	r.HandleFunc("/_stats", common.UserRateLimit(StatsHandler))
+	r.HandleFunc("/_statsJSON", common.UserRateLimit(common.ToJSONResponse(StatsJSONHandler)))
+	r.HandleFunc("/metrics", common.UserRateLimit(MetricsHandler)).Methods("GET")
+}
+
+const tpl = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Validator Diagnostics</title>
+  </head>
+  <body>
+    <h1>
+      Validator Stats
+    </h1>
+    <table border="1">
+      <tr><td>ID</td><td>{{ .ClientID }}</td></tr>
+      <tr><td>PublicKey</td><td>{{ .PublicKey }}</td></tr>
+      <tr><td>Started at</td><td>{{ .StartedAt }}</td></tr>
+      <tr><td>Uptime</td><td>{{ .Uptime }}</td></tr>
+      <tr><td>Validated Challenges</td><td>{{ .Validated }}</td></tr>
+      <tr><td>Passed Challenges</td><td>{{ .Passed }}</td></tr>
+      <tr><td>Failed Challenges</td><td>{{ .Failed }}</td></tr>
+      <tr><td>Errors</td><td>{{ .Errors }}</td></tr>
+      <tr><td>Reused Tickets</td><td>{{ .Reused }}</td></tr>
+      <tr><td>Batches</td><td>{{ .Batches }} ({{ .BatchChallenges }} challenges)</td></tr>
+      <tr><td>Last Validated</td><td>{{ .LastValidated }}</td></tr>
+      <tr><td>Last Chain Error</td><td>{{ .LastChainError }}</td></tr>
+    </table>
+
+    <h1>
+      Chain Verifications
+    </h1>
+    <table border="1">
+      <tr><th>Kind</th><th>Count</th><th>Errors</th><th>Avg latency</th><th>Max latency</th></tr>
+      {{ range $kind, $l := .ChainLatency }}
+      <tr>
+        <td>{{ $kind }}</td>
+        <td>{{ $l.Count }}</td>
+        <td>{{ $l.Errors }}</td>
+        <td>{{ $l.Avg }}</td>
+        <td>{{ $l.Max }}</td>
+      </tr>
+      {{ end }}
+    </table>
+
+    <h1>
+      Failure Codes
+    </h1>
+    <table border="1">
+      <tr><th>Code</th><th>Failed challenges</th></tr>
+      {{ range $code, $n := .FailureCodes }}
+      <tr><td>{{ $code }}</td><td>{{ $n }}</td></tr>
+      {{ end }}
+    </table>
+
+    <h1>
+      Error Codes
+    </h1>
+    <table border="1">
+      <tr><th>Code</th><th>Requests</th></tr>
+      {{ range $code, $n := .ErrorCodes }}
+      <tr><td>{{ $code }}</td><td>{{ $n }}</td></tr>
+      {{ end }}
+    </table>
+  </body>
+</html>
+`
+
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	t := template.Must(template.New("diagnostics").Parse(tpl))
+	if err := t.Execute(w, LoadValidatorStats()); err != nil {
+		Logger.Error("Error in executing the template", zap.Error(err))
+	}
+}
+
+func StatsJSONHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	return LoadValidatorStats(), nil
+}
+
+// MetricsHandler writes the stats in the Prometheus text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := writeMetrics(w, LoadValidatorStats()); err != nil {
+		Logger.Error("Error writing the metrics", zap.Error(err))
+	}
+}
+
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricsWriter) printf(format string, args ...interface{}) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+func (mw *metricsWriter) metric(name, kind, help string) {
+	mw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetrics(w io.Writer, vs *ValidatorStats) error {
+	mw := &metricsWriter{w: w}
+
+	mw.metric("validator_uptime_seconds", "gauge", "Time since the validator started.")
+	mw.printf("validator_uptime_seconds %d\n", int64(vs.Uptime/time.Second))
+
+	mw.metric("validator_challenges_total", "counter", "Validated challenges by result.")
+	mw.printf("validator_challenges_total{result=\"passed\"} %d\n", vs.Passed)
+	mw.printf("validator_challenges_total{result=\"failed\"} %d\n", vs.Failed)
+
+	mw.metric("validator_challenge_failures_total", "counter", "Failed challenges by error code.")
+	for _, code := range sortedKeys(vs.FailureCodes) {
+		mw.printf("validator_challenge_failures_total{code=%q} %d\n", code, vs.FailureCodes[code])
+	}
+
+	mw.metric("validator_errors_total", "counter", "Requests not validated by error code.")
+	for _, code := range sortedKeys(vs.ErrorCodes) {
+		mw.printf("validator_errors_total{code=%q} %d\n", code, vs.ErrorCodes[code])
+	}
+
+	mw.metric("validator_reused_tickets_total", "counter", "Tickets issued before returned for a request.")
+	mw.printf("validator_reused_tickets_total %d\n", vs.Reused)
+
+	mw.metric("validator_batches_total", "counter", "Batches of challenges requested.")
+	mw.printf("validator_batches_total %d\n", vs.Batches)
+	mw.metric("validator_batch_challenges_total", "counter", "Challenges requested in batches.")
+	mw.printf("validator_batch_challenges_total %d\n", vs.BatchChallenges)
+
+	kinds := make(map[string]int64, len(vs.ChainLatency))
+	for kind := range vs.ChainLatency {
+		kinds[kind] = 0
+	}
+	mw.metric("validator_chain_verification_seconds", "summary", "Latency of the chain verifications by kind.")
+	for _, kind := range sortedKeys(kinds) {
+		l := vs.ChainLatency[kind]
+		mw.printf("validator_chain_verification_seconds_sum{kind=%q} %f\n", kind, l.Total.Seconds())
+		mw.printf("validator_chain_verification_seconds_count{kind=%q} %d\n", kind, l.Count)
+	}
+	mw.metric("validator_chain_verification_errors_total", "counter", "Failed chain verifications by kind.")
+	for _, kind := range sortedKeys(kinds) {
+		mw.printf("validator_chain_verification_errors_total{kind=%q} %d\n", kind, vs.ChainLatency[kind].Errors)
+	}
+	return mw.err
+}
@@ -0,0 +1,255 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of the chain verifications.
+const (
+	ChallengeVerification  = "challenge"
+	AllocationVerification = "allocation"
+)
+
+// Latency of the chain verifications of a kind.
+type Latency struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	Total  time.Duration `json:"total"`
+	Max    time.Duration `json:"max"`
+}
+
+// Avg returns the average latency of the verifications.
+func (l *Latency) Avg() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// Counters of the validator, persisted across restarts.
+type Counters struct {
+	// Validated challenges, Passed and Failed ones; the tickets issued
+	// before for the same request are not counted.
+	Validated int64 `json:"validated"`
+	Passed    int64 `json:"passed"`
+	Failed    int64 `json:"failed"`
+	// Errors of the requests not validated, by the error code.
+	Errors int64 `json:"errors"`
+	// Reused tickets issued before for the same request.
+	Reused int64 `json:"reused"`
+	// Batches of challenges requested and their challenges.
+	Batches         int64 `json:"batches"`
+	BatchChallenges int64 `json:"batch_challenges"`
+	// FailureCodes are the numbers of the failed challenges by the error
+	// code of the verification, ErrorCodes of the requests not validated.
+	FailureCodes map[string]int64 `json:"failure_codes"`
+	ErrorCodes   map[string]int64 `json:"error_codes"`
+	// ChainLatency of the chain verifications by kind.
+	ChainLatency map[string]*Latency `json:"chain_latency"`
+	// LastValidated is the time the last challenge was validated at.
+	LastValidated common.Timestamp `json:"last_validated"`
+	// LastChainError is the last error verifying a transaction with the chain.
+	LastChainError   string           `json:"last_chain_error,omitempty"`
+	LastChainErrorAt common.Timestamp `json:"last_chain_error_at,omitempty"`
+}
+
+func newCounters() *Counters {
+	return &Counters{
+		FailureCodes: make(map[string]int64),
+		ErrorCodes:   make(map[string]int64),
+		ChainLatency: make(map[string]*Latency),
+	}
+}
+
+func (c *Counters) copy() *Counters {
+	cp := *c
+	cp.FailureCodes = make(map[string]int64, len(c.FailureCodes))
+	for k, v := range c.FailureCodes {
+		cp.FailureCodes[k] = v
+	}
+	cp.ErrorCodes = make(map[string]int64, len(c.ErrorCodes))
+	for k, v := range c.ErrorCodes {
+		cp.ErrorCodes[k] = v
+	}
+	cp.ChainLatency = make(map[string]*Latency, len(c.ChainLatency))
+	for k, v := range c.ChainLatency {
+		l := *v
+		cp.ChainLatency[k] = &l
+	}
+	return &cp
+}
+
+var counters = struct {
+	sync.Mutex
+	*Counters
+	path  string
+	dirty bool
+}{Counters: newCounters()}
+
+func update(f func(c *Counters)) {
+	counters.Lock()
+	defer counters.Unlock()
+	f(counters.Counters)
+	counters.dirty = true
+}
+
+// ChallengeValidated counts the challenge validated with the result, the code
+// is the error code of a failed verification.
+func ChallengeValidated(passed bool, code string) {
+	update(func(c *Counters) {
+		c.Validated++
+		c.LastValidated = common.Now()
+		if passed {
+			c.Passed++
+			return
+		}
+		c.Failed++
+		c.FailureCodes[code]++
+	})
+}
+
+// ValidationError counts the request not validated for the error.
+func ValidationError(code string) {
+	update(func(c *Counters) {
+		c.Errors++
+		c.ErrorCodes[code]++
+	})
+}
+
+// TicketReused counts the ticket issued before returned for a request.
+func TicketReused() {
+	update(func(c *Counters) { c.Reused++ })
+}
+
+// BatchRequested counts the batch of challenges.
+func BatchRequested(challenges int) {
+	update(func(c *Counters) {
+		c.Batches++
+		c.BatchChallenges += int64(challenges)
+	})
+}
+
+// ChainVerified records the latency of the chain verification of the kind.
+func ChainVerified(kind string, latency time.Duration, err error) {
+	update(func(c *Counters) {
+		l, ok := c.ChainLatency[kind]
+		if !ok {
+			l = new(Latency)
+			c.ChainLatency[kind] = l
+		}
+		l.Count++
+		l.Total += latency
+		if latency > l.Max {
+			l.Max = latency
+		}
+		if err != nil {
+			l.Errors++
+			c.LastChainError = err.Error()
+			c.LastChainErrorAt = common.Now()
+		}
+	})
+}
+
+// GetCounters returns a copy of the counters.
+func GetCounters() *Counters {
+	counters.Lock()
+	defer counters.Unlock()
+	return counters.copy()
+}
+
+// Load loads the counters saved to the file, which they are saved to
+// afterwards.
+func Load(path string) error {
+	counters.Lock()
+	defer counters.Unlock()
+	counters.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c := newCounters()
+	if err = json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if c.FailureCodes == nil {
+		c.FailureCodes = make(map[string]int64)
+	}
+	if c.ErrorCodes == nil {
+		c.ErrorCodes = make(map[string]int64)
+	}
+	if c.ChainLatency == nil {
+		c.ChainLatency = make(map[string]*Latency)
+	}
+	counters.Counters = c
+	return nil
+}
+
+// Save saves the counters to the file if they changed.
+func Save() error {
+	counters.Lock()
+	if counters.path == "" || !counters.dirty {
+		counters.Unlock()
+		return nil
+	}
+	path := counters.path
+	data, err := json.Marshal(counters.Counters)
+	counters.dirty = false
+	counters.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SaveWorker saves the counters periodically and once the context is done.
+func SaveWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := Save(); err != nil {
+				Logger.Error("Error saving the validator stats", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := Save(); err != nil {
+				Logger.Error("Error saving the validator stats", zap.Error(err))
+			}
+		}
+	}
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
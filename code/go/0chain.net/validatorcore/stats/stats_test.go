@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountersPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data", "stats.json")
+
+	counters.Counters = newCounters()
+	require.NoError(t, Load(path))
+
+	ChallengeValidated(true, "")
+	ChallengeValidated(false, "invalid_data")
+	ValidationError("invalid_challenge")
+	TicketReused()
+	ChainVerified(ChallengeVerification, 2*time.Second, nil)
+	ChainVerified(ChallengeVerification, 4*time.Second, errors.New("not found"))
+	require.NoError(t, Save())
+
+	counters.Counters = newCounters()
+	require.NoError(t, Load(path))
+	c := GetCounters()
+	require.EqualValues(t, 2, c.Validated)
+	require.EqualValues(t, 1, c.Passed)
+	require.EqualValues(t, 1, c.FailureCodes["invalid_data"])
+	require.EqualValues(t, 1, c.ErrorCodes["invalid_challenge"])
+	require.EqualValues(t, 1, c.Reused)
+	l := c.ChainLatency[ChallengeVerification]
+	require.EqualValues(t, 2, l.Count)
+	require.EqualValues(t, 1, l.Errors)
+	require.Equal(t, 3*time.Second, l.Avg())
+	require.Equal(t, 4*time.Second, l.Max)
+	require.Equal(t, "not found", c.LastChainError)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	counters.Counters = newCounters()
+	ChallengeValidated(false, "invalid_data")
+	ChainVerified(AllocationVerification, time.Second, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, LoadValidatorStats()))
+	out := buf.String()
+	require.Contains(t, out, "# TYPE validator_challenges_total counter\n")
+	require.Contains(t, out, `validator_challenges_total{result="failed"} 1`)
+	require.Contains(t, out, `validator_challenge_failures_total{code="invalid_data"} 1`)
+	require.Contains(t, out, `validator_chain_verification_seconds_count{kind="allocation"} 1`)
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/stats"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxBatchSize is the max number of challenge requests of a batch.
+const MaxBatchSize = 100
+
+// BatchTicket is the ticket of a challenge request of a batch, or the error
+// verifying it.
+type BatchTicket struct {
+	ChallengeID string            `json:"challenge_id"`
+	Ticket      *ValidationTicket `json:"ticket,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+func hashRequest(data []byte) string {
+	h := sha3.New256()
+	_, _ = h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// BatchChallengeHandler validates a list of challenge requests of the blobber
+// and returns their tickets in the same order. Each request is the same as
+// the one of ChallengeHandler; the allocations are verified with the chain
+// once for the batch.
+func BatchChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	if r.Method == "GET" {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	requestHash := r.Header.Get("X-App-Request-Hash")
+	h := sha3.New256()
+	var requests []json.RawMessage
+	if err := json.NewDecoder(io.TeeReader(r.Body, h)).Decode(&requests); err != nil {
+		Logger.Error("Error decoding the batch input to validator")
+		return nil, common.NewError("input_decode_error", "Error in decoding the input."+err.Error())
+	}
+	if requestHash != hex.EncodeToString(h.Sum(nil)) {
+		Logger.Error("Header hash and request hash do not match")
+		return nil, common.NewError("invalid_parameters", "Header hash and request hash do not match")
+	}
+	if len(requests) == 0 || len(requests) > MaxBatchSize {
+		return nil, common.NewErrorf("invalid_parameters", "Expected 1 to %d challenge requests", MaxBatchSize)
+	}
+
+	Logger.Info("Got batch validation request.", zap.Int("requests", len(requests)))
+	stats.BatchRequested(len(requests))
+	v := newVerifier()
+	results := make([]*BatchTicket, 0, len(requests))
+	for _, data := range requests {
+		result := new(BatchTicket)
+		results = append(results, result)
+
+		var challengeRequest ChallengeRequest
+		if err := json.Unmarshal(data, &challengeRequest); err != nil {
+			result.Error = "Error in decoding the input." + err.Error()
+			continue
+		}
+		result.ChallengeID = challengeRequest.ChallengeID
+		if challengeRequest.ObjPath == nil {
+			result.Error = "Empty object path or merkle path"
+			continue
+		}
+		vt, err := v.validate(ctx, hashRequest(data), &challengeRequest)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Ticket = vt
+	}
+	return results, nil
+}
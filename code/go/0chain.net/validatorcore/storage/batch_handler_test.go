@@ -0,0 +1,51 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/logging"
+	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/storage"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/sha3"
+)
+
+func batchRequest(body string) *http.Request {
+	h := sha3.New256()
+	_, _ = h.Write([]byte(body))
+	req, _ := http.NewRequest("POST", "url", bytes.NewBufferString(body))
+	req.Header.Set("X-App-Request-Hash", hex.EncodeToString(h.Sum(nil)))
+	return req
+}
+
+func TestBatchChallengeHandler(t *testing.T) {
+	logging.Logger = zap.NewNop()
+
+	_, err := storage.BatchChallengeHandler(context.TODO(), batchRequest("{}"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error in decoding the input.")
+
+	_, err = storage.BatchChallengeHandler(context.TODO(), batchRequest("[]"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "challenge requests")
+
+	req := batchRequest(`[{"challenge_id":"c1"}]`)
+	req.Header.Set("X-App-Request-Hash", "invalid")
+	_, err = storage.BatchChallengeHandler(context.TODO(), req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Header hash and request hash do not match")
+
+	// the requests are answered one by one
+	got, err := storage.BatchChallengeHandler(context.TODO(), batchRequest(`[{"challenge_id":"c1"},"invalid"]`))
+	require.NoError(t, err)
+	tickets := got.([]*storage.BatchTicket)
+	require.Len(t, tickets, 2)
+	require.Equal(t, "c1", tickets[0].ChallengeID)
+	require.Equal(t, "Empty object path or merkle path", tickets[0].Error)
+	require.Contains(t, tickets[1].Error, "Error in decoding the input.")
+}
@@ -8,17 +8,16 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/0chain/blobber/code/go/0chain.net/core/cache"
 	"github.com/0chain/blobber/code/go/0chain.net/core/common"
 	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
 	"github.com/0chain/blobber/code/go/0chain.net/core/node"
+	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/stats"
 
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/sha3"
 )
 
-var lru = cache.NewLRUCache(10000)
-
 func ChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	if r.Method == "GET" {
 		return nil, common.NewError("invalid_method", "Invalid method used for the upload URL. Use multi-part form POST instead")
@@ -46,26 +45,65 @@ func ChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error)
 		return nil, common.NewError("invalid_parameters", "Empty object path or merkle path")
 	}
 
+	return newVerifier().validate(ctx, challengeHash, &challengeRequest)
+}
+
+// verifier validates challenges of a blobber; the allocations are verified
+// with the chain once.
+type verifier struct {
+	allocations map[string]*Allocation
+	slept       bool
+}
+
+func newVerifier() *verifier {
+	return &verifier{allocations: make(map[string]*Allocation)}
+}
+
+func (v *verifier) allocation(ctx context.Context, allocationID string) (*Allocation, error) {
+	if alloc, ok := v.allocations[allocationID]; ok {
+		return alloc, nil
+	}
+	start := time.Now()
+	alloc, err := GetProtocolImpl().VerifyAllocationTransaction(ctx, allocationID)
+	stats.ChainVerified(stats.AllocationVerification, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	v.allocations[allocationID] = alloc
+	return alloc, nil
+}
+
+// validate returns the ticket of the challenge request, the one issued before
+// for the same request if any.
+func (v *verifier) validate(ctx context.Context, challengeHash string,
+	challengeRequest *ChallengeRequest) (*ValidationTicket, error) {
+
 	Logger.Info("Processing validation.", zap.Any("challenge_id", challengeRequest.ChallengeID))
-	vt, err := lru.Get(challengeHash)
-	retVT, ok := vt.(*ValidationTicket)
-	if vt != nil && err == nil && ok {
-		return retVT, nil
+	if vt, ok := tickets.Get(challengeHash); ok {
+		stats.TicketReused()
+		return vt, nil
 	}
 
 	var validationTicket ValidationTicket
-	challengeObj, err := GetProtocolImpl().VerifyChallengeTransaction(ctx, &challengeRequest)
+	start := time.Now()
+	challengeObj, err := GetProtocolImpl().VerifyChallengeTransaction(ctx, challengeRequest)
+	stats.ChainVerified(stats.ChallengeVerification, time.Since(start), err)
 	if err != nil {
+		stats.ValidationError("invalid_challenge")
 		Logger.Error("Error verifying the challenge from BC",
 			zap.Any("challenge_id", challengeRequest.ChallengeID),
 			zap.Error(err))
 		return nil, common.NewError("invalid_parameters", "Challenge could not be verified. "+err.Error())
 	}
 
-	time.Sleep(1 * time.Second)
+	if !v.slept {
+		time.Sleep(1 * time.Second)
+		v.slept = true
+	}
 
-	allocationObj, err := GetProtocolImpl().VerifyAllocationTransaction(ctx, challengeObj.AllocationID)
+	allocationObj, err := v.allocation(ctx, challengeObj.AllocationID)
 	if err != nil {
+		stats.ValidationError("invalid_allocation")
 		Logger.Error("Error verifying the allocation from BC", zap.Any("allocation_id", challengeObj.AllocationID), zap.Error(err))
 		return nil, common.NewError("invalid_parameters", "Allocation could not be verified. "+err.Error())
 	}
@@ -79,6 +117,7 @@ func ChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error)
 		}
 
 		Logger.Error("Validation Failed - Error verifying the challenge", zap.Any("challenge_id", challengeObj.ID), zap.Error(err))
+		stats.ChallengeValidated(false, errCode)
 		validationTicket.BlobberID = challengeObj.Blobber.ID
 		validationTicket.ChallengeID = challengeObj.ID
 		validationTicket.Result = false
@@ -90,6 +129,7 @@ func ChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error)
 		if err := validationTicket.Sign(); err != nil {
 			return nil, common.NewError("invalid_parameters", err.Error())
 		}
+		saveTicket(challengeHash, &validationTicket)
 		return &validationTicket, nil
 	}
 
@@ -105,8 +145,26 @@ func ChallengeHandler(ctx context.Context, r *http.Request) (interface{}, error)
 		return nil, common.NewError("invalid_parameters", err.Error())
 	}
 	Logger.Info("Validation passed.", zap.Any("challenge_id", challengeRequest.ChallengeID))
+	stats.ChallengeValidated(true, "")
 
-	lru.Add(challengeHash, &validationTicket) //nolint:errcheck // never returns an error anyway
+	saveTicket(challengeHash, &validationTicket)
 	return &validationTicket, nil
+}
 
+// saveTicket keeps the issued ticket, a retry of the same request gets it
+// without verifying the challenge again.
+func saveTicket(challengeHash string, vt *ValidationTicket) {
+	if err := tickets.Put(challengeHash, vt); err != nil {
+		Logger.Error("Error saving the validation ticket", zap.String("challenge_id", vt.ChallengeID), zap.Error(err))
+	}
+}
+
+// TicketHandler returns the latest ticket issued for the challenge.
+func TicketHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	challengeID := mux.Vars(r)["challenge_id"]
+	vt, ok := tickets.GetByChallenge(challengeID)
+	if !ok {
+		return nil, common.NewError("ticket_not_found", "No validation ticket issued for the challenge "+challengeID)
+	}
+	return vt, nil
 }
@@ -14,6 +14,8 @@ import (
 /*SetupHandlers sets up the necessary API end points */
 func SetupHandlers(r *mux.Router) {
 	r.HandleFunc("/v1/storage/challenge/new", common.UserRateLimit(common.ToJSONResponse(SetupContext(ChallengeHandler))))
+	r.HandleFunc("/v1/storage/challenge/batch", common.UserRateLimit(common.ToJSONResponse(SetupContext(BatchChallengeHandler))))
+	r.HandleFunc("/v1/storage/challenge/ticket/{challenge_id}", common.UserRateLimit(common.ToJSONResponse(TicketHandler))).Methods("GET")
 	r.HandleFunc("/debug", common.UserRateLimit(common.ToJSONResponse(DumpGoRoutines)))
 }
 
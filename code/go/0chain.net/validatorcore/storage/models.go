@@ -295,12 +295,23 @@ func (cr *ChallengeRequest) VerifyChallenge(challengeObj *Challenge, allocationO
 		return common.NewError("challenge_validation_failed", "Failed to verify the object path."+err.Error())
 	}
 
+	Logger.Info("Verifying write marker", zap.Any("challenge_id", challengeObj.ID))
+	if err = cr.VerifyWriteMarkers(challengeObj, allocationObj); err != nil {
+		return err
+	}
+
+	Logger.Info("Verifying data block and merkle path", zap.Any("challenge_id", challengeObj.ID))
+	return cr.VerifyDataBlock()
+}
+
+// VerifyWriteMarkers - verifies the write markers chain from the challenged
+// allocation root and the latest allocation root against the object path
+func (cr *ChallengeRequest) VerifyWriteMarkers(challengeObj *Challenge, allocationObj *Allocation) error {
 	if cr.WriteMarkers == nil || len(cr.WriteMarkers) == 0 {
 		return common.NewError("challenge_validation_failed", "Invalid write marker")
 	}
 
-	Logger.Info("Verifying write marker", zap.Any("challenge_id", challengeObj.ID))
-	err = cr.WriteMarkers[0].WM.Verify(allocationObj.ID, challengeObj.AllocationRoot, cr.WriteMarkers[0].ClientPublicKey)
+	err := cr.WriteMarkers[0].WM.Verify(allocationObj.ID, challengeObj.AllocationRoot, cr.WriteMarkers[0].ClientPublicKey)
 	if err != nil {
 		return err
 	}
@@ -320,12 +331,16 @@ func (cr *ChallengeRequest) VerifyChallenge(challengeObj *Challenge, allocationO
 	if latestWM.AllocationRoot != allocationRootCalculated {
 		return common.NewError("challenge_validation_failed", "Allocation root does not match")
 	}
+	return nil
+}
 
-	if rootRef.NumBlocks == 0 {
+// VerifyDataBlock - verifies the challenged data block against the merkle
+// root of the file, the object path must be verified already
+func (cr *ChallengeRequest) VerifyDataBlock() error {
+	if cr.ObjPath.RootObject.NumBlocks == 0 {
 		return nil
 	}
 
-	Logger.Info("Verifying data block and merkle path", zap.Any("challenge_id", challengeObj.ID))
 	contentHash := encryption.Hash(cr.DataBlock)
 	merkleVerify := util.VerifyMerklePath(contentHash, cr.MerklePath, cr.ObjPath.Meta.MerkleRoot)
 	if !merkleVerify {
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	. "github.com/0chain/blobber/code/go/0chain.net/core/logging"
+
+	"go.uber.org/zap"
+)
+
+// ticketRecord is a validation ticket issued for a challenge request, keyed
+// by the hash of the request.
+type ticketRecord struct {
+	Hash    string            `json:"hash"`
+	Ticket  *ValidationTicket `json:"ticket"`
+	Expires common.Timestamp  `json:"expires"`
+}
+
+// TicketStore keeps the issued validation tickets, the failed ones too, until
+// they expire. Tickets are appended to a log file reloaded on start, which is
+// compacted when most of it has expired. A store without the file keeps the
+// tickets in memory only.
+type TicketStore struct {
+	mu          sync.Mutex
+	path        string
+	ttl         time.Duration
+	file        *os.File
+	byHash      map[string]*ticketRecord
+	byChallenge map[string]*ticketRecord
+	dead        int // expired or replaced records in the log
+}
+
+// NewMemoryTicketStore returns a store keeping the tickets in memory.
+func NewMemoryTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:         ttl,
+		byHash:      make(map[string]*ticketRecord),
+		byChallenge: make(map[string]*ticketRecord),
+	}
+}
+
+// OpenTicketStore loads the unexpired tickets of the log file, creating it
+// if needed.
+func OpenTicketStore(path string, ttl time.Duration) (*TicketStore, error) {
+	s := NewMemoryTicketStore(ttl)
+	s.path = path
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TicketStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := common.Now()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rec := new(ticketRecord)
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil || rec.Ticket == nil {
+			// a partially written record of a crash
+			Logger.Warn("Skipping invalid validation ticket record", zap.String("path", s.path))
+			continue
+		}
+		if rec.Expires <= now {
+			continue
+		}
+		s.index(rec)
+	}
+	return scanner.Err()
+}
+
+func (s *TicketStore) index(rec *ticketRecord) {
+	if _, ok := s.byHash[rec.Hash]; ok {
+		s.dead++
+	}
+	s.byHash[rec.Hash] = rec
+	if prev, ok := s.byChallenge[rec.Ticket.ChallengeID]; !ok ||
+		prev.Ticket.Timestamp <= rec.Ticket.Timestamp {
+
+		s.byChallenge[rec.Ticket.ChallengeID] = rec
+	}
+}
+
+// compact rewrites the log with the unexpired tickets and reopens it for
+// appending.
+func (s *TicketStore) compact() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range s.byHash {
+		if err = enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	s.dead = 0
+	return err
+}
+
+// Get returns the ticket issued for the challenge request hash.
+func (s *TicketStore) Get(hash string) (*ValidationTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.byHash[hash]
+	if !ok || rec.Expires <= common.Now() {
+		return nil, false
+	}
+	return rec.Ticket, true
+}
+
+// GetByChallenge returns the latest ticket issued for the challenge.
+func (s *TicketStore) GetByChallenge(challengeID string) (*ValidationTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.byChallenge[challengeID]
+	if !ok || rec.Expires <= common.Now() {
+		return nil, false
+	}
+	return rec.Ticket, true
+}
+
+// Put saves the ticket issued for the challenge request hash.
+func (s *TicketStore) Put(hash string, vt *ValidationTicket) error {
+	rec := &ticketRecord{
+		Hash:    hash,
+		Ticket:  vt,
+		Expires: common.Now() + common.Timestamp(s.ttl/time.Second),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err = s.file.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	s.index(rec)
+	return nil
+}
+
+// Expire drops the expired tickets, the log is compacted when most of it
+// is dead.
+func (s *TicketStore) Expire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := common.Now()
+	for hash, rec := range s.byHash {
+		if rec.Expires > now {
+			continue
+		}
+		delete(s.byHash, hash)
+		if s.byChallenge[rec.Ticket.ChallengeID] == rec {
+			delete(s.byChallenge, rec.Ticket.ChallengeID)
+		}
+		s.dead++
+	}
+	if s.file == nil || s.dead <= len(s.byHash) {
+		return nil
+	}
+	return s.compact()
+}
+
+// Len returns the number of tickets in the store.
+func (s *TicketStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.byHash)
+}
+
+// Close closes the log file.
+func (s *TicketStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// ExpireWorker drops the expired tickets periodically.
+func (s *TicketStore) ExpireWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Expire(); err != nil {
+				Logger.Error("Error expiring the validation tickets", zap.Error(err))
+			}
+		}
+	}
+}
+
+var tickets = NewMemoryTicketStore(24 * time.Hour)
+
+// SetTicketStore sets the store of the issued validation tickets.
+func SetTicketStore(s *TicketStore) {
+	tickets = s
+}
+
+// GetTicketStore returns the store of the issued validation tickets.
+func GetTicketStore() *TicketStore {
+	return tickets
+}
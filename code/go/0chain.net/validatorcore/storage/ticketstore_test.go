@@ -0,0 +1,67 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0chain/blobber/code/go/0chain.net/core/common"
+	"github.com/0chain/blobber/code/go/0chain.net/validatorcore/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tickets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data", "tickets.log")
+	s, err := storage.OpenTicketStore(path, time.Hour)
+	require.NoError(t, err)
+
+	first := &storage.ValidationTicket{ChallengeID: "c1", Result: false, MessageCode: "invalid_data", Timestamp: common.Now() - 1}
+	retry := &storage.ValidationTicket{ChallengeID: "c1", Result: true, MessageCode: "success", Timestamp: common.Now()}
+	require.NoError(t, s.Put("h1", first))
+	require.NoError(t, s.Put("h2", retry))
+	require.NoError(t, s.Close())
+
+	// the tickets survive a restart
+	s, err = storage.OpenTicketStore(path, time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 2, s.Len())
+
+	vt, ok := s.Get("h1")
+	require.True(t, ok)
+	require.Equal(t, first, vt)
+	vt, ok = s.GetByChallenge("c1")
+	require.True(t, ok)
+	require.Equal(t, retry, vt)
+	_, ok = s.GetByChallenge("c2")
+	require.False(t, ok)
+}
+
+func TestTicketStoreExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tickets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tickets.log")
+	s, err := storage.OpenTicketStore(path, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put("h1", &storage.ValidationTicket{ChallengeID: "c1"}))
+	_, ok := s.Get("h1")
+	require.False(t, ok)
+	require.NoError(t, s.Expire())
+	require.Equal(t, 0, s.Len())
+	require.NoError(t, s.Close())
+
+	s, err = storage.OpenTicketStore(path, time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 0, s.Len())
+}
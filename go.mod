@@ -6,6 +6,7 @@ require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/desertbit/timer v0.0.0-20180107155436-c41aec40b27f // indirect
 	github.com/didip/tollbooth v4.0.2+incompatible
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-ini/ini v1.55.0 // indirect
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.3
@@ -34,6 +35,7 @@ require (
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gorm.io/datatypes v0.0.0-20200806042100-bc394008dd0d
 	gorm.io/driver/postgres v1.0.0
+	gorm.io/driver/sqlite v1.1.3
 	gorm.io/gorm v1.20.4
 	nhooyr.io/websocket v1.8.7 // indirect
 )
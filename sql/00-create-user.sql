@@ -1,3 +1,5 @@
+-- The schema is created and migrated by the blobber, on start or by the
+-- 'blobber migrate' command.
 CREATE extension ltree;
 CREATE DATABASE blobber_meta;
 \connect blobber_meta;